@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"io"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -41,7 +42,7 @@ given as the arguments.
 	},
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if backupOptions.Stdin && backupOptions.FilesFrom == "-" {
+		if backupOptions.Stdin && backupOptions.filesFromStdin() {
 			return errors.Fatal("cannot use both `--stdin` and `--files-from -`")
 		}
 
@@ -60,20 +61,30 @@ given as the arguments.
 
 // BackupOptions bundles all options for the backup command.
 type BackupOptions struct {
-	Parent           string
-	Force            bool
-	Excludes         []string
-	ExcludeFiles     []string
-	ExcludeOtherFS   bool
-	ExcludeIfPresent []string
-	ExcludeCaches    bool
-	Stdin            bool
-	StdinFilename    string
-	Tags             []string
-	Hostname         string
-	FilesFrom        string
-	TimeStamp        string
-	WithAtime        bool
+	Parent              string
+	Force               bool
+	Excludes            []string
+	InsensitiveExcludes []string
+	ExcludeFiles        []string
+	excludeOrder        []patternKind
+	ExcludeOtherFS      bool
+	ExcludeIfPresent    []string
+	ExcludeCaches       bool
+	ExcludeLargerThan   string
+	ExcludeOlderThan    restic.Duration
+	ExcludeNoDump       bool
+	IgnoreFiles         []string
+	Stdin               bool
+	StdinFilename       string
+	Tags                []string
+	Description         string
+	Labels              restic.Labels
+	Hostname            string
+	FilesFrom           string
+	FilesFromRaw        string
+	FilesFromVerbatim   string
+	TimeStamp           string
+	WithAtime           bool
 }
 
 var backupOptions BackupOptions
@@ -84,16 +95,25 @@ func init() {
 	f := cmdBackup.Flags()
 	f.StringVar(&backupOptions.Parent, "parent", "", "use this parent snapshot (default: last snapshot in the repo that has the same target files/directories)")
 	f.BoolVarP(&backupOptions.Force, "force", "f", false, `force re-reading the target files/directories (overrides the "parent" flag)`)
-	f.StringArrayVarP(&backupOptions.Excludes, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
-	f.StringArrayVar(&backupOptions.ExcludeFiles, "exclude-file", nil, "read exclude patterns from a `file` (can be specified multiple times)")
+	f.VarP(patternFlag{&backupOptions.Excludes, &backupOptions.excludeOrder, patternSensitive}, "exclude", "e", "exclude a `pattern` (can be specified multiple times)")
+	f.Var(patternFlag{&backupOptions.InsensitiveExcludes, &backupOptions.excludeOrder, patternInsensitive}, "iexclude", "same as --exclude `pattern` but ignores the casing of filenames")
+	f.Var(patternFlag{&backupOptions.ExcludeFiles, &backupOptions.excludeOrder, patternFile}, "exclude-file", "read exclude patterns from a `file` (can be specified multiple times)")
 	f.BoolVarP(&backupOptions.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems")
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes filename[:header], exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file`)
+	f.StringVar(&backupOptions.ExcludeLargerThan, "exclude-larger-than", "", "exclude files larger than `size` (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.Var(&backupOptions.ExcludeOlderThan, "exclude-older-than", "exclude files which were last modified more than `duration` ago (e.g. 1y5m7d2h)")
+	f.BoolVar(&backupOptions.ExcludeNoDump, "exclude-nodump", false, "exclude files and directories which have the nodump flag set")
+	f.StringArrayVar(&backupOptions.IgnoreFiles, "ignore-file", nil, "exclude items matched by the gitignore-style patterns in the files `name` (e.g. .resticignore) in each directory (can be specified multiple times)")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "file name to use when reading from stdin")
 	f.StringArrayVar(&backupOptions.Tags, "tag", nil, "add a `tag` for the new snapshot (can be specified multiple times)")
+	f.StringVar(&backupOptions.Description, "description", "", "set a free-form `description` for the new snapshot")
+	f.Var(&backupOptions.Labels, "label", "add the label `key=value` to the new snapshot (can be specified multiple times)")
 	f.StringVar(&backupOptions.Hostname, "hostname", "", "set the `hostname` for the snapshot manually. To prevent an expensive rescan use the \"parent\" flag")
 	f.StringVar(&backupOptions.FilesFrom, "files-from", "", "read the files to backup from file (can be combined with file args)")
+	f.StringVar(&backupOptions.FilesFromRaw, "files-from-raw", "", "read the files to backup from `file`, separated by NUL bytes as printed by \"find -print0\" (can be combined with file args)")
+	f.StringVar(&backupOptions.FilesFromVerbatim, "files-from-verbatim", "", "read the files to backup from `file`, one per line without any interpretation (can be combined with file args)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "time of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
 }
@@ -160,35 +180,109 @@ func readLinesFromFile(filename string) ([]string, error) {
 	return lines, nil
 }
 
+// readFilenamesFromFile reads the filenames separated by sep from the given
+// file, if filename is a dash (-), the filenames are read from the standard
+// input. In contrast to readLinesFromFile, the filenames are returned
+// verbatim, only empty filenames are skipped.
+func readFilenamesFromFile(filename string, sep string) ([]string, error) {
+	if filename == "" {
+		return nil, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var filenames []string
+	for _, name := range strings.Split(string(buf), sep) {
+		if name == "" {
+			continue
+		}
+		filenames = append(filenames, name)
+	}
+
+	return filenames, nil
+}
+
+// filesFromStdin returns true if one of the --files-from options reads from
+// the standard input.
+func (opts BackupOptions) filesFromStdin() bool {
+	return opts.FilesFrom == "-" || opts.FilesFromRaw == "-" || opts.FilesFromVerbatim == "-"
+}
+
 // Check returns an error when an invalid combination of options was set.
 func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
-	if opts.FilesFrom == "-" && gopts.password == "" {
-		return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
+	stdinReaders := 0
+	for _, filename := range []string{opts.FilesFrom, opts.FilesFromRaw, opts.FilesFromVerbatim} {
+		if filename == "-" {
+			stdinReaders++
+		}
+	}
+
+	if stdinReaders > 1 {
+		return errors.Fatal("only one of --files-from, --files-from-raw and --files-from-verbatim can read from stdin")
+	}
+
+	if opts.filesFromStdin() && gopts.password == "" {
+		return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file, --password-command or $RESTIC_PASSWORD")
 	}
 
 	if opts.Stdin {
-		if opts.FilesFrom != "" {
+		if opts.FilesFrom != "" || opts.FilesFromRaw != "" || opts.FilesFromVerbatim != "" {
 			return errors.Fatal("--stdin and --files-from cannot be used together")
 		}
 
 		if len(args) > 0 {
 			return errors.Fatal("--stdin was specified and files/dirs were listed as arguments")
 		}
+
+		if opts.ExcludeNoDump {
+			return errors.Fatal("--stdin and --exclude-nodump cannot be used together")
+		}
 	}
 
 	return nil
 }
 
-// collectRejectFuncs returns a list of all functions which may reject data
+// rejectRule is a RejectFunc together with the reason for rejecting an item,
+// which is printed for excluded items in verbose mode.
+type rejectRule struct {
+	reason string
+	reject RejectFunc
+}
+
+// rejectedBy returns the first rule which rejects item, or nil if the item is
+// to be saved.
+func rejectedBy(rules []rejectRule, item string, fi os.FileInfo) *rejectRule {
+	for i := range rules {
+		if rules[i].reject(item, fi) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// collectRejectRules returns a list of all rules which may reject data
 // from being saved in a snapshot
-func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (fs []RejectFunc, err error) {
+func collectRejectRules(opts BackupOptions, repo *repository.Repository, targets []string) (rules []rejectRule, err error) {
 	// allowed devices
 	if opts.ExcludeOtherFS {
 		f, err := rejectByDevice(targets)
 		if err != nil {
 			return nil, err
 		}
-		fs = append(fs, f)
+		rules = append(rules, rejectRule{"on another file system", f})
 	}
 
 	// exclude restic cache
@@ -198,16 +292,12 @@ func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets
 			return nil, err
 		}
 
-		fs = append(fs, f)
+		rules = append(rules, rejectRule{"restic cache", f})
 	}
 
-	// add patterns from file
-	if len(opts.ExcludeFiles) > 0 {
-		opts.Excludes = append(opts.Excludes, readExcludePatternsFromFiles(opts.ExcludeFiles)...)
-	}
-
-	if len(opts.Excludes) > 0 {
-		fs = append(fs, rejectByPattern(opts.Excludes))
+	excludes := collectPatterns(opts.excludeOrder, opts.Excludes, opts.InsensitiveExcludes, opts.ExcludeFiles)
+	if len(excludes) > 0 {
+		rules = append(rules, rejectRule{"exclude pattern", rejectByPattern(excludes)})
 	}
 
 	if opts.ExcludeCaches {
@@ -220,10 +310,34 @@ func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets
 			return nil, err
 		}
 
-		fs = append(fs, f)
+		filename := strings.SplitN(spec, ":", 2)[0]
+		rules = append(rules, rejectRule{"directory contains " + filename, f})
+	}
+
+	if opts.ExcludeLargerThan != "" {
+		size, err := parseSizeStr(opts.ExcludeLargerThan)
+		if err != nil {
+			return nil, errors.Fatalf("invalid value for --exclude-larger-than: %v", err)
+		}
+
+		rules = append(rules, rejectRule{"larger than " + formatBytes(uint64(size)), rejectBySize(size)})
+	}
+
+	if !opts.ExcludeOlderThan.Zero() {
+		rules = append(rules, rejectRule{"older than " + opts.ExcludeOlderThan.String(),
+			rejectByAge(opts.ExcludeOlderThan.Before(time.Now()))})
+	}
+
+	if opts.ExcludeNoDump {
+		f, err := rejectNoDump(targets)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rejectRule{"nodump flag", f})
 	}
 
-	return fs, nil
+	return rules, nil
 }
 
 // readExcludePatternsFromFiles reads all exclude files and returns the list of
@@ -281,10 +395,22 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 		return nil, err
 	}
 
+	fromfileRaw, err := readFilenamesFromFile(opts.FilesFromRaw, "\x00")
+	if err != nil {
+		return nil, err
+	}
+
+	fromfileVerbatim, err := readFilenamesFromFile(opts.FilesFromVerbatim, "\n")
+	if err != nil {
+		return nil, err
+	}
+
 	// merge files from files-from into normal args so we can reuse the normal
 	// args checks and have the ability to use both files-from and args at the
 	// same time
 	args = append(args, fromfile...)
+	args = append(args, fromfileRaw...)
+	args = append(args, fromfileVerbatim...)
 	if len(args) == 0 && !opts.Stdin {
 		return nil, errors.Fatal("nothing to backup, please specify target files/dirs")
 	}
@@ -313,7 +439,7 @@ func findParentSnapshot(ctx context.Context, repo restic.Repository, opts Backup
 
 	// Find last snapshot to set it as parent, if not already set
 	if !opts.Force && parentID == nil {
-		id, err := restic.FindLatestSnapshot(ctx, repo, targets, []restic.TagList{}, opts.Hostname)
+		id, err := restic.FindLatestSnapshot(ctx, repo, targets, []restic.TagList{}, nil, opts.Hostname)
 		if err == nil {
 			parentID = &id
 		} else if err != restic.ErrNoSnapshotFound {
@@ -359,46 +485,67 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 	t.Go(func() error { return p.Run(t.Context(gopts.ctx)) })
 
 	p.V("open repository")
-	repo, err := OpenRepository(gopts)
+	repo, err := OpenRepositoryWriteOnly(gopts)
 	if err != nil {
 		return err
 	}
 
-	p.V("lock repository")
-	lock, err := lockRepo(repo)
-	defer unlockRepo(lock)
+	// backup does not lock the repository: it only adds new files, and prune
+	// only deletes packs which have been unreferenced for a grace period
+
+	// rejectRules collect rules that can reject items from the backup
+	rejectRules, err := collectRejectRules(opts, repo, targets)
 	if err != nil {
 		return err
 	}
 
-	// rejectFuncs collect functions that can reject items from the backup
-	rejectFuncs, err := collectRejectFuncs(opts, repo, targets)
+	// the ignore files are tracked along the directories which are walked, so
+	// the scanner and the archiver each need their own instance
+	newRejectRules := func() ([]rejectRule, error) {
+		rules := rejectRules
+		if len(opts.IgnoreFiles) > 0 {
+			f, err := rejectByIgnoreFile(opts.IgnoreFiles, targets)
+			if err != nil {
+				return nil, err
+			}
+
+			rules = append(rules[:len(rules):len(rules)], rejectRule{"ignore file", f})
+		}
+
+		return rules, nil
+	}
+
+	scanRules, err := newRejectRules()
 	if err != nil {
 		return err
 	}
 
-	p.V("load index files")
-	err = repo.LoadIndex(gopts.ctx)
+	archRules, err := newRejectRules()
 	if err != nil {
 		return err
 	}
 
-	parentSnapshotID, err := findParentSnapshot(gopts.ctx, repo, opts, targets)
+	p.V("load index files")
+	err = repo.LoadIndex(gopts.ctx)
 	if err != nil {
 		return err
 	}
 
-	if parentSnapshotID != nil {
-		p.V("using parent snapshot %v\n", parentSnapshotID.Str())
+	// write-only keys cannot read snapshots, so all files are read again
+	var parentSnapshotID *restic.ID
+	if repo.WriteOnly() {
+		if opts.Parent != "" {
+			return errors.Fatal("--parent cannot be used with a write-only key")
+		}
+	} else {
+		parentSnapshotID, err = findParentSnapshot(gopts.ctx, repo, opts, targets)
+		if err != nil {
+			return err
+		}
 	}
 
-	selectFilter := func(item string, fi os.FileInfo) bool {
-		for _, reject := range rejectFuncs {
-			if reject(item, fi) {
-				return false
-			}
-		}
-		return true
+	if parentSnapshotID != nil {
+		p.V("using parent snapshot %v\n", parentSnapshotID.Str())
 	}
 
 	timeStamp := time.Now()
@@ -422,7 +569,9 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 	}
 
 	sc := archiver.NewScanner(targetFS)
-	sc.Select = selectFilter
+	sc.Select = func(item string, fi os.FileInfo) bool {
+		return rejectedBy(scanRules, item, fi) == nil
+	}
 	sc.Error = p.ScannerError
 	sc.Result = p.ReportTotal
 
@@ -430,7 +579,13 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 	t.Go(func() error { return sc.Scan(t.Context(gopts.ctx), targets) })
 
 	arch := archiver.New(repo, targetFS, archiver.Options{})
-	arch.Select = selectFilter
+	arch.Select = func(item string, fi os.FileInfo) bool {
+		if rule := rejectedBy(archRules, item, fi); rule != nil {
+			p.VV("excluded  %v (%v)", item, rule.reason)
+			return false
+		}
+		return true
+	}
 	arch.WithAtime = opts.WithAtime
 	arch.Error = p.Error
 	arch.CompleteItem = p.CompleteItemFn
@@ -444,6 +599,8 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 	snapshotOpts := archiver.SnapshotOptions{
 		Excludes:       opts.Excludes,
 		Tags:           opts.Tags,
+		Description:    opts.Description,
+		Labels:         opts.Labels,
 		Time:           timeStamp,
 		Hostname:       opts.Hostname,
 		ParentSnapshot: *parentSnapshotID,
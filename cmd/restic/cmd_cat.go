@@ -74,13 +74,13 @@ func runCat(gopts GlobalOptions, args []string) error {
 		fmt.Println(string(buf))
 		return nil
 	case "index":
-		buf, err := repo.LoadAndDecrypt(gopts.ctx, restic.IndexFile, id)
+		// index files in the binary format are printed as JSON
+		idx, err := repository.LoadIndex(gopts.ctx, repo, id)
 		if err != nil {
 			return err
 		}
 
-		_, err = os.Stdout.Write(append(buf, '\n'))
-		return err
+		return idx.Dump(os.Stdout)
 
 	case "snapshot":
 		sn := &restic.Snapshot{}
@@ -171,7 +171,7 @@ func runCat(gopts GlobalOptions, args []string) error {
 			}
 			blob := list[0]
 
-			buf := make([]byte, blob.Length)
+			buf := make([]byte, restic.CiphertextLength(int(blob.DataLength())))
 			n, err := repo.LoadBlob(gopts.ctx, t, id, buf)
 			if err != nil {
 				return err
@@ -25,6 +25,10 @@ finds. It can also be used to read all data and therefore simulate a restore.
 
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
+
+If the repository stores parity data for its packs, damaged packs found while
+reading the data can be reconstructed. Pass "--repair-packs" to replace the
+damaged packs in the repository by the reconstructed ones.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -41,6 +45,7 @@ type CheckOptions struct {
 	ReadDataSubset string
 	CheckUnused    bool
 	WithCache      bool
+	RepairPacks    bool
 }
 
 var checkOptions CheckOptions
@@ -53,12 +58,16 @@ func init() {
 	f.StringVar(&checkOptions.ReadDataSubset, "read-data-subset", "", "read subset of data packs")
 	f.BoolVar(&checkOptions.CheckUnused, "check-unused", false, "find unused blobs")
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use the cache")
+	f.BoolVar(&checkOptions.RepairPacks, "repair-packs", false, "repair damaged packs using their parity data, requires --read-data or --read-data-subset")
 }
 
 func checkFlags(opts CheckOptions) error {
 	if opts.ReadData && opts.ReadDataSubset != "" {
 		return errors.Fatalf("check flags --read-data and --read-data-subset cannot be used together")
 	}
+	if opts.RepairPacks && !opts.ReadData && opts.ReadDataSubset == "" {
+		return errors.Fatalf("check flag --repair-packs requires --read-data or --read-data-subset")
+	}
 	if opts.ReadDataSubset != "" {
 		dataSubset, err := stringToIntSlice(opts.ReadDataSubset)
 		if err != nil || len(dataSubset) != 2 {
@@ -184,6 +193,7 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	chkr := checker.New(repo)
+	chkr.RepairPacks = opts.RepairPacks
 
 	Verbosef("load indexes\n")
 	hints, errs := chkr.LoadIndex(gopts.ctx)
@@ -207,8 +217,19 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("LoadIndex returned errors")
 	}
 
+	deletions, err := restic.LoadAllDeletions(gopts.ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	markedPacks := restic.NewIDSet()
+	for _, d := range deletions {
+		markedPacks.Merge(restic.NewIDSet(d.Packs...))
+	}
+
 	errorsFound := false
 	orphanedPacks := 0
+	pendingPacks := 0
 	errChan := make(chan error)
 
 	Verbosef("check all packs\n")
@@ -216,6 +237,11 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 
 	for err := range errChan {
 		if checker.IsOrphanedPack(err) {
+			// packs marked for deletion by prune are not referenced by the index
+			if markedPacks.Has(errors.Cause(err).(checker.PackError).ID) {
+				pendingPacks++
+				continue
+			}
 			orphanedPacks++
 			Verbosef("%v\n", err)
 			continue
@@ -224,6 +250,10 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 	}
 
+	if pendingPacks > 0 {
+		Verbosef("%d files are marked for deletion and will be removed by `restic prune` after the grace period\n", pendingPacks)
+	}
+
 	if orphanedPacks > 0 {
 		Verbosef("%d additional files were found in the repo, which likely contain duplicate data.\nYou can run `restic prune` to correct this.\n", orphanedPacks)
 	}
@@ -251,6 +281,7 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	repairablePacks := 0
 	doReadData := func(bucket, totalBuckets uint) {
 		packs := restic.IDSet{}
 		for pack := range chkr.GetPacks() {
@@ -272,6 +303,14 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		go chkr.ReadPacks(gopts.ctx, packs, p, errChan)
 
 		for err := range errChan {
+			if _, ok := err.(checker.ErrPackRepaired); ok {
+				Printf("%v\n", err)
+				continue
+			}
+
+			if _, ok := err.(checker.ErrPackRepairable); ok {
+				repairablePacks++
+			}
 			errorsFound = true
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 		}
@@ -285,6 +324,10 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		doReadData(dataSubset[0], dataSubset[1])
 	}
 
+	if repairablePacks > 0 {
+		Printf("%d damaged packs can be repaired, run `restic check --read-data --repair-packs' to repair them\n", repairablePacks)
+	}
+
 	if errorsFound {
 		return errors.Fatal("repository contains errors")
 	}
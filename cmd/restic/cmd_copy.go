@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdCopy = &cobra.Command{
+	Use:   "copy [flags] [snapshot-ID ...]",
+	Short: "Copy snapshots from one repository to another",
+	Long: `
+The "copy" command copies one or more snapshots from the repository given by
+--from-repo to the repository given by --repo.
+
+When no snapshot-ID is given, all snapshots matching the host, tag and path
+filter criteria are copied. Snapshots which have already been copied to the
+destination repository are skipped.
+
+Only blobs which are not yet present in the destination repository are
+transferred, they are decrypted with the key of the source repository and
+encrypted again with the key of the destination repository. Deduplication
+between both repositories works best when the destination repository was
+initialized with the same chunker parameters as the source repository.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCopy(copyOptions, globalOptions, args)
+	},
+}
+
+// CopyOptions bundles all options for the 'copy' command.
+type CopyOptions struct {
+	secondaryRepoOptions
+	Host   string
+	Tags   restic.TagLists
+	Labels restic.Labels
+	Paths  []string
+}
+
+var copyOptions CopyOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdCopy)
+
+	f := cmdCopy.Flags()
+	initSecondaryRepoOptions(f, &copyOptions.secondaryRepoOptions, "source repository to copy snapshots from")
+	f.StringVarP(&copyOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
+	f.Var(&copyOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
+	f.Var(&copyOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times), when no snapshot ID is given")
+	f.StringArrayVar(&copyOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+}
+
+func runCopy(opts CopyOptions, gopts GlobalOptions, args []string) error {
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	srcRepo, err := openSecondaryRepository(opts.secondaryRepoOptions, gopts, "source")
+	if err != nil {
+		return err
+	}
+
+	dstRepo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		srcLock, err := lockRepo(srcRepo)
+		defer unlockRepo(srcLock)
+		if err != nil {
+			return err
+		}
+
+		dstLock, err := lockRepo(dstRepo)
+		defer unlockRepo(dstLock)
+		if err != nil {
+			return err
+		}
+	}
+
+	Verbosef("loading indexes...\n")
+	if err = srcRepo.LoadIndex(ctx); err != nil {
+		return err
+	}
+	if err = dstRepo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	dstSnapshots, err := restic.LoadAllSnapshots(ctx, dstRepo)
+	if err != nil {
+		return err
+	}
+
+	// group the existing snapshots by tree so that finding copies is cheap
+	dstSnapshotsByTree := make(map[restic.ID][]*restic.Snapshot)
+	for _, sn := range dstSnapshots {
+		dstSnapshotsByTree[*sn.Tree] = append(dstSnapshotsByTree[*sn.Tree], sn)
+	}
+
+	// remember the trees which have already been processed
+	visitedTrees := restic.NewBlobSet()
+	copied := 0
+
+	for sn := range FindFilteredSnapshots(ctx, srcRepo, opts.Host, opts.Tags, opts.Labels, opts.Paths, args) {
+		if sn.Tree == nil {
+			Warnf("snapshot %v has no tree, skipping\n", sn.ID().Str())
+			continue
+		}
+
+		alreadyCopied := false
+		for _, dst := range dstSnapshotsByTree[*sn.Tree] {
+			if similarSnapshots(sn, dst) {
+				Verbosef("skipping snapshot %v, already copied as %v\n", sn.ID().Str(), dst.ID().Str())
+				alreadyCopied = true
+				break
+			}
+		}
+		if alreadyCopied {
+			continue
+		}
+
+		Verbosef("copy snapshot %v of %v at %v\n", sn.ID().Str(), sn.Paths, sn.Time)
+		err = copyTree(ctx, srcRepo, dstRepo, *sn.Tree, visitedTrees)
+		if err != nil {
+			return err
+		}
+
+		// the parent snapshot does not exist in the destination repository
+		sn.Parent = nil
+		if sn.Original == nil {
+			sn.Original = sn.ID()
+		}
+
+		id, err := dstRepo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+		if err != nil {
+			return err
+		}
+		Verbosef("snapshot %v saved\n", id.Str())
+
+		dstSnapshotsByTree[*sn.Tree] = append(dstSnapshotsByTree[*sn.Tree], sn)
+		copied++
+	}
+
+	if copied == 0 {
+		Verbosef("no snapshots were copied\n")
+	} else {
+		Verbosef("copied %v snapshots\n", copied)
+	}
+
+	return nil
+}
+
+// similarSnapshots returns true when both snapshots reference the same data
+// and metadata. Parent and Original are ignored since they are changed when a
+// snapshot is copied.
+func similarSnapshots(sna, snb *restic.Snapshot) bool {
+	if !sna.Time.Equal(snb.Time) || !sna.Tree.Equal(*snb.Tree) ||
+		sna.Hostname != snb.Hostname || sna.Username != snb.Username ||
+		sna.UID != snb.UID || sna.GID != snb.GID ||
+		sna.Description != snb.Description {
+		return false
+	}
+
+	return equalStrings(sna.Paths, snb.Paths) &&
+		equalStrings(sna.Excludes, snb.Excludes) &&
+		equalStrings(sna.Tags, snb.Tags) &&
+		equalLabels(sna.Labels, snb.Labels)
+}
+
+func equalLabels(a, b restic.Labels) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// copyTree transfers all blobs referenced by the tree rootTreeID which are
+// not yet stored in dstRepo. Afterwards the data is flushed and the index of
+// dstRepo is saved.
+func copyTree(ctx context.Context, srcRepo, dstRepo *repository.Repository, rootTreeID restic.ID, visitedTrees restic.BlobSet) error {
+	blobs := restic.NewBlobSet()
+	err := restic.FindUsedBlobs(ctx, srcRepo, rootTreeID, blobs, visitedTrees)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for h := range blobs {
+		if dstRepo.Index().Has(h.ID, h.Type) {
+			continue
+		}
+
+		size, found := srcRepo.LookupBlobSize(h.ID, h.Type)
+		if !found {
+			return errors.Errorf("blob %v not found in source repository", h)
+		}
+
+		if cap(buf) < restic.CiphertextLength(int(size)) {
+			buf = make([]byte, restic.CiphertextLength(int(size)))
+		}
+
+		n, err := srcRepo.LoadBlob(ctx, h.Type, h.ID, buf)
+		if err != nil {
+			return err
+		}
+
+		debug.Log("copy blob %v (%d bytes)", h, n)
+		_, err = dstRepo.SaveBlob(ctx, h.Type, buf[:n], h.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = dstRepo.Flush(ctx); err != nil {
+		return err
+	}
+
+	return dstRepo.SaveIndex(ctx)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestSimilarSnapshots(t *testing.T) {
+	newSnapshot := func() *restic.Snapshot {
+		sn, err := restic.NewSnapshot([]string{"/home/user"}, []string{"foo"}, "host", time.Unix(1500000000, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := restic.NewRandomID()
+		sn.Tree = &tree
+		sn.Description = "daily backup"
+		sn.Labels = restic.Labels{"env": "prod"}
+		return sn
+	}
+
+	sna := newSnapshot()
+	snb := *sna
+	if !similarSnapshots(sna, &snb) {
+		t.Errorf("identical snapshots are not similar")
+	}
+
+	var tests = []struct {
+		name   string
+		modify func(sn *restic.Snapshot)
+	}{
+		{"description", func(sn *restic.Snapshot) { sn.Description = "weekly backup" }},
+		{"label value", func(sn *restic.Snapshot) { sn.Labels = restic.Labels{"env": "test"} }},
+		{"label key", func(sn *restic.Snapshot) { sn.Labels = restic.Labels{"stage": "prod"} }},
+		{"no labels", func(sn *restic.Snapshot) { sn.Labels = nil }},
+		{"tags", func(sn *restic.Snapshot) { sn.Tags = []string{"bar"} }},
+	}
+
+	for _, test := range tests {
+		snb := *sna
+		test.modify(&snb)
+		if similarSnapshots(sna, &snb) {
+			t.Errorf("snapshots with different %v are similar", test.name)
+		}
+	}
+}
@@ -31,9 +31,10 @@ repository.
 
 // DumpOptions collects all options for the dump command.
 type DumpOptions struct {
-	Host  string
-	Paths []string
-	Tags  restic.TagLists
+	Host   string
+	Paths  []string
+	Tags   restic.TagLists
+	Labels restic.Labels
 }
 
 var dumpOptions DumpOptions
@@ -44,6 +45,7 @@ func init() {
 	flags := cmdDump.Flags()
 	flags.StringVarP(&dumpOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
 	flags.Var(&dumpOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
+	flags.Var(&dumpOptions.Labels, "label", "only consider snapshots which have the label `key=value` for snapshot ID \"latest\" (can be specified multiple times)")
 	flags.StringArrayVar(&dumpOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
 }
 
@@ -151,7 +153,7 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 	var id restic.ID
 
 	if snapshotIDString == "latest" {
-		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Host)
+		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Labels, opts.Host)
 		if err != nil {
 			Exitf(1, "latest snapshot for criteria not found: %v Paths:%v Host:%v", err, opts.Paths, opts.Host)
 		}
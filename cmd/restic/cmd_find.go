@@ -36,6 +36,7 @@ type FindOptions struct {
 	Host            string
 	Paths           []string
 	Tags            restic.TagLists
+	Labels          restic.Labels
 }
 
 var findOptions FindOptions
@@ -52,6 +53,7 @@ func init() {
 
 	f.StringVarP(&findOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	f.Var(&findOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot-ID is given")
+	f.Var(&findOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times), when no snapshot-ID is given")
 	f.StringArrayVar(&findOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot-ID is given")
 }
 
@@ -294,7 +296,7 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		out:      statefulOutput{ListLong: opts.ListLong, JSON: globalOptions.JSON},
 		notfound: restic.NewIDSet(),
 	}
-	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Snapshots) {
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Labels, opts.Paths, opts.Snapshots) {
 		if err = f.findInSnapshot(ctx, sn); err != nil {
 			return err
 		}
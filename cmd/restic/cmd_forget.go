@@ -21,7 +21,7 @@ is a reference to data stored there. In order to remove this (now unreferenced)
 data after 'forget' was run successfully, see the 'prune' command. `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runForget(forgetOptions, globalOptions, args)
+		return runForget(forgetOptions, forgetPruneOptions, globalOptions, args)
 	},
 }
 
@@ -35,8 +35,19 @@ type ForgetOptions struct {
 	Yearly   int
 	KeepTags restic.TagLists
 
+	Within        restic.Duration
+	WithinDaily   restic.Duration
+	WithinWeekly  restic.Duration
+	WithinMonthly restic.Duration
+	WithinYearly  restic.Duration
+
+	// PolicyFile contains rules which apply different policies to snapshots
+	// selected by host, tags, paths and labels.
+	PolicyFile string
+
 	Host    string
 	Tags    restic.TagLists
+	Labels  restic.Labels
 	Paths   []string
 	Compact bool
 
@@ -47,6 +58,7 @@ type ForgetOptions struct {
 }
 
 var forgetOptions ForgetOptions
+var forgetPruneOptions PruneOptions
 
 func init() {
 	cmdRoot.AddCommand(cmdForget)
@@ -58,24 +70,70 @@ func init() {
 	f.IntVarP(&forgetOptions.Weekly, "keep-weekly", "w", 0, "keep the last `n` weekly snapshots")
 	f.IntVarP(&forgetOptions.Monthly, "keep-monthly", "m", 0, "keep the last `n` monthly snapshots")
 	f.IntVarP(&forgetOptions.Yearly, "keep-yearly", "y", 0, "keep the last `n` yearly snapshots")
+	f.Var(&forgetOptions.Within, "keep-within", "keep snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinDaily, "keep-within-daily", "keep daily snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinWeekly, "keep-within-weekly", "keep weekly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinMonthly, "keep-within-monthly", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinYearly, "keep-within-yearly", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 
 	f.Var(&forgetOptions.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
+	f.StringVar(&forgetOptions.PolicyFile, "policy-file", "", "read rules which select the policy for the snapshots from `file` (cannot be combined with --keep-*)")
 	// Sadly the commonly used shortcut `H` is already used.
 	f.StringVar(&forgetOptions.Host, "host", "", "only consider snapshots with the given `host`")
 	// Deprecated since 2017-03-07.
 	f.StringVar(&forgetOptions.Host, "hostname", "", "only consider snapshots with the given `hostname` (deprecated)")
 	f.Var(&forgetOptions.Tags, "tag", "only consider snapshots which include this `taglist` in the format `tag[,tag,...]` (can be specified multiple times)")
+	f.Var(&forgetOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times)")
 	f.StringArrayVar(&forgetOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` (can be specified multiple times)")
 	f.BoolVarP(&forgetOptions.Compact, "compact", "c", false, "use compact format")
 
-	f.StringVarP(&forgetOptions.GroupBy, "group-by", "g", "host,paths", "string for grouping snapshots by host,paths,tags")
+	f.StringVarP(&forgetOptions.GroupBy, "group-by", "g", "host,paths", "string for grouping snapshots by host,paths,tags,label:key")
 	f.BoolVarP(&forgetOptions.DryRun, "dry-run", "n", false, "do not delete anything, just print what would be done")
 	f.BoolVar(&forgetOptions.Prune, "prune", false, "automatically run the 'prune' command if snapshots have been removed")
+	addPruneOptions(f, &forgetPruneOptions)
 
 	f.SortFlags = false
 }
 
-func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
+func runForget(opts ForgetOptions, pruneOpts PruneOptions, gopts GlobalOptions, args []string) error {
+	if opts.Prune {
+		if err := verifyPruneOptions(&pruneOpts); err != nil {
+			return err
+		}
+	}
+
+	policy := restic.ExpirePolicy{
+		Last:    opts.Last,
+		Hourly:  opts.Hourly,
+		Daily:   opts.Daily,
+		Weekly:  opts.Weekly,
+		Monthly: opts.Monthly,
+		Yearly:  opts.Yearly,
+		Tags:    opts.KeepTags,
+
+		Within:        opts.Within,
+		WithinDaily:   opts.WithinDaily,
+		WithinWeekly:  opts.WithinWeekly,
+		WithinMonthly: opts.WithinMonthly,
+		WithinYearly:  opts.WithinYearly,
+	}
+
+	var rules []forgetRule
+	if opts.PolicyFile != "" {
+		if !policy.Empty() {
+			return errors.Fatal("--policy-file cannot be combined with the --keep-* options")
+		}
+		if len(args) > 0 {
+			return errors.Fatal("--policy-file cannot be used when snapshot IDs are given")
+		}
+
+		var err error
+		rules, err = loadForgetPolicyFile(opts.PolicyFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
@@ -87,17 +145,20 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
-	// group by hostname and dirs
+	// group by rule, hostname and dirs
 	type key struct {
+		Rule     int
 		Hostname string
 		Paths    []string
 		Tags     []string
+		Labels   map[string]string
 	}
 	snapshotGroups := make(map[string]restic.Snapshots)
 
 	var GroupByTag bool
 	var GroupByHost bool
 	var GroupByPath bool
+	var GroupByLabels []string
 	var GroupOptionList []string
 
 	GroupOptionList = strings.Split(opts.GroupBy, ",")
@@ -112,20 +173,29 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 			GroupByTag = true
 		case "":
 		default:
+			if strings.HasPrefix(option, "label:") && len(option) > len("label:") {
+				GroupByLabels = append(GroupByLabels, strings.TrimPrefix(option, "label:"))
+				continue
+			}
 			return errors.Fatal("unknown grouping option: '" + option + "'")
 		}
 	}
 
 	removeSnapshots := 0
+	keepSnapshots := 0
 
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
-	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Labels, opts.Paths, args) {
 		if len(args) > 0 {
 			// When explicit snapshots args are given, remove them immediately.
+			if sn.Protected {
+				Warnf("snapshot %v is protected, not removing it\n", sn.ID().Str())
+				continue
+			}
+
 			if !opts.DryRun {
-				h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
-				if err = repo.Backend().Remove(gopts.ctx, h); err != nil {
+				if err = restic.RemoveSnapshot(gopts.ctx, repo, sn); err != nil {
 					return err
 				}
 				Verbosef("removed snapshot %v\n", sn.ID().Str())
@@ -134,10 +204,25 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 				Verbosef("would have removed snapshot %v\n", sn.ID().Str())
 			}
 		} else {
+			// Snapshots which are not selected by any rule are not touched.
+			rule := -1
+			for i, r := range rules {
+				if r.Matches(sn) {
+					rule = i
+					break
+				}
+			}
+			if rules != nil && rule < 0 {
+				Verbosef("snapshot %v does not match any rule, keeping it\n", sn.ID().Str())
+				keepSnapshots++
+				continue
+			}
+
 			// Determining grouping-keys
 			var tags []string
 			var hostname string
 			var paths []string
+			var labels map[string]string
 
 			if GroupByTag {
 				tags = sn.Tags
@@ -149,12 +234,19 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 			if GroupByPath {
 				paths = sn.Paths
 			}
+			if len(GroupByLabels) > 0 {
+				// snapshots without the label are grouped together
+				labels = make(map[string]string, len(GroupByLabels))
+				for _, label := range GroupByLabels {
+					labels[label] = sn.Labels[label]
+				}
+			}
 
 			sort.StringSlice(sn.Paths).Sort()
 			var k []byte
 			var err error
 
-			k, err = json.Marshal(key{Tags: tags, Hostname: hostname, Paths: paths})
+			k, err = json.Marshal(key{Rule: rule, Tags: tags, Hostname: hostname, Paths: paths, Labels: labels})
 
 			if err != nil {
 				return err
@@ -163,32 +255,46 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	policy := restic.ExpirePolicy{
-		Last:    opts.Last,
-		Hourly:  opts.Hourly,
-		Daily:   opts.Daily,
-		Weekly:  opts.Weekly,
-		Monthly: opts.Monthly,
-		Yearly:  opts.Yearly,
-		Tags:    opts.KeepTags,
-	}
-
-	if policy.Empty() && len(args) == 0 {
+	if policy.Empty() && rules == nil && len(args) == 0 {
 		Verbosef("no policy was specified, no snapshots will be removed\n")
 	}
 
-	if !policy.Empty() {
-		Verbosef("Applying Policy: %v\n", policy)
+	if !policy.Empty() || rules != nil {
+		if rules == nil {
+			Verbosef("Applying Policy: %v\n", policy)
+		} else {
+			for _, rule := range rules {
+				Verbosef("Applying Policy for %v: %v\n", rule, rule.Policy)
+			}
+		}
+
+		// process the groups in a stable order, so that the groups of the
+		// same rule are printed together
+		groupKeys := make([]string, 0, len(snapshotGroups))
+		for k := range snapshotGroups {
+			groupKeys = append(groupKeys, k)
+		}
+		sort.Strings(groupKeys)
+
+		for _, k := range groupKeys {
+			snapshotGroup := snapshotGroups[k]
 
-		for k, snapshotGroup := range snapshotGroups {
 			var key key
-			if json.Unmarshal([]byte(k), &key) != nil {
+			if err = json.Unmarshal([]byte(k), &key); err != nil {
 				return err
 			}
 
+			groupPolicy := policy
+			if rules != nil {
+				groupPolicy = rules[key.Rule].Policy
+			}
+
 			// Info
 			Verbosef("snapshots")
 			var infoStrings []string
+			if rules != nil {
+				infoStrings = append(infoStrings, rules[key.Rule].String())
+			}
 			if GroupByTag {
 				infoStrings = append(infoStrings, "tags ["+strings.Join(key.Tags, ", ")+"]")
 			}
@@ -198,31 +304,34 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 			if GroupByPath {
 				infoStrings = append(infoStrings, "paths ["+strings.Join(key.Paths, ", ")+"]")
 			}
+			for _, label := range GroupByLabels {
+				infoStrings = append(infoStrings, "label "+label+" ["+key.Labels[label]+"]")
+			}
 			if infoStrings != nil {
 				Verbosef(" for (" + strings.Join(infoStrings, ", ") + ")")
 			}
 			Verbosef(":\n\n")
 
-			keep, remove := restic.ApplyPolicy(snapshotGroup, policy)
+			keep, remove, reasons := restic.ApplyPolicy(snapshotGroup, groupPolicy)
 
 			if len(keep) != 0 && !gopts.Quiet {
 				Printf("keep %d snapshots:\n", len(keep))
-				PrintSnapshots(globalOptions.stdout, keep, opts.Compact)
+				PrintSnapshots(globalOptions.stdout, keep, reasons, opts.Compact)
 				Printf("\n")
 			}
 
 			if len(remove) != 0 && !gopts.Quiet {
 				Printf("remove %d snapshots:\n", len(remove))
-				PrintSnapshots(globalOptions.stdout, remove, opts.Compact)
+				PrintSnapshots(globalOptions.stdout, remove, nil, opts.Compact)
 				Printf("\n")
 			}
 
+			keepSnapshots += len(keep)
 			removeSnapshots += len(remove)
 
 			if !opts.DryRun {
 				for _, sn := range remove {
-					h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
-					err = repo.Backend().Remove(gopts.ctx, h)
+					err = restic.RemoveSnapshot(gopts.ctx, repo, sn)
 					if err != nil {
 						return err
 					}
@@ -231,10 +340,18 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	if rules != nil {
+		if opts.DryRun {
+			Verbosef("would keep %d snapshots and remove %d snapshots\n", keepSnapshots, removeSnapshots)
+		} else {
+			Verbosef("kept %d snapshots, removed %d snapshots\n", keepSnapshots, removeSnapshots)
+		}
+	}
+
 	if removeSnapshots > 0 && opts.Prune {
 		Verbosef("%d snapshots have been removed, running prune\n", removeSnapshots)
 		if !opts.DryRun {
-			return pruneRepository(gopts, repo)
+			return pruneRepository(pruneOpts, gopts, repo)
 		}
 	}
 
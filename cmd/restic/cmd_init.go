@@ -1,8 +1,12 @@
 package main
 
 import (
+	"strconv"
+
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
 )
@@ -12,22 +16,156 @@ var cmdInit = &cobra.Command{
 	Short: "Initialize a new repository",
 	Long: `
 The "init" command initializes a new repository.
+
+By default, new repositories use the stable repository format (version 2),
+which supports compressing data and tree blobs. Pass "--repository-version 1"
+to create a repository that can also be accessed by older versions of restic,
+in this case compression is not available. "--repository-version latest"
+selects the newest format (version 4), which additionally stores the index in
+a compact binary format and supports write-only keys. Older versions of restic
+cannot access repositories with version 3 or 4.
+
+When "--copy-chunker-params" is given, the chunker parameters are taken from
+the repository given by "--from-repo" instead of generating new ones. Both
+repositories then split files into the same chunks, which allows deduplicating
+data copied between them.
+
+When "--parity-shards" is given, redundancy data is stored for each pack file,
+which allows repairing damaged packs. Each pack is split into "--data-shards"
+parts, for which the given number of parity parts is computed. Up to this
+number of damaged parts can be reconstructed, for the price of additional
+storage space: The default of 10 data shards with 2 parity shards needs 20%
+more space for the data.
+
+The target size of pack files defaults to 4 MiB. A different size can be
+selected with the global "--pack-size" option, which is then stored in the
+repository config and used by all later operations. Larger packs reduce the
+number of files in the repository, which helps with backends that are slow
+for many small files or limit the number of files.
+
+By default, the password is processed with scrypt using parameters which take
+about 0.5 seconds on this machine. Use "--kdf" and the "--kdf-*" options to
+select scrypt or Argon2id with explicit parameters instead, e.g. when the
+repository is also accessed from slower machines.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runInit(globalOptions, args)
+		return runInit(initOptions, globalOptions, args)
 	},
 }
 
+// InitOptions bundles all options for the init command.
+type InitOptions struct {
+	secondaryRepoOptions
+	kdfOptions
+	RepositoryVersion string
+	Compression       string
+	CopyChunkerParams bool
+	DataShards        int
+	ParityShards      int
+}
+
+var initOptions InitOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdInit)
+
+	f := cmdInit.Flags()
+	f.StringVar(&initOptions.RepositoryVersion, "repository-version", "stable", "repository format version to use, allowed values are '1', '2', '3', '4', 'stable' (version 2) and 'latest' (version 4, required for write-only keys)")
+	f.StringVar(&initOptions.Compression, "compression", "", "compression mode for the repository, allowed values are 'off', 'auto' and 'max' (default: 'off' for repository version 1, 'auto' otherwise)")
+	f.BoolVar(&initOptions.CopyChunkerParams, "copy-chunker-params", false, "copy chunker parameters from the repository given by --from-repo")
+	f.IntVar(&initOptions.DataShards, "data-shards", 10, "split packs into `n` shards to compute the parity data")
+	f.IntVar(&initOptions.ParityShards, "parity-shards", 0, "store `n` shards of parity data for each pack (default: no parity data)")
+	initSecondaryRepoOptions(f, &initOptions.secondaryRepoOptions, "repository to copy the chunker parameters from")
+	initKDFOptions(f, &initOptions.kdfOptions)
+}
+
+// parseRepositoryVersion returns the repository version selected by s.
+func parseRepositoryVersion(s string) (uint, error) {
+	switch s {
+	case "", "stable":
+		return restic.RepoVersion, nil
+	case "latest":
+		return restic.MaxRepoVersion, nil
+	}
+
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || v < restic.MinRepoVersion || v > restic.MaxRepoVersion {
+		return 0, errors.Fatalf("invalid repository version %q, allowed values are '1', '2', '3', '4', 'stable' and 'latest'", s)
+	}
+
+	return uint(v), nil
 }
 
-func runInit(gopts GlobalOptions, args []string) error {
+// parseInitCompression returns the compression mode selected by s for a new
+// repository with the given version. Compression is only enabled by default
+// for repository versions which support it.
+func parseInitCompression(s string, version uint) (restic.CompressionMode, error) {
+	if s == "" {
+		if version < 2 {
+			return restic.CompressionOff, nil
+		}
+		return restic.CompressionAuto, nil
+	}
+
+	mode, err := restic.ParseCompressionMode(s)
+	if err != nil {
+		return "", errors.Fatalf("%v", err)
+	}
+
+	return mode, nil
+}
+
+func runInit(opts InitOptions, gopts GlobalOptions, args []string) error {
 	if gopts.Repo == "" {
 		return errors.Fatal("Please specify repository location (-r)")
 	}
 
+	version, err := parseRepositoryVersion(opts.RepositoryVersion)
+	if err != nil {
+		return err
+	}
+
+	compression, err := parseInitCompression(opts.Compression, version)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := restic.CreateConfig(version, compression)
+	if err != nil {
+		return errors.Fatalf("%v", err)
+	}
+
+	if opts.ParityShards > 0 {
+		cfg.Parity, err = restic.NewParityConfig(opts.DataShards, opts.ParityShards)
+		if err != nil {
+			return errors.Fatalf("%v", err)
+		}
+	}
+
+	if gopts.PackSize > 0 {
+		cfg.PackSize, err = packSizeBytes(gopts.PackSize)
+		if err != nil {
+			return err
+		}
+
+		if err = restic.CheckPackSize(cfg.PackSize); err != nil {
+			return errors.Fatalf("%v", err)
+		}
+	}
+
+	kdf, err := opts.kdfOptions.params()
+	if err != nil {
+		return err
+	}
+
+	if opts.CopyChunkerParams {
+		cfg.ChunkerPolynomial, err = loadChunkerPolynomial(opts.secondaryRepoOptions, gopts)
+		if err != nil {
+			return err
+		}
+	}
+
 	be, err := create(gopts.Repo, gopts.extended)
 	if err != nil {
 		return errors.Fatalf("create repository at %s failed: %v\n", gopts.Repo, err)
@@ -42,7 +180,7 @@ func runInit(gopts GlobalOptions, args []string) error {
 
 	s := repository.New(be)
 
-	err = s.Init(gopts.ctx, gopts.password)
+	err = s.Init(gopts.ctx, gopts.password, repository.KeyOptions{KDF: kdf}, cfg)
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", gopts.Repo, err)
 	}
@@ -55,3 +193,17 @@ func runInit(gopts GlobalOptions, args []string) error {
 
 	return nil
 }
+
+// loadChunkerPolynomial returns the chunker polynomial of the repository given
+// by --from-repo.
+func loadChunkerPolynomial(opts secondaryRepoOptions, gopts GlobalOptions) (chunker.Pol, error) {
+	otherRepo, err := openSecondaryRepository(opts, gopts, "secondary")
+	if err != nil {
+		return 0, err
+	}
+
+	pol := otherRepo.Config().ChunkerPolynomial
+	Verbosef("using chunker parameters from repository %v\n", opts.FromRepo)
+
+	return pol, nil
+}
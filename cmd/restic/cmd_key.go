@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
@@ -19,26 +21,83 @@ var cmdKey = &cobra.Command{
 	Short: "Manage keys (passwords)",
 	Long: `
 The "key" command manages keys (passwords) for accessing the repository.
+
+The user and host name stored for a new key default to the current user and
+host, they can be set with "--user" and "--host". A free-form description can
+be added with "--comment". With "--expires", the key is not accepted any more
+after the given date. "key passwd" keeps the metadata of the current key
+unless new values are given.
+
+The key which is used to access the repository can only be removed with
+"--force". The last remaining key of a repository is never removed.
+
+New keys use scrypt with parameters calibrated for this machine. "--kdf" and
+the "--kdf-*" options select scrypt or Argon2id with explicit parameters for
+"key add" and "key passwd". "key passwd --rekdf" keeps the current password
+and only derives the key again with the calibrated or given parameters.
+
+"key add --write-only" creates a key which can only be used to add new data,
+e.g. by running backups. It cannot be used to restore, list or remove data,
+and not to manage keys. Write-only keys require repository version 4, which is
+created with "init --repository-version latest" (or "4"), or upgraded to with
+the migration "upgrade_repo_v4".
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runKey(globalOptions, args)
+		return runKey(keyOptions, globalOptions, args)
 	},
 }
 
-var newPasswordFile string
+var (
+	newPasswordFile    string
+	newPasswordCommand string
+)
+
+// KeyOptions bundles all options for the key command.
+type KeyOptions struct {
+	kdfOptions
+	Username  string
+	Hostname  string
+	Comment   string
+	Expires   string
+	WriteOnly bool
+	Force     bool
+	ReKDF     bool
+}
+
+var keyOptions KeyOptions
 
 func init() {
 	cmdRoot.AddCommand(cmdKey)
 
 	flags := cmdKey.Flags()
 	flags.StringVarP(&newPasswordFile, "new-password-file", "", "", "the file from which to load a new password")
+	flags.StringVar(&newPasswordCommand, "new-password-command", "", "run `command` and use its output as the new password")
+	flags.StringVar(&keyOptions.Username, "user", "", "the user name for the new key (default: current user)")
+	flags.StringVar(&keyOptions.Hostname, "host", "", "the host name for the new key (default: current host)")
+	flags.StringVar(&keyOptions.Comment, "comment", "", "a comment describing the new key")
+	flags.StringVar(&keyOptions.Expires, "expires", "", "do not accept the new key after `date` (default: never expires)")
+	flags.BoolVar(&keyOptions.WriteOnly, "write-only", false, "create a key which can only be used to add new data")
+	flags.BoolVarP(&keyOptions.Force, "force", "f", false, "remove the key even if it is currently used to access the repository")
+	flags.BoolVar(&keyOptions.ReKDF, "rekdf", false, "keep the password and only derive the key again with new KDF parameters (passwd only)")
+	initKDFOptions(flags, &keyOptions.kdfOptions)
 }
 
-func listKeys(ctx context.Context, s *repository.Repository) error {
-	tab := NewTable()
-	tab.Header = fmt.Sprintf(" %-10s  %-10s  %-10s  %s", "ID", "User", "Host", "Created")
-	tab.RowFormat = "%s%-10s  %-10s  %-10s  %s"
+// keyInfo is the JSON representation of a key printed by "key list --json".
+type keyInfo struct {
+	Current   bool       `json:"current"`
+	ID        string     `json:"id"`
+	Username  string     `json:"username"`
+	Hostname  string     `json:"hostname"`
+	WriteOnly bool       `json:"write_only"`
+	KDF       string     `json:"kdf"`
+	Comment   string     `json:"comment,omitempty"`
+	Created   time.Time  `json:"created"`
+	Expires   *time.Time `json:"expires,omitempty"`
+}
+
+func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions) error {
+	var keys []keyInfo
 
 	err := s.List(ctx, restic.KeyFile, func(id restic.ID, size int64) error {
 		k, err := repository.LoadKey(ctx, s, id.String())
@@ -47,23 +106,95 @@ func listKeys(ctx context.Context, s *repository.Repository) error {
 			return nil
 		}
 
-		var current string
-		if id.String() == s.KeyName() {
-			current = "*"
-		} else {
-			current = " "
-		}
-		tab.Rows = append(tab.Rows, []interface{}{current, id.Str(),
-			k.Username, k.Hostname, k.Created.Format(TimeFormat)})
+		keys = append(keys, keyInfo{
+			Current:   id.String() == s.KeyName(),
+			ID:        id.String(),
+			Username:  k.Username,
+			Hostname:  k.Hostname,
+			WriteOnly: k.WriteOnly,
+			KDF:       k.KDF,
+			Comment:   k.Comment,
+			Created:   k.Created,
+			Expires:   k.Expires,
+		})
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
+	if gopts.JSON {
+		if keys == nil {
+			keys = []keyInfo{}
+		}
+		return json.NewEncoder(globalOptions.stdout).Encode(keys)
+	}
+
+	tab := NewTable()
+	tab.Header = fmt.Sprintf(" %-10s  %-10s  %-10s  %-10s  %-19s  %-19s  %s", "ID", "User", "Host", "Access", "Created", "Expires", "Comment")
+	tab.RowFormat = "%s%-10s  %-10s  %-10s  %-10s  %-19s  %-19s  %s"
+
+	for _, k := range keys {
+		current := " "
+		if k.Current {
+			current = "*"
+		}
+
+		access := "full"
+		if k.WriteOnly {
+			access = "write-only"
+		}
+
+		var expires string
+		if k.Expires != nil {
+			expires = k.Expires.Format(TimeFormat)
+		}
+
+		id, _ := restic.ParseID(k.ID)
+		tab.Rows = append(tab.Rows, []interface{}{current, id.Str(),
+			k.Username, k.Hostname, access, k.Created.Format(TimeFormat), expires, k.Comment})
+	}
+
 	return tab.Write(globalOptions.stdout)
 }
 
+// newKeyOptions returns the metadata for a new key. Values which are not
+// given in opts are taken from base.
+func newKeyOptions(opts KeyOptions, base repository.KeyOptions) (repository.KeyOptions, error) {
+	if opts.Username != "" {
+		base.Username = opts.Username
+	}
+
+	if opts.Hostname != "" {
+		base.Hostname = opts.Hostname
+	}
+
+	if opts.Comment != "" {
+		base.Comment = opts.Comment
+	}
+
+	if opts.Expires != "" {
+		expires, err := parseTime(opts.Expires)
+		if err != nil {
+			return repository.KeyOptions{}, err
+		}
+
+		if expires.Before(time.Now()) {
+			return repository.KeyOptions{}, errors.Fatalf("expiry date %v is in the past", expires.Format(TimeFormat))
+		}
+
+		base.Expires = expires
+	}
+
+	kdf, err := opts.kdfOptions.params()
+	if err != nil {
+		return repository.KeyOptions{}, err
+	}
+	base.KDF = kdf
+
+	return base, nil
+}
+
 // testKeyNewPassword is used to set a new password during integration testing.
 var testKeyNewPassword string
 
@@ -72,10 +203,18 @@ func getNewPassword(gopts GlobalOptions) (string, error) {
 		return testKeyNewPassword, nil
 	}
 
+	if newPasswordFile != "" && newPasswordCommand != "" {
+		return "", errors.Fatal("--new-password-file and --new-password-command are mutually exclusive")
+	}
+
 	if newPasswordFile != "" {
 		return loadPasswordFromFile(newPasswordFile)
 	}
 
+	if newPasswordCommand != "" {
+		return readPasswordCommand(newPasswordCommand)
+	}
+
 	// Since we already have an open repository, temporary remove the password
 	// to prompt the user for the passwd.
 	newopts := gopts
@@ -86,13 +225,25 @@ func getNewPassword(gopts GlobalOptions) (string, error) {
 		"enter password again: ")
 }
 
-func addKey(gopts GlobalOptions, repo *repository.Repository) error {
+func addKey(opts KeyOptions, gopts GlobalOptions, repo *repository.Repository) error {
+	meta, err := newKeyOptions(opts, repository.KeyOptions{})
+	if err != nil {
+		return err
+	}
+
+	if opts.WriteOnly {
+		if repo.Config().Version < 4 {
+			return errors.Fatal("write-only keys require repository version 4, use the migration \"upgrade_repo_v4\" to upgrade the repository")
+		}
+		meta.WriteOnly = true
+	}
+
 	pw, err := getNewPassword(gopts)
 	if err != nil {
 		return err
 	}
 
-	id, err := repository.AddKey(gopts.ctx, repo, pw, repo.Key())
+	id, err := repository.AddKey(gopts.ctx, repo, pw, meta, repo.Key())
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
@@ -102,9 +253,24 @@ func addKey(gopts GlobalOptions, repo *repository.Repository) error {
 	return nil
 }
 
-func deleteKey(ctx context.Context, repo *repository.Repository, name string) error {
+func deleteKey(ctx context.Context, repo *repository.Repository, name string, force bool) error {
 	if name == repo.KeyName() {
-		return errors.Fatal("refusing to remove key currently used to access repository")
+		if !force {
+			return errors.Fatal("refusing to remove key currently used to access repository, use --force to remove it anyway")
+		}
+
+		keys := 0
+		err := repo.List(ctx, restic.KeyFile, func(id restic.ID, size int64) error {
+			keys++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if keys <= 1 {
+			return errors.Fatal("refusing to remove the only key of the repository")
+		}
 	}
 
 	h := restic.Handle{Type: restic.KeyFile, Name: name}
@@ -117,13 +283,37 @@ func deleteKey(ctx context.Context, repo *repository.Repository, name string) er
 	return nil
 }
 
-func changePassword(gopts GlobalOptions, repo *repository.Repository) error {
-	pw, err := getNewPassword(gopts)
+func changePassword(opts KeyOptions, gopts GlobalOptions, repo *repository.Repository) error {
+	current, err := repository.LoadKey(gopts.ctx, repo, repo.KeyName())
+	if err != nil {
+		return err
+	}
+
+	// the new key keeps the metadata of the current one
+	base := repository.KeyOptions{
+		Username: current.Username,
+		Hostname: current.Hostname,
+		Comment:  current.Comment,
+	}
+	if current.Expires != nil {
+		base.Expires = *current.Expires
+	}
+
+	meta, err := newKeyOptions(opts, base)
 	if err != nil {
 		return err
 	}
 
-	id, err := repository.AddKey(gopts.ctx, repo, pw, repo.Key())
+	// with --rekdf, only the parameters for the KDF change
+	pw := gopts.password
+	if !opts.ReKDF {
+		pw, err = getNewPassword(gopts)
+		if err != nil {
+			return err
+		}
+	}
+
+	id, err := repository.AddKey(gopts.ctx, repo, pw, meta, repo.Key())
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
@@ -139,14 +329,27 @@ func changePassword(gopts GlobalOptions, repo *repository.Repository) error {
 	return nil
 }
 
-func runKey(gopts GlobalOptions, args []string) error {
+func runKey(opts KeyOptions, gopts GlobalOptions, args []string) error {
 	if len(args) < 1 || (args[0] == "remove" && len(args) != 2) || (args[0] != "remove" && len(args) != 1) {
 		return errors.Fatal("wrong number of arguments")
 	}
 
+	if opts.ReKDF && args[0] != "passwd" {
+		return errors.Fatal("--rekdf can only be used with \"key passwd\"")
+	}
+
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
 
+	// the current password is needed to derive the key again
+	var err error
+	if opts.ReKDF {
+		gopts.password, err = ReadPassword(gopts, "enter password for repository: ")
+		if err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
@@ -160,7 +363,7 @@ func runKey(gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return listKeys(ctx, repo)
+		return listKeys(ctx, repo, gopts)
 	case "add":
 		lock, err := lockRepo(repo)
 		defer unlockRepo(lock)
@@ -168,7 +371,7 @@ func runKey(gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return addKey(gopts, repo)
+		return addKey(opts, gopts, repo)
 	case "remove":
 		lock, err := lockRepoExclusive(repo)
 		defer unlockRepo(lock)
@@ -181,7 +384,7 @@ func runKey(gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return deleteKey(gopts.ctx, repo, id)
+		return deleteKey(gopts.ctx, repo, id, opts.Force)
 	case "passwd":
 		lock, err := lockRepoExclusive(repo)
 		defer unlockRepo(lock)
@@ -189,7 +392,7 @@ func runKey(gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return changePassword(gopts, repo)
+		return changePassword(opts, gopts, repo)
 	}
 
 	return nil
@@ -31,7 +31,7 @@ func runList(opts GlobalOptions, args []string) error {
 		return errors.Fatal("type not specified")
 	}
 
-	repo, err := OpenRepository(opts)
+	repo, err := OpenRepositoryWriteOnly(opts)
 	if err != nil {
 		return err
 	}
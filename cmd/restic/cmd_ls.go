@@ -30,6 +30,7 @@ type LsOptions struct {
 	ListLong bool
 	Host     string
 	Tags     restic.TagLists
+	Labels   restic.Labels
 	Paths    []string
 }
 
@@ -43,6 +44,7 @@ func init() {
 
 	flags.StringVarP(&lsOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	flags.Var(&lsOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
+	flags.Var(&lsOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times), when no snapshot ID is given")
 	flags.StringArrayVar(&lsOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
 }
 
@@ -82,7 +84,7 @@ func runLs(opts LsOptions, gopts GlobalOptions, args []string) error {
 
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
-	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Labels, opts.Paths, args) {
 		Verbosef("snapshot %s of %v at %s):\n", sn.ID().Str(), sn.Paths, sn.Time)
 
 		if err = printTree(gopts.ctx, repo, sn.Tree, ""); err != nil {
@@ -1,6 +1,5 @@
-// +build !openbsd
-// +build !solaris
-// +build !windows
+//go:build !openbsd && !solaris && !windows
+// +build !openbsd,!solaris,!windows
 
 package main
 
@@ -57,6 +56,7 @@ type MountOptions struct {
 	AllowOther       bool
 	Host             string
 	Tags             restic.TagLists
+	Labels           restic.Labels
 	Paths            []string
 	SnapshotTemplate string
 }
@@ -73,6 +73,7 @@ func init() {
 
 	mountFlags.StringVarP(&mountOptions.Host, "host", "H", "", `only consider snapshots for this host`)
 	mountFlags.Var(&mountOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
+	mountFlags.Var(&mountOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times)")
 	mountFlags.StringArrayVar(&mountOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`")
 
 	mountFlags.StringVar(&mountOptions.SnapshotTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
@@ -132,6 +133,7 @@ func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 		OwnerIsRoot:      opts.OwnerRoot,
 		Host:             opts.Host,
 		Tags:             opts.Tags,
+		Labels:           opts.Labels,
 		Paths:            opts.Paths,
 		SnapshotTemplate: opts.SnapshotTemplate,
 	}
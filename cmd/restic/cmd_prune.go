@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -11,6 +16,7 @@ import (
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var cmdPrune = &cobra.Command{
@@ -19,15 +25,120 @@ var cmdPrune = &cobra.Command{
 	Long: `
 The "prune" command checks the repository and removes data that is not
 referenced and therefore not needed any more.
+
+Which data is still in use is determined from the snapshots and the index
+files, the pack files are not read for this. Pack files which do not contain
+any used data are deleted. Pack files which are only partially used are
+repacked (the used data is written to new pack files) only when the overall
+amount of unused data in the repository exceeds the limit given by
+--max-unused. Packs with the highest fraction of unused data are repacked
+first. The amount of data which is repacked can be limited with
+--max-repack-size.
+
+With --repack-small, packs which are smaller than 80% of the target pack size
+of the repository are also repacked, even if they contain no unused data. This
+combines the small packs left over by earlier backups, or created before the
+target pack size was increased, into larger ones.
+
+Backups do not lock the repository, so data which has just been saved by a
+concurrent backup may not be referenced by a snapshot yet. Therefore pack
+files are not deleted right away, but only marked for deletion. A later run of
+prune deletes them once the grace period given by --grace-period has passed,
+unless the data they contain is referenced again. With --grace-period 0 the
+pack files are deleted immediately, this must only be used when no backup is
+running.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runPrune(globalOptions)
+		return runPrune(pruneOptions, globalOptions)
 	},
 }
 
+// PruneOptions collects all options for the prune command.
+type PruneOptions struct {
+	DryRun bool
+
+	MaxUnused      string
+	maxUnusedBytes func(used uint64) (unused uint64) // calculates the number of unused bytes after repacking, according to MaxUnused
+
+	MaxRepackSize  string
+	maxRepackBytes uint64
+
+	RepackSmall bool
+
+	// GracePeriod is the time after which packs marked for deletion are
+	// removed, zero removes them immediately
+	GracePeriod time.Duration
+}
+
+var pruneOptions PruneOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdPrune)
+
+	f := cmdPrune.Flags()
+	f.BoolVarP(&pruneOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+	addPruneOptions(f, &pruneOptions)
+}
+
+// addPruneOptions adds the flags which control how much data prune repacks.
+// They are shared with the forget command.
+func addPruneOptions(f *pflag.FlagSet, opts *PruneOptions) {
+	f.StringVar(&opts.MaxUnused, "max-unused", "5%", "tolerate given `limit` of unused data (absolute value in bytes with suffixes k/K, m/M, g/G, t/T, a value in % or the word 'unlimited')")
+	f.StringVar(&opts.MaxRepackSize, "max-repack-size", "", "maximum `size` to repack (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.BoolVar(&opts.RepackSmall, "repack-small", false, "repack packs which are smaller than 80% of the target pack size")
+	f.DurationVar(&opts.GracePeriod, "grace-period", 24*time.Hour, "remove packs marked for deletion only after this `duration`, 0 removes them immediately")
+}
+
+// verifyPruneOptions parses the limits given as strings in opts.
+func verifyPruneOptions(opts *PruneOptions) error {
+	if opts.GracePeriod < 0 {
+		return errors.Fatal("--grace-period must not be negative")
+	}
+
+	opts.maxRepackBytes = math.MaxUint64
+	if len(opts.MaxRepackSize) > 0 {
+		size, err := parseSizeStr(opts.MaxRepackSize)
+		if err != nil {
+			return errors.Fatalf("invalid value for --max-repack-size: %v", err)
+		}
+		opts.maxRepackBytes = uint64(size)
+	}
+
+	maxUnused := strings.TrimSpace(opts.MaxUnused)
+	switch {
+	case maxUnused == "":
+		return errors.Fatal("invalid value for --max-unused: value is empty")
+
+	case maxUnused == "unlimited":
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return math.MaxUint64
+		}
+
+	case strings.HasSuffix(maxUnused, "%"):
+		p, err := strconv.ParseFloat(strings.TrimSuffix(maxUnused, "%"), 64)
+		if err != nil || p < 0 || p >= 100 {
+			return errors.Fatalf("invalid percentage %q passed for --max-unused, it must be between 0%% and 100%% (exclusive)", opts.MaxUnused)
+		}
+
+		// the limit is given relative to the total size of the repository
+		// after pruning, which is the used size plus the remaining unused size
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return uint64(p / (100 - p) * float64(used))
+		}
+
+	default:
+		size, err := parseSizeStr(maxUnused)
+		if err != nil {
+			return errors.Fatalf("invalid value for --max-unused: %v", err)
+		}
+
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return uint64(size)
+		}
+	}
+
+	return nil
 }
 
 func shortenStatus(maxLength int, s string) string {
@@ -70,7 +181,12 @@ func newProgressMax(show bool, max uint64, description string) *restic.Progress
 	return p
 }
 
-func runPrune(gopts GlobalOptions) error {
+func runPrune(opts PruneOptions, gopts GlobalOptions) error {
+	err := verifyPruneOptions(&opts)
+	if err != nil {
+		return err
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
@@ -82,226 +198,608 @@ func runPrune(gopts GlobalOptions) error {
 		return err
 	}
 
-	return pruneRepository(gopts, repo)
+	return pruneRepository(opts, gopts, repo)
 }
 
-func mixedBlobs(list []restic.Blob) bool {
-	var tree, data bool
+// packInfo collects the usage statistics of a single pack file.
+type packInfo struct {
+	usedBlobs   uint
+	unusedBlobs uint
+	usedSize    uint64
+	unusedSize  uint64
+	tpe         restic.BlobType
+	mixed       bool
+}
 
-	for _, pb := range list {
-		switch pb.Type {
-		case restic.TreeBlob:
-			tree = true
-		case restic.DataBlob:
-			data = true
-		}
+// packInfoWithID is used to sort the packs which may be repacked.
+type packInfoWithID struct {
+	ID restic.ID
+	packInfo
+	size  uint64
+	small bool
+}
 
-		if tree && data {
-			return true
-		}
-	}
+// pendingPack is a pack file which has been marked for deletion by a previous
+// run of prune.
+type pendingPack struct {
+	marked time.Time
+	size   int64
+}
 
-	return false
+// pruneStats collects the numbers reported for the prune plan.
+type pruneStats struct {
+	usedBlobs, unusedBlobs uint
+	usedSize, unusedSize   uint64
+
+	// packs which do not contain any used blobs
+	removePacks      uint
+	removeBlobs      uint
+	removeSize       uint64
+	removeUnusedSize uint64
+
+	// packs which are rewritten
+	repackPacks      uint
+	repackBlobs      uint
+	repackSize       uint64
+	repackRemoveSize uint64
+
+	// pack files which are not referenced by the index
+	unrefPacks uint
+	unrefSize  uint64
+
+	// packs marked for deletion by a previous run, which are deleted now,
+	// still wait for the grace period or are used again
+	expiredPacks     uint
+	expiredSize      uint64
+	pendingPacks     uint
+	pendingSize      uint64
+	resurrectedPacks uint
+
+	keepPacks       uint
+	remainingPacks  uint
+	remainingUnused uint64
 }
 
-func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
+func pruneRepository(opts PruneOptions, gopts GlobalOptions, repo restic.Repository) error {
 	ctx := gopts.ctx
 
-	err := repo.LoadIndex(ctx)
+	// only the index files which exist now are replaced by the new index,
+	// index files saved by concurrent backups in the meantime are kept
+	indexFiles := restic.NewIDSet()
+	err := repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
+		indexFiles.Insert(id)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	var stats struct {
-		blobs     int
-		packs     int
-		snapshots int
-		bytes     int64
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
 	}
 
-	Verbosef("counting files in repo\n")
-	err = repo.List(ctx, restic.DataFile, func(restic.ID, int64) error {
-		stats.packs++
-		return nil
-	})
+	deletions, err := restic.LoadAllDeletions(ctx, repo)
 	if err != nil {
 		return err
 	}
 
-	Verbosef("building new index for repo\n")
-
-	bar := newProgressMax(!gopts.Quiet, uint64(stats.packs), "packs")
-	idx, invalidFiles, err := index.New(ctx, repo, restic.NewIDSet(), bar)
+	pending, err := loadPendingPacks(ctx, repo, deletions)
 	if err != nil {
 		return err
 	}
 
-	for _, id := range invalidFiles {
-		Warnf("incomplete pack file (will be removed): %v\n", id)
+	usedBlobs, err := getUsedBlobs(gopts, repo)
+	if err != nil {
+		return err
 	}
 
-	blobs := 0
-	for _, pack := range idx.Packs {
-		stats.bytes += pack.Size
-		blobs += len(pack.Entries)
+	Verbosef("searching used packs...\n")
+
+	indexPacks := make(map[restic.ID]*packInfo)
+	countedBlobs := restic.NewBlobSet()
+	var stats pruneStats
+
+	// collect the usage of all packs from the index, a blob which is stored
+	// more than once is only counted as used in the first pack it is found in
+	countBlob := func(pb restic.PackedBlob) {
+		p, ok := indexPacks[pb.PackID]
+		if !ok {
+			p = &packInfo{tpe: pb.Type}
+			indexPacks[pb.PackID] = p
+		}
+
+		if pb.Type != p.tpe {
+			p.mixed = true
+		}
+
+		h := restic.BlobHandle{ID: pb.ID, Type: pb.Type}
+		size := uint64(pb.Length)
+		if usedBlobs.Has(h) && !countedBlobs.Has(h) {
+			countedBlobs.Insert(h)
+			p.usedBlobs++
+			p.usedSize += size
+			stats.usedBlobs++
+			stats.usedSize += size
+			return
+		}
+
+		p.unusedBlobs++
+		p.unusedSize += size
+		stats.unusedBlobs++
+		stats.unusedSize += size
 	}
-	Verbosef("repository contains %v packs (%v blobs) with %v\n",
-		len(idx.Packs), blobs, formatBytes(uint64(stats.bytes)))
 
-	blobCount := make(map[restic.BlobHandle]int)
-	duplicateBlobs := 0
-	duplicateBytes := 0
+	// blobs in packs marked for deletion are only counted as used if they
+	// are not contained in any other pack
+	var pendingBlobs []restic.PackedBlob
+	for pb := range repo.Index().Each(ctx) {
+		if _, ok := pending[pb.PackID]; ok {
+			pendingBlobs = append(pendingBlobs, pb)
+			continue
+		}
+		countBlob(pb)
+	}
 
-	// find duplicate blobs
-	for _, p := range idx.Packs {
-		for _, entry := range p.Entries {
-			stats.blobs++
-			h := restic.BlobHandle{ID: entry.ID, Type: entry.Type}
-			blobCount[h]++
+	for _, pb := range pendingBlobs {
+		countBlob(pb)
+	}
 
-			if blobCount[h] > 1 {
-				duplicateBlobs++
-				duplicateBytes += int(entry.Length)
+	if len(countedBlobs) != len(usedBlobs) {
+		for h := range usedBlobs {
+			if !countedBlobs.Has(h) {
+				Warnf("used blob %v not found in the index\n", h)
 			}
 		}
+		return errors.Fatal("some used blobs are missing from the index, please run 'restic rebuild-index' and 'restic check'")
 	}
 
-	Verbosef("processed %d blobs: %d duplicate blobs, %v duplicate\n",
-		stats.blobs, duplicateBlobs, formatBytes(uint64(duplicateBytes)))
-	Verbosef("load all snapshots\n")
+	Verbosef("collecting packs for deletion and repacking\n")
 
-	// find referenced blobs
-	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
+	removePacks := restic.NewIDSet()
+	repackPacks := restic.NewIDSet()
+	var repackCandidates []packInfoWithID
+
+	// packs marked for deletion which are deleted now, still wait for the
+	// grace period or are referenced again and must be added to the index
+	expiredPacks := restic.NewIDSet()
+	pendingPacks := restic.NewIDSet()
+	resurrectedPacks := restic.NewIDSet()
+
+	// packs smaller than this are considered too small with --repack-small
+	smallPackSize := uint64(repo.PackSize()) * 8 / 10
+	smallPacks := 0
+
+	now := time.Now()
+	err = repo.List(ctx, restic.DataFile, func(id restic.ID, packSize int64) error {
+		p, ok := indexPacks[id]
+		delete(indexPacks, id)
+
+		if pp, isPending := pending[id]; isPending {
+			if ok && p.usedBlobs > 0 {
+				// data in the pack is referenced by a snapshot saved after
+				// it was marked for deletion, so it is kept
+				stats.resurrectedPacks++
+				resurrectedPacks.Insert(id)
+			} else {
+				if ok {
+					stats.unusedBlobs -= p.unusedBlobs
+					stats.unusedSize -= p.unusedSize
+				}
+
+				if now.Sub(pp.marked) >= opts.GracePeriod {
+					stats.expiredPacks++
+					stats.expiredSize += uint64(packSize)
+					expiredPacks.Insert(id)
+				} else {
+					stats.pendingPacks++
+					stats.pendingSize += uint64(packSize)
+					pendingPacks.Insert(id)
+				}
+				return nil
+			}
+		}
+
+		if !ok {
+			// pack files which are not referenced by the index are removed
+			stats.unrefPacks++
+			stats.unrefSize += uint64(packSize)
+			removePacks.Insert(id)
+			return nil
+		}
+
+		small := opts.RepackSmall && uint64(packSize) < smallPackSize
+
+		switch {
+		case p.usedBlobs == 0:
+			stats.removePacks++
+			stats.removeBlobs += p.unusedBlobs
+			stats.removeSize += uint64(packSize)
+			stats.removeUnusedSize += p.unusedSize
+			removePacks.Insert(id)
+		case p.unusedBlobs == 0 && !p.mixed && !small:
+			stats.keepPacks++
+		default:
+			if small {
+				smallPacks++
+			}
+			repackCandidates = append(repackCandidates, packInfoWithID{ID: id, packInfo: *p, size: uint64(packSize), small: small})
+		}
+
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	stats.snapshots = len(snapshots)
+	if len(indexPacks) != 0 {
+		for id := range indexPacks {
+			Warnf("pack %v is referenced by the index but missing in the repository\n", id.Str())
+		}
+		return errors.Fatal("packs from the index are missing in the repository, please run 'restic rebuild-index'")
+	}
 
-	Verbosef("find data that is still in use for %d snapshots\n", stats.snapshots)
+	// packs with mixed blob types are repacked first, then the packs with the
+	// highest fraction of unused data
+	sort.Slice(repackCandidates, func(i, j int) bool {
+		pi, pj := repackCandidates[i], repackCandidates[j]
+		if pi.mixed != pj.mixed {
+			return pi.mixed
+		}
+		return float64(pi.unusedSize)/float64(pi.usedSize+pi.unusedSize) >
+			float64(pj.unusedSize)/float64(pj.usedSize+pj.unusedSize)
+	})
 
-	usedBlobs := restic.NewBlobSet()
-	seenBlobs := restic.NewBlobSet()
+	// unused data in packs which are deleted completely does not count
+	// towards the limit
+	maxUnused := opts.maxUnusedBytes(stats.usedSize)
+	remainingUnused := stats.unusedSize - stats.removeUnusedSize
+
+	for _, p := range repackCandidates {
+		// a single small pack is kept, repacking it would only create
+		// another small pack
+		repackSmall := p.small && smallPacks > 1
+
+		switch {
+		case stats.repackSize+p.size > opts.maxRepackBytes:
+			stats.keepPacks++
+		case !p.mixed && !repackSmall && remainingUnused <= maxUnused:
+			stats.keepPacks++
+		default:
+			repackPacks.Insert(p.ID)
+			stats.repackPacks++
+			stats.repackBlobs += p.usedBlobs
+			stats.repackSize += p.size
+			stats.removeBlobs += p.unusedBlobs
+			stats.repackRemoveSize += p.unusedSize
+			remainingUnused -= p.unusedSize
+		}
+	}
 
-	bar = newProgressMax(!gopts.Quiet, uint64(len(snapshots)), "snapshots")
-	bar.Start()
-	for _, sn := range snapshots {
-		debug.Log("process snapshot %v", sn.ID())
+	stats.remainingUnused = remainingUnused
+	stats.remainingPacks = stats.keepPacks + stats.repackPacks
 
-		err = restic.FindUsedBlobs(ctx, repo, *sn.Tree, usedBlobs, seenBlobs)
+	printPruneStats(stats, maxUnused, opts.GracePeriod)
+
+	if opts.DryRun {
+		Verbosef("\nwould remove %d packs and repack %d packs, no changes were made (dry run)\n",
+			len(removePacks), len(repackPacks))
+		return nil
+	}
+
+	if len(removePacks) == 0 && len(repackPacks) == 0 && len(expiredPacks) == 0 && len(resurrectedPacks) == 0 {
+		Verbosef("nothing to do\n")
+		return nil
+	}
+
+	if len(repackPacks) != 0 {
+		repackKeep := getRepackKeep(ctx, repo, usedBlobs, repackPacks, removePacks)
+
+		Verbosef("repacking packs\n")
+		bar := newProgressMax(!gopts.Quiet, uint64(len(repackPacks)), "packs repacked")
+		bar.Start()
+		_, err := repository.Repack(ctx, repo, repackPacks, repackKeep, bar)
+		bar.Done()
 		if err != nil {
-			if repo.Backend().IsNotExist(err) {
-				return errors.Fatal("unable to load a tree from the repo: " + err.Error())
-			}
+			return errors.Fatalf("%s", err)
+		}
 
+		removePacks.Merge(repackPacks)
+	}
+
+	if len(removePacks) != 0 || len(resurrectedPacks) != 0 {
+		ignorePacks := restic.NewIDSet()
+		ignorePacks.Merge(removePacks)
+		ignorePacks.Merge(expiredPacks)
+		ignorePacks.Merge(pendingPacks)
+
+		if err = rewriteIndex(ctx, repo, indexFiles, ignorePacks); err != nil {
 			return err
 		}
-
-		debug.Log("processed snapshot %v", sn.ID())
-		bar.Report(restic.Stat{Blobs: 1})
 	}
-	bar.Done()
 
-	if len(usedBlobs) > stats.blobs {
-		return errors.Fatalf("number of used blobs is larger than number of available blobs!\n" +
-			"Please report this error (along with the output of the 'prune' run) at\n" +
-			"https://github.com/restic/restic/issues/new")
+	// without a grace period, packs are deleted right away and not marked
+	markPacks := restic.NewIDSet()
+	if opts.GracePeriod == 0 {
+		expiredPacks.Merge(removePacks)
+	} else {
+		pendingPacks.Merge(removePacks)
+		markPacks = removePacks
 	}
 
-	Verbosef("found %d of %d data blobs still in use, removing %d blobs\n",
-		len(usedBlobs), stats.blobs, stats.blobs-len(usedBlobs))
+	if err = updateDeletions(ctx, repo, deletions, pendingPacks, markPacks, now); err != nil {
+		return err
+	}
 
-	// find packs that need a rewrite
-	rewritePacks := restic.NewIDSet()
-	for _, pack := range idx.Packs {
-		if mixedBlobs(pack.Entries) {
-			rewritePacks.Insert(pack.ID)
-			continue
-		}
+	deletePacks(gopts, repo, expiredPacks)
 
-		for _, blob := range pack.Entries {
-			h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
-			if !usedBlobs.Has(h) {
-				rewritePacks.Insert(pack.ID)
-				continue
-			}
+	Verbosef("done\n")
+	return nil
+}
 
-			if blobCount[h] > 1 {
-				rewritePacks.Insert(pack.ID)
+// loadPendingPacks returns the packs which have been marked for deletion and
+// are neither contained in the index nor deleted yet. The blobs stored in
+// these packs are added to the in-memory index, so that data which has been
+// referenced by new snapshots in the meantime is found.
+func loadPendingPacks(ctx context.Context, repo restic.Repository, deletions map[restic.ID]*restic.Deletion) (map[restic.ID]pendingPack, error) {
+	marked := make(map[restic.ID]time.Time)
+	for _, d := range deletions {
+		for _, id := range d.Packs {
+			// use the most recent mark for packs which were marked twice
+			if t, ok := marked[id]; !ok || d.Time.After(t) {
+				marked[id] = d.Time
 			}
 		}
 	}
 
-	removeBytes := duplicateBytes
+	if len(marked) == 0 {
+		return nil, nil
+	}
 
-	// find packs that are unneeded
-	removePacks := restic.NewIDSet()
+	Verbosef("loading %d packs marked for deletion\n", len(marked))
 
-	Verbosef("will remove %d invalid files\n", len(invalidFiles))
-	for _, id := range invalidFiles {
-		removePacks.Insert(id)
+	// a mark is invalid for packs which are contained in the index, e.g.
+	// because a backup saved its index after the pack was marked
+	indexed := restic.NewIDSet()
+	for pb := range repo.Index().Each(ctx) {
+		indexed.Insert(pb.PackID)
 	}
 
-	for packID, p := range idx.Packs {
+	pending := make(map[restic.ID]pendingPack)
+	idx := repository.NewIndex()
+	err := repo.List(ctx, restic.DataFile, func(id restic.ID, size int64) error {
+		t, ok := marked[id]
+		if !ok || indexed.Has(id) {
+			return nil
+		}
 
-		hasActiveBlob := false
-		for _, blob := range p.Entries {
-			h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
-			if usedBlobs.Has(h) {
-				hasActiveBlob = true
-				continue
-			}
+		pending[id] = pendingPack{marked: t, size: size}
 
-			removeBytes += int(blob.Length)
+		blobs, _, err := repo.ListPack(ctx, id, size)
+		if err != nil {
+			Warnf("unable to list the contents of pack %v: %v\n", id.Str(), err)
+			return nil
 		}
 
-		if hasActiveBlob {
+		for _, blob := range blobs {
+			idx.Store(restic.PackedBlob{Blob: blob, PackID: id})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	repo.Index().(*repository.MasterIndex).Insert(idx)
+
+	return pending, nil
+}
+
+// updateDeletions saves a new deletion mark for the packs in markPacks and
+// removes all packs which are not in pendingPacks from the existing marks.
+func updateDeletions(ctx context.Context, repo restic.Repository, deletions map[restic.ID]*restic.Deletion, pendingPacks, markPacks restic.IDSet, now time.Time) error {
+	if len(markPacks) != 0 {
+		id, err := repo.SaveJSONUnpacked(ctx, restic.DeletionFile, restic.NewDeletion(markPacks, now))
+		if err != nil {
+			return errors.Fatalf("unable to save deletion mark: %v", err)
+		}
+		Verbosef("marked %d packs for deletion in %v\n", len(markPacks), id.Str())
+	}
+
+	for id, d := range deletions {
+		remaining := restic.NewIDSet()
+		for _, packID := range d.Packs {
+			if pendingPacks.Has(packID) && !markPacks.Has(packID) {
+				remaining.Insert(packID)
+			}
+		}
+
+		if len(remaining) == len(d.Packs) {
 			continue
 		}
 
-		removePacks.Insert(packID)
+		if len(remaining) != 0 {
+			_, err := repo.SaveJSONUnpacked(ctx, restic.DeletionFile, restic.NewDeletion(remaining, d.Time))
+			if err != nil {
+				return errors.Fatalf("unable to save deletion mark: %v", err)
+			}
+		}
 
-		if !rewritePacks.Has(packID) {
-			return errors.Fatalf("pack %v is unneeded, but not contained in rewritePacks", packID.Str())
+		h := restic.Handle{Type: restic.DeletionFile, Name: id.String()}
+		if err := repo.Backend().Remove(ctx, h); err != nil {
+			Warnf("unable to remove deletion mark %v: %v\n", id.Str(), err)
 		}
+	}
 
-		rewritePacks.Delete(packID)
+	return nil
+}
+
+// deletePacks removes the pack files and their parity files.
+func deletePacks(gopts GlobalOptions, repo restic.Repository, packs restic.IDSet) {
+	if len(packs) == 0 {
+		return
 	}
 
-	Verbosef("will delete %d packs and rewrite %d packs, this frees %s\n",
-		len(removePacks), len(rewritePacks), formatBytes(uint64(removeBytes)))
+	ctx := gopts.ctx
 
-	var obsoletePacks restic.IDSet
-	if len(rewritePacks) != 0 {
-		bar = newProgressMax(!gopts.Quiet, uint64(len(rewritePacks)), "packs rewritten")
-		bar.Start()
-		obsoletePacks, err = repository.Repack(ctx, repo, rewritePacks, usedBlobs, bar)
+	Verbosef("removing %d old packs\n", len(packs))
+	bar := newProgressMax(!gopts.Quiet, uint64(len(packs)), "packs deleted")
+	bar.Start()
+	for packID := range packs {
+		h := restic.Handle{Type: restic.DataFile, Name: packID.String()}
+		err := repo.Backend().Remove(ctx, h)
 		if err != nil {
-			return err
+			Warnf("unable to remove file %v from the repository\n", packID.Str())
 		}
-		bar.Done()
+
+		if repo.Config().Parity != nil {
+			h = restic.Handle{Type: restic.ParityFile, Name: packID.String()}
+			err = repo.Backend().Remove(ctx, h)
+			if err != nil && !repo.Backend().IsNotExist(err) {
+				Warnf("unable to remove parity file %v from the repository\n", packID.Str())
+			}
+		}
+		bar.Report(restic.Stat{Blobs: 1})
 	}
+	bar.Done()
+}
 
-	removePacks.Merge(obsoletePacks)
+// getUsedBlobs returns the set of all blobs referenced by the snapshots.
+func getUsedBlobs(gopts GlobalOptions, repo restic.Repository) (usedBlobs restic.BlobSet, err error) {
+	ctx := gopts.ctx
 
-	if err = rebuildIndex(ctx, repo, removePacks); err != nil {
-		return err
+	Verbosef("loading all snapshots...\n")
+	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(removePacks) != 0 {
-		bar = newProgressMax(!gopts.Quiet, uint64(len(removePacks)), "packs deleted")
-		bar.Start()
-		for packID := range removePacks {
-			h := restic.Handle{Type: restic.DataFile, Name: packID.String()}
-			err = repo.Backend().Remove(ctx, h)
-			if err != nil {
-				Warnf("unable to remove file %v from the repository\n", packID.Str())
+	Verbosef("finding data that is still in use for %d snapshots\n", len(snapshots))
+
+	usedBlobs = restic.NewBlobSet()
+	seenBlobs := restic.NewBlobSet()
+
+	bar := newProgressMax(!gopts.Quiet, uint64(len(snapshots)), "snapshots")
+	bar.Start()
+	defer bar.Done()
+	for _, sn := range snapshots {
+		debug.Log("process snapshot %v", sn.ID())
+
+		err = restic.FindUsedBlobs(ctx, repo, *sn.Tree, usedBlobs, seenBlobs)
+		if err != nil {
+			if repo.Backend().IsNotExist(err) {
+				return nil, errors.Fatal("unable to load a tree from the repo: " + err.Error())
 			}
-			bar.Report(restic.Stat{Blobs: 1})
+
+			return nil, err
+		}
+
+		debug.Log("processed snapshot %v", sn.ID())
+		bar.Report(restic.Stat{Blobs: 1})
+	}
+
+	return usedBlobs, nil
+}
+
+// getRepackKeep returns the used blobs which must be saved again when the
+// packs in repackPacks are rewritten. Blobs which are also stored in a pack
+// that is kept are not included.
+func getRepackKeep(ctx context.Context, repo restic.Repository, usedBlobs restic.BlobSet, repackPacks, removePacks restic.IDSet) restic.BlobSet {
+	keep := restic.NewBlobSet()
+	for pb := range repo.Index().Each(ctx) {
+		h := restic.BlobHandle{ID: pb.ID, Type: pb.Type}
+		if repackPacks.Has(pb.PackID) && usedBlobs.Has(h) {
+			keep.Insert(h)
+		}
+	}
+
+	for pb := range repo.Index().Each(ctx) {
+		if repackPacks.Has(pb.PackID) || removePacks.Has(pb.PackID) {
+			continue
+		}
+		keep.Delete(restic.BlobHandle{ID: pb.ID, Type: pb.Type})
+	}
+
+	return keep
+}
+
+// rewriteIndex saves new index files which contain all packs known to the
+// in-memory index except for the ones in removePacks. Afterwards the index
+// files in supersedes are removed. Index files which have been added by other
+// processes in the meantime are kept.
+func rewriteIndex(ctx context.Context, repo restic.Repository, supersedes restic.IDSet, removePacks restic.IDSet) error {
+	Verbosef("rebuilding index\n")
+
+	idx, err := index.FromIndex(ctx, repo.Index(), removePacks)
+	if err != nil {
+		return err
+	}
+
+	ids, err := idx.Save(ctx, repo, supersedes.List())
+	if err != nil {
+		return errors.Fatalf("unable to save index, last error was: %v", err)
+	}
+
+	Verbosef("saved new indexes as %v\n", ids)
+	Verbosef("remove %d old index files\n", len(supersedes))
+
+	for id := range supersedes {
+		if err := repo.Backend().Remove(ctx, restic.Handle{
+			Type: restic.IndexFile,
+			Name: id.String(),
+		}); err != nil {
+			Warnf("error removing old index %v: %v\n", id.Str(), err)
 		}
-		bar.Done()
 	}
 
-	Verbosef("done\n")
 	return nil
 }
+
+// printPruneStats prints the plan computed by prune.
+func printPruneStats(stats pruneStats, maxUnused uint64, gracePeriod time.Duration) {
+	totalBlobs := stats.usedBlobs + stats.unusedBlobs
+	totalSize := stats.usedSize + stats.unusedSize
+
+	Verbosef("\n")
+	Verbosef("used:         %10d blobs / %s\n", stats.usedBlobs, formatBytes(stats.usedSize))
+	Verbosef("unused:       %10d blobs / %s\n", stats.unusedBlobs, formatBytes(stats.unusedSize))
+	Verbosef("total:        %10d blobs / %s\n", totalBlobs, formatBytes(totalSize))
+	if stats.unrefPacks > 0 {
+		Verbosef("unreferenced: %10d packs / %s\n", stats.unrefPacks, formatBytes(stats.unrefSize))
+	}
+	if stats.resurrectedPacks > 0 {
+		Verbosef("used again:   %10d packs marked for deletion\n", stats.resurrectedPacks)
+	}
+	Verbosef("\n")
+	Verbosef("to repack:    %10d blobs / %s in %d packs\n", stats.repackBlobs, formatBytes(stats.repackSize), stats.repackPacks)
+	Verbosef("to delete:    %10d blobs / %s in %d packs\n", stats.removeBlobs,
+		formatBytes(stats.removeSize+stats.repackRemoveSize+stats.unrefSize), stats.removePacks+stats.unrefPacks)
+	if gracePeriod > 0 && stats.removePacks+stats.unrefPacks+stats.repackPacks > 0 {
+		Verbosef("the packs are marked for deletion and removed after %v\n", gracePeriod)
+	}
+	if stats.expiredPacks > 0 {
+		Verbosef("expired:      %10d packs / %s marked for deletion\n", stats.expiredPacks, formatBytes(stats.expiredSize))
+	}
+	if stats.pendingPacks > 0 {
+		Verbosef("pending:      %10d packs / %s marked for deletion\n", stats.pendingPacks, formatBytes(stats.pendingSize))
+	}
+	if gracePeriod > 0 {
+		Verbosef("this frees %s\n", formatBytes(stats.expiredSize))
+	} else {
+		Verbosef("this frees %s\n", formatBytes(stats.removeSize+stats.repackRemoveSize+stats.unrefSize+stats.expiredSize))
+	}
+	Verbosef("\n")
+	Verbosef("remaining:    %10d packs\n", stats.remainingPacks)
+	Verbosef("unused size after prune: %s (%s of total size, limit %s)\n",
+		formatBytes(stats.remainingUnused), formatPercent(stats.remainingUnused, stats.usedSize+stats.remainingUnused),
+		formatLimit(maxUnused, stats.usedSize))
+}
+
+// formatLimit returns the limit for the unused data as a size and, like for
+// --max-unused, relative to the total size after pruning.
+func formatLimit(limit, used uint64) string {
+	if limit == math.MaxUint64 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%s / %s", formatBytes(limit), formatPercent(limit, used+limit))
+}
@@ -45,10 +45,24 @@ func runRebuildIndex(gopts GlobalOptions) error {
 }
 
 func rebuildIndex(ctx context.Context, repo restic.Repository, ignorePacks restic.IDSet) error {
+	Verbosef("finding old index files\n")
+
+	// only the index files which exist before the packs are read are replaced
+	// by the new index, index files saved by concurrent backups in the
+	// meantime are kept
+	var supersedes restic.IDs
+	err := repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
+		supersedes = append(supersedes, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	Verbosef("counting files in repo\n")
 
 	var packs uint64
-	err := repo.List(ctx, restic.DataFile, func(restic.ID, int64) error {
+	err = repo.List(ctx, restic.DataFile, func(restic.ID, int64) error {
 		packs++
 		return nil
 	})
@@ -62,17 +76,6 @@ func rebuildIndex(ctx context.Context, repo restic.Repository, ignorePacks resti
 		return err
 	}
 
-	Verbosef("finding old index files\n")
-
-	var supersedes restic.IDs
-	err = repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
-		supersedes = append(supersedes, id)
-		return nil
-	})
-	if err != nil {
-		return err
-	}
-
 	ids, err := idx.Save(ctx, repo, supersedes)
 	if err != nil {
 		return errors.Fatalf("unable to save index, last error was: %v", err)
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRecover = &cobra.Command{
+	Use:   "recover [flags]",
+	Short: "Recover data from the repository not referenced by snapshots",
+	Long: `
+The "recover" command builds a new snapshot from all directories it can find in
+the repository which are not referenced in an existing snapshot. It can be used
+if, for example, a snapshot has been removed by accident with "forget" or the
+snapshot file of an interrupted backup was never written.
+
+The new snapshot contains one directory for each unreferenced tree, which is
+named after the ID of the tree.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRecover(globalOptions)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdRecover)
+}
+
+func runRecover(gopts GlobalOptions) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRepo(repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	Verbosef("load index files\n")
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	// trees maps a tree ID to whether or not it is referenced by a different
+	// tree. If it is not referenced, we have a root tree.
+	trees := make(map[restic.ID]bool)
+	for blob := range repo.Index().Each(ctx) {
+		if blob.Type == restic.TreeBlob {
+			trees[blob.ID] = false
+		}
+	}
+
+	Verbosef("load %d trees\n", len(trees))
+	bar := newProgressMax(!gopts.Quiet, uint64(len(trees)), "trees loaded")
+	bar.Start()
+	// subtrees are collected separately, the map must not be modified while
+	// iterating over it
+	subtrees := restic.NewIDSet()
+	for id := range trees {
+		tree, err := repo.LoadTree(ctx, id)
+		if err != nil {
+			Warnf("unable to load tree %v: %v\n", id.Str(), err)
+			bar.Report(restic.Stat{Blobs: 1})
+			continue
+		}
+
+		for _, node := range tree.Nodes {
+			if node.Type == "dir" && node.Subtree != nil {
+				subtrees.Insert(*node.Subtree)
+			}
+		}
+		bar.Report(restic.Stat{Blobs: 1})
+	}
+	bar.Done()
+
+	for id := range subtrees {
+		trees[id] = true
+	}
+
+	Verbosef("load snapshots\n")
+	err = repo.List(ctx, restic.SnapshotFile, func(id restic.ID, size int64) error {
+		sn, err := restic.LoadSnapshot(ctx, repo, id)
+		if err != nil {
+			Warnf("unable to load snapshot %v: %v\n", id.Str(), err)
+			return nil
+		}
+
+		// all other trees reachable from the snapshot are referenced by a
+		// tree, so only the root tree needs to be marked
+		if sn.Tree != nil {
+			trees[*sn.Tree] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var roots restic.IDs
+	for id, referenced := range trees {
+		if !referenced {
+			roots = append(roots, id)
+		}
+	}
+
+	Verbosef("done, found %d unreferenced root trees\n", len(roots))
+	if len(roots) == 0 {
+		Verbosef("no snapshot to write.\n")
+		return nil
+	}
+
+	now := time.Now()
+	tree := restic.NewTree()
+	for _, id := range roots {
+		subtreeID := id
+		node := &restic.Node{
+			Type:       "dir",
+			Name:       id.Str(),
+			Mode:       os.ModeDir | 0755,
+			ModTime:    now,
+			AccessTime: now,
+			ChangeTime: now,
+			Subtree:    &subtreeID,
+		}
+
+		if err = tree.Insert(node); err != nil {
+			return err
+		}
+	}
+
+	treeID, err := repo.SaveTree(ctx, tree)
+	if err != nil {
+		return errors.Fatalf("unable to save new tree to the repo: %v", err)
+	}
+
+	if err = repo.Flush(ctx); err != nil {
+		return errors.Fatalf("unable to save blobs to the repo: %v", err)
+	}
+
+	if err = repo.SaveIndex(ctx); err != nil {
+		return errors.Fatalf("unable to save new index to the repo: %v", err)
+	}
+
+	sn, err := restic.NewSnapshot([]string{"/recover"}, []string{"recovered"}, hostname, now)
+	if err != nil {
+		return errors.Fatalf("unable to save snapshot: %v", err)
+	}
+	sn.Tree = &treeID
+
+	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	if err != nil {
+		return errors.Fatalf("unable to save snapshot: %v", err)
+	}
+
+	Printf("saved new snapshot %v\n", id.Str())
+	return nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairSnapshots = &cobra.Command{
+	Use:   "snapshots [flags] [snapshot-ID ...]",
+	Short: "Repair snapshots which reference missing data",
+	Long: `
+The "repair snapshots" command walks the trees of the given snapshots and
+repairs all references to data which is not contained in the repository:
+
+* Files with missing content are truncated before the first missing blob.
+* Directories whose tree is missing are replaced by empty directories.
+
+For each snapshot which needs to be repaired, a new snapshot with the tag
+"repaired" is saved. The old snapshot is kept unless --forget is given.
+
+Which data is missing is determined from the index, so if pack files were
+lost, run "restic rebuild-index" first. Before running this command, make
+sure that the data cannot be restored from another source, since it is
+removed from the snapshots permanently.
+
+When no snapshot-ID is given, all snapshots matching the host, tag and path
+filter criteria are repaired.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairSnapshots(repairSnapshotsOptions, globalOptions, args)
+	},
+}
+
+// RepairSnapshotsOptions collects all options for the repair snapshots
+// command.
+type RepairSnapshotsOptions struct {
+	DryRun bool
+	Forget bool
+
+	Host   string
+	Tags   restic.TagLists
+	Labels restic.Labels
+	Paths  []string
+}
+
+var repairSnapshotsOptions RepairSnapshotsOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairSnapshots)
+
+	f := cmdRepairSnapshots.Flags()
+	f.BoolVarP(&repairSnapshotsOptions.DryRun, "dry-run", "n", false, "do not do anything, just print what would be done")
+	f.BoolVarP(&repairSnapshotsOptions.Forget, "forget", "", false, "remove the original snapshots after they have been repaired")
+	f.StringVarP(&repairSnapshotsOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
+	f.Var(&repairSnapshotsOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
+	f.Var(&repairSnapshotsOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times), when no snapshot ID is given")
+	f.StringArrayVar(&repairSnapshotsOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+}
+
+// treeRepairer rewrites trees so that they only reference data contained in
+// the repository. Rewritten trees are cached, so that trees shared between
+// snapshots are only processed once.
+type treeRepairer struct {
+	repo   restic.Repository
+	dryRun bool
+
+	// rewritten maps the ID of a processed tree to the ID of the repaired tree
+	rewritten map[restic.ID]restic.ID
+
+	// emptyTree is the ID of an empty tree, it is saved on first use
+	emptyTree *restic.ID
+}
+
+func newTreeRepairer(repo restic.Repository, dryRun bool) *treeRepairer {
+	return &treeRepairer{
+		repo:      repo,
+		dryRun:    dryRun,
+		rewritten: make(map[restic.ID]restic.ID),
+	}
+}
+
+// saveTree saves tree unless running in dry-run mode.
+func (r *treeRepairer) saveTree(ctx context.Context, tree *restic.Tree) (restic.ID, error) {
+	if r.dryRun {
+		return restic.ID{}, nil
+	}
+	return r.repo.SaveTree(ctx, tree)
+}
+
+// getEmptyTree returns the ID of an empty tree.
+func (r *treeRepairer) getEmptyTree(ctx context.Context) (restic.ID, error) {
+	if r.emptyTree != nil {
+		return *r.emptyTree, nil
+	}
+
+	id, err := r.saveTree(ctx, restic.NewTree())
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	r.emptyTree = &id
+	return id, nil
+}
+
+// repairTree returns the ID of the repaired version of the tree with the given
+// id, which is located at path in the snapshot. If nothing needed to be
+// changed, the original ID is returned.
+func (r *treeRepairer) repairTree(ctx context.Context, path string, id restic.ID) (restic.ID, error) {
+	if newID, ok := r.rewritten[id]; ok {
+		return newID, nil
+	}
+
+	var tree *restic.Tree
+	var err error
+	if r.repo.Index().Has(id, restic.TreeBlob) {
+		tree, err = r.repo.LoadTree(ctx, id)
+	} else {
+		err = errors.New("tree not found in the index")
+	}
+
+	if err != nil {
+		Printf("  dir %q: replaced with empty directory, tree %v cannot be loaded: %v\n", path, id.Str(), err)
+		emptyID, err := r.getEmptyTree(ctx)
+		if err != nil {
+			return restic.ID{}, err
+		}
+
+		r.rewritten[id] = emptyID
+		return emptyID, nil
+	}
+
+	changed := false
+	newTree := restic.NewTree()
+	for _, node := range tree.Nodes {
+		nodePath := path + "/" + node.Name
+
+		switch node.Type {
+		case "file":
+			if r.repairFile(nodePath, node) {
+				changed = true
+			}
+		case "dir":
+			var subtreeID restic.ID
+			if node.Subtree == nil {
+				Printf("  dir %q: subtree is missing, replaced with empty directory\n", nodePath)
+				subtreeID, err = r.getEmptyTree(ctx)
+			} else {
+				subtreeID, err = r.repairTree(ctx, nodePath, *node.Subtree)
+			}
+			if err != nil {
+				return restic.ID{}, err
+			}
+
+			if node.Subtree == nil || !subtreeID.Equal(*node.Subtree) {
+				node.Subtree = &subtreeID
+				changed = true
+			}
+		}
+
+		err = newTree.Insert(node)
+		if err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	if !changed {
+		r.rewritten[id] = id
+		return id, nil
+	}
+
+	newID, err := r.saveTree(ctx, newTree)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	debug.Log("tree %v repaired, new ID %v", id, newID)
+	r.rewritten[id] = newID
+	return newID, nil
+}
+
+// repairFile truncates the file before the first content blob which is not
+// contained in the repository. It returns true if node has been modified.
+func (r *treeRepairer) repairFile(path string, node *restic.Node) bool {
+	var size uint64
+	for i, blobID := range node.Content {
+		blobSize, found := r.repo.LookupBlobSize(blobID, restic.DataBlob)
+		if !found {
+			Printf("  file %q: truncated from %v to %v, blob %v is missing\n",
+				path, formatBytes(node.Size), formatBytes(size), blobID.Str())
+			node.Content = node.Content[:i]
+			node.Size = size
+			return true
+		}
+		size += uint64(blobSize)
+	}
+
+	return false
+}
+
+// repairSnapshot repairs the tree of sn and saves a new snapshot if anything
+// was changed. It returns true if the snapshot needed to be repaired.
+func repairSnapshot(ctx context.Context, repo restic.Repository, r *treeRepairer, sn *restic.Snapshot, forget bool) (bool, error) {
+	if sn.Tree == nil {
+		return false, errors.Errorf("snapshot %v has no tree", sn.ID().Str())
+	}
+
+	newTree, err := r.repairTree(ctx, "", *sn.Tree)
+	if err != nil {
+		return false, err
+	}
+
+	// in dry-run mode, modified trees are not saved and get the null ID
+	if newTree.Equal(*sn.Tree) {
+		return false, nil
+	}
+
+	if r.dryRun {
+		Printf("would save repaired snapshot\n")
+		return true, nil
+	}
+
+	if err = repo.Flush(ctx); err != nil {
+		return false, err
+	}
+	if err = repo.SaveIndex(ctx); err != nil {
+		return false, err
+	}
+
+	oldID := sn.ID()
+
+	// retain the original snapshot ID over all modifications
+	if sn.Original == nil {
+		sn.Original = oldID
+	}
+	sn.Tree = &newTree
+	sn.AddTags([]string{"repaired"})
+
+	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	if err != nil {
+		return false, err
+	}
+	Printf("saved repaired snapshot %v\n", id.Str())
+
+	if forget {
+		err = restic.RemoveSnapshot(ctx, repo, sn)
+		switch {
+		case err == restic.ErrSnapshotProtected:
+			Warnf("old snapshot %v is protected and has not been removed\n", oldID.Str())
+		case err != nil:
+			return false, err
+		default:
+			Printf("removed old snapshot %v\n", oldID.Str())
+		}
+	}
+
+	return true, nil
+}
+
+func runRepairSnapshots(opts RepairSnapshotsOptions, gopts GlobalOptions, args []string) error {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		if opts.Forget && !opts.DryRun {
+			Verbosef("create exclusive lock for repository\n")
+			lock, err = lockRepoExclusive(repo)
+		} else {
+			lock, err = lockRepo(repo)
+		}
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	r := newTreeRepairer(repo, opts.DryRun)
+	repaired := 0
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Labels, opts.Paths, args) {
+		Printf("snapshot %v of %v at %s\n", sn.ID().Str(), sn.Paths, sn.Time)
+		changed, err := repairSnapshot(ctx, repo, r, sn, opts.Forget)
+		if err != nil {
+			return errors.Fatalf("unable to repair snapshot %v: %v", sn.ID().Str(), err)
+		}
+
+		if changed {
+			repaired++
+		} else {
+			Printf("  no changes needed\n")
+		}
+	}
+
+	switch {
+	case repaired == 0:
+		Verbosef("no snapshots were modified\n")
+	case opts.DryRun:
+		Verbosef("would repair %d snapshots\n", repaired)
+	default:
+		Verbosef("repaired %d snapshots\n", repaired)
+	}
+
+	return nil
+}
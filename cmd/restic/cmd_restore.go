@@ -27,12 +27,17 @@ repository.
 
 // RestoreOptions collects all options for the restore command.
 type RestoreOptions struct {
-	Exclude []string
-	Include []string
-	Target  string
-	Host    string
-	Paths   []string
-	Tags    restic.TagLists
+	Exclude            []string
+	InsensitiveExclude []string
+	excludeOrder       []patternKind
+	Include            []string
+	InsensitiveInclude []string
+	includeOrder       []patternKind
+	Target             string
+	Host               string
+	Paths              []string
+	Tags               restic.TagLists
+	Labels             restic.Labels
 }
 
 var restoreOptions RestoreOptions
@@ -41,12 +46,15 @@ func init() {
 	cmdRoot.AddCommand(cmdRestore)
 
 	flags := cmdRestore.Flags()
-	flags.StringArrayVarP(&restoreOptions.Exclude, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
-	flags.StringArrayVarP(&restoreOptions.Include, "include", "i", nil, "include a `pattern`, exclude everything else (can be specified multiple times)")
+	flags.VarP(patternFlag{&restoreOptions.Exclude, &restoreOptions.excludeOrder, patternSensitive}, "exclude", "e", "exclude a `pattern` (can be specified multiple times)")
+	flags.Var(patternFlag{&restoreOptions.InsensitiveExclude, &restoreOptions.excludeOrder, patternInsensitive}, "iexclude", "same as --exclude `pattern` but ignores the casing of filenames")
+	flags.VarP(patternFlag{&restoreOptions.Include, &restoreOptions.includeOrder, patternSensitive}, "include", "i", "include a `pattern`, exclude everything else (can be specified multiple times)")
+	flags.Var(patternFlag{&restoreOptions.InsensitiveInclude, &restoreOptions.includeOrder, patternInsensitive}, "iinclude", "same as --include `pattern` but ignores the casing of filenames")
 	flags.StringVarP(&restoreOptions.Target, "target", "t", "", "directory to extract data to")
 
 	flags.StringVarP(&restoreOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
 	flags.Var(&restoreOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
+	flags.Var(&restoreOptions.Labels, "label", "only consider snapshots which have the label `key=value` for snapshot ID \"latest\" (can be specified multiple times)")
 	flags.StringArrayVar(&restoreOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
 }
 
@@ -64,7 +72,10 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("please specify a directory to restore to (--target)")
 	}
 
-	if len(opts.Exclude) > 0 && len(opts.Include) > 0 {
+	hasExcludes := len(opts.Exclude) > 0 || len(opts.InsensitiveExclude) > 0
+	hasIncludes := len(opts.Include) > 0 || len(opts.InsensitiveInclude) > 0
+
+	if hasExcludes && hasIncludes {
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
@@ -93,7 +104,7 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 	var id restic.ID
 
 	if snapshotIDString == "latest" {
-		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Host)
+		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Labels, opts.Host)
 		if err != nil {
 			Exitf(1, "latest snapshot for criteria not found: %v Paths:%v Host:%v", err, opts.Paths, opts.Host)
 		}
@@ -116,8 +127,11 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return nil
 	}
 
+	excludes := collectPatterns(opts.excludeOrder, opts.Exclude, opts.InsensitiveExclude, nil)
+	includes := collectPatterns(opts.includeOrder, opts.Include, opts.InsensitiveInclude, nil)
+
 	selectExcludeFilter := func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
-		matched, _, err := filter.List(opts.Exclude, item)
+		matched, _, err := filter.ListPatterns(excludes, item)
 		if err != nil {
 			Warnf("error for exclude pattern: %v", err)
 		}
@@ -133,7 +147,7 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	selectIncludeFilter := func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
-		matched, childMayMatch, err := filter.List(opts.Include, item)
+		matched, childMayMatch, err := filter.ListPatterns(includes, item)
 		if err != nil {
 			Warnf("error for include pattern: %v", err)
 		}
@@ -144,9 +158,9 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return selectedForRestore, childMayBeSelected
 	}
 
-	if len(opts.Exclude) > 0 {
+	if hasExcludes {
 		res.SelectFilter = selectExcludeFilter
-	} else if len(opts.Include) > 0 {
+	} else if hasIncludes {
 		res.SelectFilter = selectIncludeFilter
 	}
 
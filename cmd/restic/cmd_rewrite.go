@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRewrite = &cobra.Command{
+	Use:   "rewrite [flags] [snapshot-ID ...]",
+	Short: "Rewrite snapshots to exclude unwanted files",
+	Long: `
+The "rewrite" command excludes files from existing snapshots. It creates new
+snapshots containing the same data as the original ones, but without the files
+matching the exclude patterns. The patterns are matched against the path of a
+file within the snapshot, as for the "restore" command. A pattern starting
+with "!" includes files again which were excluded by a previous pattern, a
+pattern for a file whose name starts with "!" must be written as "\!".
+
+The original snapshots are kept unless --forget is given. Please note that the
+excluded data is not removed from the repository until the original snapshots
+are removed and "prune" is run.
+
+When no snapshot-ID is given, all snapshots matching the host, tag and path
+filter criteria are rewritten.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRewrite(rewriteOptions, globalOptions, args)
+	},
+}
+
+// RewriteOptions collects all options for the rewrite command.
+type RewriteOptions struct {
+	Forget bool
+	DryRun bool
+
+	Excludes     []string
+	ExcludeFiles []string
+
+	Host   string
+	Tags   restic.TagLists
+	Labels restic.Labels
+	Paths  []string
+}
+
+var rewriteOptions RewriteOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdRewrite)
+
+	f := cmdRewrite.Flags()
+	f.BoolVarP(&rewriteOptions.Forget, "forget", "", false, "remove the original snapshots after they have been rewritten")
+	f.BoolVarP(&rewriteOptions.DryRun, "dry-run", "n", false, "do not do anything, just print what would be done")
+	f.StringArrayVarP(&rewriteOptions.Excludes, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
+	f.StringArrayVar(&rewriteOptions.ExcludeFiles, "exclude-file", nil, "read exclude patterns from a `file` (can be specified multiple times)")
+
+	f.StringVarP(&rewriteOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
+	f.Var(&rewriteOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
+	f.Var(&rewriteOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times), when no snapshot ID is given")
+	f.StringArrayVar(&rewriteOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+}
+
+// treeRewriter removes all nodes for which excluded returns true from trees.
+// Rewritten trees are cached, so that trees shared between snapshots are only
+// processed once for each location.
+type treeRewriter struct {
+	repo     restic.Repository
+	dryRun   bool
+	excluded func(nodepath string) bool
+
+	// rewritten maps a processed tree to the ID of the new tree
+	rewritten map[rewrittenKey]restic.ID
+}
+
+// rewrittenKey identifies a processed tree. Whether a node is excluded
+// depends on its path, so the same tree at a different location may be
+// rewritten differently.
+type rewrittenKey struct {
+	nodepath string
+	id       restic.ID
+}
+
+// rewriteTree returns the ID of the tree with the given id after removing all
+// excluded nodes. nodepath is the location of the tree within the snapshot.
+// If nothing was excluded, the original ID is returned. In dry-run mode,
+// modified trees are not saved and the null ID is returned for them.
+func (r *treeRewriter) rewriteTree(ctx context.Context, nodepath string, id restic.ID) (restic.ID, error) {
+	key := rewrittenKey{nodepath: nodepath, id: id}
+	if newID, ok := r.rewritten[key]; ok {
+		return newID, nil
+	}
+
+	tree, err := r.repo.LoadTree(ctx, id)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	changed := false
+	newTree := restic.NewTree()
+	for _, node := range tree.Nodes {
+		path := filepath.Join(nodepath, node.Name)
+		if r.excluded(path) {
+			Verbosef("  excluding %s\n", path)
+			changed = true
+			continue
+		}
+
+		if node.Type == "dir" && node.Subtree != nil {
+			subtreeID, err := r.rewriteTree(ctx, path, *node.Subtree)
+			if err != nil {
+				return restic.ID{}, err
+			}
+
+			if !subtreeID.Equal(*node.Subtree) {
+				node.Subtree = &subtreeID
+				changed = true
+			}
+		}
+
+		if err = newTree.Insert(node); err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	newID := id
+	if changed {
+		if !r.dryRun {
+			newID, err = r.repo.SaveTree(ctx, newTree)
+			if err != nil {
+				return restic.ID{}, err
+			}
+		} else {
+			newID = restic.ID{}
+		}
+		debug.Log("tree %v rewritten, new ID %v", id, newID)
+	}
+
+	r.rewritten[key] = newID
+	return newID, nil
+}
+
+// rewriteSnapshot saves a new snapshot without the excluded files if anything
+// needed to be excluded. It returns true if the snapshot was modified.
+func rewriteSnapshot(ctx context.Context, repo restic.Repository, r *treeRewriter, sn *restic.Snapshot, opts RewriteOptions, excludes []string) (bool, error) {
+	if sn.Tree == nil {
+		return false, errors.Errorf("snapshot %v has no tree", sn.ID().Str())
+	}
+
+	newTree, err := r.rewriteTree(ctx, string(filepath.Separator), *sn.Tree)
+	if err != nil {
+		return false, err
+	}
+
+	if newTree.Equal(*sn.Tree) {
+		return false, nil
+	}
+
+	if opts.DryRun {
+		Verbosef("would save new snapshot\n")
+		return true, nil
+	}
+
+	if err = repo.Flush(ctx); err != nil {
+		return false, err
+	}
+	if err = repo.SaveIndex(ctx); err != nil {
+		return false, err
+	}
+
+	oldID := sn.ID()
+
+	// retain the original snapshot ID over all modifications
+	if sn.Original == nil {
+		sn.Original = oldID
+	}
+	sn.Tree = &newTree
+	sn.Excludes = append(sn.Excludes, excludes...)
+
+	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	if err != nil {
+		return false, err
+	}
+	Verbosef("saved new snapshot %v\n", id.Str())
+
+	if opts.Forget {
+		err = restic.RemoveSnapshot(ctx, repo, sn)
+		switch {
+		case err == restic.ErrSnapshotProtected:
+			Warnf("old snapshot %v is protected and has not been removed\n", oldID.Str())
+		case err != nil:
+			return false, err
+		default:
+			Verbosef("removed old snapshot %v\n", oldID.Str())
+		}
+	}
+
+	return true, nil
+}
+
+func runRewrite(opts RewriteOptions, gopts GlobalOptions, args []string) error {
+	excludes := opts.Excludes
+	if len(opts.ExcludeFiles) > 0 {
+		excludes = append(excludes, readExcludePatternsFromFiles(opts.ExcludeFiles)...)
+	}
+
+	if len(excludes) == 0 {
+		return errors.Fatal("Nothing to do: no excludes provided")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		if opts.Forget && !opts.DryRun {
+			Verbosef("create exclusive lock for repository\n")
+			lock, err = lockRepoExclusive(repo)
+		} else {
+			lock, err = lockRepo(repo)
+		}
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	r := &treeRewriter{
+		repo:   repo,
+		dryRun: opts.DryRun,
+		excluded: func(nodepath string) bool {
+			matched, _, err := filter.List(excludes, nodepath)
+			if err != nil {
+				Warnf("error for exclude pattern: %v", err)
+			}
+			return matched
+		},
+		rewritten: make(map[rewrittenKey]restic.ID),
+	}
+
+	changedCount := 0
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Labels, opts.Paths, args) {
+		Verbosef("checking snapshot %s\n", sn)
+		changed, err := rewriteSnapshot(ctx, repo, r, sn, opts, excludes)
+		if err != nil {
+			return errors.Fatalf("unable to rewrite snapshot %v: %v", sn.ID().Str(), err)
+		}
+
+		if changed {
+			changedCount++
+		}
+	}
+
+	switch {
+	case changedCount == 0:
+		Verbosef("no snapshots were modified\n")
+	case opts.DryRun:
+		Verbosef("would modify %d snapshots\n", changedCount)
+	default:
+		Verbosef("modified %d snapshots\n", changedCount)
+	}
+
+	return nil
+}
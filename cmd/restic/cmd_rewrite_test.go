@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// saveTestTree saves a tree with the given nodes, dirs maps the names of
+// directories to their subtrees.
+func saveTestTree(t *testing.T, repo restic.Repository, files []string, dirs map[string]restic.ID) restic.ID {
+	tree := restic.NewTree()
+	for _, name := range files {
+		rtest.OK(t, tree.Insert(&restic.Node{Name: name, Type: "file", Mode: 0600}))
+	}
+	for name, id := range dirs {
+		subtree := id
+		rtest.OK(t, tree.Insert(&restic.Node{Name: name, Type: "dir", Mode: 0700, Subtree: &subtree}))
+	}
+
+	id, err := repo.SaveTree(context.TODO(), tree)
+	rtest.OK(t, err)
+	return id
+}
+
+// treeFiles returns the paths of all files below the tree with the given ID.
+func treeFiles(t *testing.T, repo restic.Repository, prefix string, id restic.ID) []string {
+	tree, err := repo.LoadTree(context.TODO(), id)
+	rtest.OK(t, err)
+
+	var files []string
+	for _, node := range tree.Nodes {
+		p := prefix + "/" + node.Name
+		if node.Type == "dir" {
+			files = append(files, treeFiles(t, repo, p, *node.Subtree)...)
+			continue
+		}
+		files = append(files, p)
+	}
+	return files
+}
+
+func TestRewriteTreeSameSubtreeAtDifferentPaths(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	// the same subtree for .ssh is stored below /home/a and /backup/a
+	ssh := saveTestTree(t, repo, []string{"id_rsa", "known_hosts"}, nil)
+	a := saveTestTree(t, repo, nil, map[string]restic.ID{".ssh": ssh})
+	root := saveTestTree(t, repo, nil, map[string]restic.ID{
+		"backup": saveTestTree(t, repo, nil, map[string]restic.ID{"a": a}),
+		"home":   saveTestTree(t, repo, nil, map[string]restic.ID{"a": a}),
+	})
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	excludes := []string{"/home/*/.ssh/id_rsa"}
+	r := &treeRewriter{
+		repo: repo,
+		excluded: func(nodepath string) bool {
+			matched, _, err := filter.List(excludes, nodepath)
+			rtest.OK(t, err)
+			return matched
+		},
+		rewritten: make(map[rewrittenKey]restic.ID),
+	}
+
+	newRoot, err := r.rewriteTree(context.TODO(), "/", root)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	rtest.Equals(t, []string{
+		"/backup/a/.ssh/id_rsa",
+		"/backup/a/.ssh/known_hosts",
+		"/home/a/.ssh/known_hosts",
+	}, treeFiles(t, repo, "", newRoot))
+}
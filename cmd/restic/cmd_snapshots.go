@@ -28,6 +28,7 @@ The "snapshots" command lists all snapshots stored in the repository.
 type SnapshotOptions struct {
 	Host    string
 	Tags    restic.TagLists
+	Labels  restic.Labels
 	Paths   []string
 	Compact bool
 	Last    bool
@@ -41,6 +42,7 @@ func init() {
 	f := cmdSnapshots.Flags()
 	f.StringVarP(&snapshotOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
 	f.Var(&snapshotOptions.Tags, "tag", "only consider snapshots which include this `taglist` (can be specified multiple times)")
+	f.Var(&snapshotOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times)")
 	f.StringArrayVar(&snapshotOptions.Paths, "path", nil, "only consider snapshots for this `path` (can be specified multiple times)")
 	f.BoolVarP(&snapshotOptions.Compact, "compact", "c", false, "use compact format")
 	f.BoolVar(&snapshotOptions.Last, "last", false, "only show the last snapshot for each host and path")
@@ -64,7 +66,7 @@ func runSnapshots(opts SnapshotOptions, gopts GlobalOptions, args []string) erro
 	defer cancel()
 
 	var list restic.Snapshots
-	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Labels, opts.Paths, args) {
 		list = append(list, sn)
 	}
 
@@ -81,7 +83,7 @@ func runSnapshots(opts SnapshotOptions, gopts GlobalOptions, args []string) erro
 		}
 		return nil
 	}
-	PrintSnapshots(gopts.stdout, list, opts.Compact)
+	PrintSnapshots(gopts.stdout, list, nil, opts.Compact)
 
 	return nil
 }
@@ -122,17 +124,30 @@ func FilterLastSnapshots(list restic.Snapshots) restic.Snapshots {
 	return results
 }
 
-// PrintSnapshots prints a text table of the snapshots in list to stdout.
-func PrintSnapshots(stdout io.Writer, list restic.Snapshots, compact bool) {
+// PrintSnapshots prints a text table of the snapshots in list to stdout. If
+// reasons is not nil, the rules of the expire policy which kept a snapshot are
+// printed in an additional column.
+func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.KeepReason, compact bool) {
+	// keep the reasons a snapshot is being kept in a map, so that it doesn't
+	// get lost when the list of snapshots is sorted
+	keepReasons := make(map[restic.ID]restic.KeepReason, len(reasons))
+	for _, sn := range reasons {
+		keepReasons[*sn.Snapshot.ID()] = sn
+	}
 
 	// always sort the snapshots so that the newer ones are listed last
 	sort.SliceStable(list, func(i, j int) bool {
 		return list[i].Time.Before(list[j].Time)
 	})
 
-	// Determine the max widths for host and tag.
-	maxHost, maxTag := 10, 6
+	// Determine the max widths for host, tag and reason. Protected snapshots
+	// are marked with a star after the ID.
+	maxHost, maxTag, maxReason := 10, 6, 7
+	idWidth, protected := 8, false
 	for _, sn := range list {
+		if sn.Protected {
+			idWidth, protected = 9, true
+		}
 		if len(sn.Hostname) > maxHost {
 			maxHost = len(sn.Hostname)
 		}
@@ -141,15 +156,27 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, compact bool) {
 				maxTag = len(tag)
 			}
 		}
+		for _, reason := range keepReasons[*sn.ID()].Matches {
+			if len(reason) > maxReason {
+				maxReason = len(reason)
+			}
+		}
 	}
 
 	tab := NewTable()
-	if !compact {
-		tab.Header = fmt.Sprintf("%-8s  %-19s  %-*s  %-*s  %-3s %s", "ID", "Date", -maxHost, "Host", -maxTag, "Tags", "", "Directory")
-		tab.RowFormat = fmt.Sprintf("%%-8s  %%-19s  %%%ds  %%%ds  %%-3s %%s", -maxHost, -maxTag)
-	} else {
-		tab.Header = fmt.Sprintf("%-8s  %-19s  %-*s  %-*s", "ID", "Date", -maxHost, "Host", -maxTag, "Tags")
-		tab.RowFormat = fmt.Sprintf("%%-8s  %%-19s  %%%ds  %%s", -maxHost)
+	switch {
+	case !compact && reasons != nil:
+		tab.Header = fmt.Sprintf("%-*s  %-19s  %-*s  %8s  %11s  %-*s  %-*s  %-3s %s", idWidth, "ID", "Date", -maxHost, "Host", "Files", "Added", -maxTag, "Tags", -maxReason, "Reasons", "", "Directory")
+		tab.RowFormat = fmt.Sprintf("%%-%ds  %%-19s  %%%ds  %%8s  %%11s  %%%ds  %%%ds  %%-3s %%s", idWidth, -maxHost, -maxTag, -maxReason)
+	case !compact:
+		tab.Header = fmt.Sprintf("%-*s  %-19s  %-*s  %8s  %11s  %-*s  %-3s %s", idWidth, "ID", "Date", -maxHost, "Host", "Files", "Added", -maxTag, "Tags", "", "Directory")
+		tab.RowFormat = fmt.Sprintf("%%-%ds  %%-19s  %%%ds  %%8s  %%11s  %%%ds  %%-3s %%s", idWidth, -maxHost, -maxTag)
+	case reasons != nil:
+		tab.Header = fmt.Sprintf("%-*s  %-19s  %-*s  %-*s  %s", idWidth, "ID", "Date", -maxHost, "Host", -maxTag, "Tags", "Reasons")
+		tab.RowFormat = fmt.Sprintf("%%-%ds  %%-19s  %%%ds  %%%ds  %%s", idWidth, -maxHost, -maxTag)
+	default:
+		tab.Header = fmt.Sprintf("%-*s  %-19s  %-*s  %-*s", idWidth, "ID", "Date", -maxHost, "Host", -maxTag, "Tags")
+		tab.RowFormat = fmt.Sprintf("%%-%ds  %%-19s  %%%ds  %%s", idWidth, -maxHost)
 	}
 
 	for _, sn := range list {
@@ -157,37 +184,43 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, compact bool) {
 			continue
 		}
 
-		firstTag := ""
-		if len(sn.Tags) > 0 {
-			firstTag = sn.Tags[0]
-		}
-
-		rows := len(sn.Paths)
-		if rows < len(sn.Tags) {
-			rows = len(sn.Tags)
-		}
+		snReasons := keepReasons[*sn.ID()].Matches
 
-		treeElement := "   "
-		if rows != 1 {
-			treeElement = "┌──"
+		id := sn.ID().Str()
+		if sn.Protected {
+			id += "*"
 		}
 
-		if !compact {
-			tab.Rows = append(tab.Rows, []interface{}{sn.ID().Str(), sn.Time.Format(TimeFormat), sn.Hostname, firstTag, treeElement, sn.Paths[0]})
-		} else {
+		if compact {
 			allTags := ""
 			for _, tag := range sn.Tags {
 				allTags += tag + " "
 			}
-			tab.Rows = append(tab.Rows, []interface{}{sn.ID().Str(), sn.Time.Format(TimeFormat), sn.Hostname, allTags})
+
+			row := []interface{}{id, sn.Time.Format(TimeFormat), sn.Hostname, allTags}
+			if reasons != nil {
+				row = append(row, strings.Join(snReasons, ", "))
+			}
+			tab.Rows = append(tab.Rows, row)
 			continue
 		}
 
-		if len(sn.Tags) > rows {
+		rows := len(sn.Paths)
+		if rows < len(sn.Tags) {
 			rows = len(sn.Tags)
 		}
+		if rows < len(snReasons) {
+			rows = len(snReasons)
+		}
 
-		for i := 1; i < rows; i++ {
+		// snapshots created by older versions do not have a summary
+		files, added := "", ""
+		if sn.Summary != nil {
+			files = fmt.Sprintf("%d", sn.Summary.TotalFilesProcessed)
+			added = formatBytes(sn.Summary.DataAdded)
+		}
+
+		for i := 0; i < rows; i++ {
 			path := ""
 			if len(sn.Paths) > i {
 				path = sn.Paths[i]
@@ -198,16 +231,41 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, compact bool) {
 				tag = sn.Tags[i]
 			}
 
-			treeElement := "│"
-			if i == (rows - 1) {
+			reason := ""
+			if len(snReasons) > i {
+				reason = snReasons[i]
+			}
+
+			var treeElement string
+			switch {
+			case rows == 1:
+				treeElement = "   "
+			case i == 0:
+				treeElement = "┌──"
+			case i == rows-1:
 				treeElement = "└──"
+			default:
+				treeElement = "│"
 			}
 
-			tab.Rows = append(tab.Rows, []interface{}{"", "", "", tag, treeElement, path})
+			row := []interface{}{"", "", "", "", ""}
+			if i == 0 {
+				row = []interface{}{id, sn.Time.Format(TimeFormat), sn.Hostname, files, added}
+			}
+			row = append(row, tag)
+			if reasons != nil {
+				row = append(row, reason)
+			}
+			row = append(row, treeElement, path)
+
+			tab.Rows = append(tab.Rows, row)
 		}
 	}
 
 	tab.Footer = fmt.Sprintf("%d snapshots", len(list))
+	if protected {
+		tab.Footer += ", snapshots marked with * are protected"
+	}
 
 	tab.Write(stdout)
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdStats = &cobra.Command{
+	Use:   "stats [flags] [snapshot-ID ...]",
+	Short: "Scan the repository and show basic statistics",
+	Long: `
+The "stats" command walks one or multiple snapshots in a repository and
+accumulates statistics about the data stored therein. It reports on the
+number of unique files and their sizes, according to one of the counting
+modes as given by the --mode flag.
+
+When no snapshot-ID is given, all snapshots matching the host, tag and path
+filter criteria are considered.
+
+The modes are:
+
+* restore-size: (default) Counts the size of the restored files.
+* files-by-contents: Counts total size of files, where a file is
+  considered unique if it has unique contents.
+* raw-data: Counts the size of blobs in the repository, regardless of
+  how many files reference them.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStats(statsOptions, globalOptions, args)
+	},
+}
+
+// StatsOptions bundles all options for the stats command.
+type StatsOptions struct {
+	Mode   string
+	Host   string
+	Tags   restic.TagLists
+	Labels restic.Labels
+	Paths  []string
+}
+
+var statsOptions StatsOptions
+
+const (
+	countModeRestoreSize     = "restore-size"
+	countModeUniqueFilesByID = "files-by-contents"
+	countModeRawData         = "raw-data"
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdStats)
+
+	f := cmdStats.Flags()
+	f.StringVar(&statsOptions.Mode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents or raw-data")
+	f.StringVarP(&statsOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
+	f.Var(&statsOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
+	f.Var(&statsOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times), when no snapshot ID is given")
+	f.StringArrayVar(&statsOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+}
+
+// statsContainer holds the accumulated statistics, it is also used for the
+// JSON output.
+type statsContainer struct {
+	TotalSize      uint64 `json:"total_size"`
+	TotalFileCount uint64 `json:"total_file_count"`
+	TotalBlobCount uint64 `json:"total_blob_count,omitempty"`
+	SnapshotsCount int    `json:"snapshots_count"`
+
+	// uniqueFiles marks visited files according to their contents, used by
+	// the files-by-contents mode
+	uniqueFiles map[string]struct{}
+
+	// blobs is the set of blobs referenced by the snapshots and seenTrees
+	// the set of trees already visited, used by the raw-data mode
+	blobs     restic.BlobSet
+	seenTrees restic.BlobSet
+}
+
+func runStats(opts StatsOptions, gopts GlobalOptions, args []string) error {
+	switch opts.Mode {
+	case countModeRestoreSize, countModeUniqueFilesByID, countModeRawData:
+	default:
+		return errors.Fatalf("unknown counting mode %q, allowed values are: %v, %v, %v",
+			opts.Mode, countModeRestoreSize, countModeUniqueFilesByID, countModeRawData)
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	stats := &statsContainer{
+		uniqueFiles: make(map[string]struct{}),
+		blobs:       restic.NewBlobSet(),
+		seenTrees:   restic.NewBlobSet(),
+	}
+
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Labels, opts.Paths, args) {
+		if sn.Tree == nil {
+			return errors.Fatalf("snapshot %s has nil tree", sn.ID().Str())
+		}
+
+		err = statsSnapshot(ctx, repo, opts.Mode, sn, stats)
+		if err != nil {
+			return errors.Fatalf("error walking snapshot %s: %v", sn.ID().Str(), err)
+		}
+		stats.SnapshotsCount++
+	}
+
+	if opts.Mode == countModeRawData {
+		for h := range stats.blobs {
+			size, found := repo.LookupBlobSize(h.ID, h.Type)
+			if !found {
+				return errors.Fatalf("blob %v not found in the index", h)
+			}
+			stats.TotalSize += uint64(size)
+		}
+		stats.TotalBlobCount = uint64(len(stats.blobs))
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(stats)
+	}
+
+	if stats.SnapshotsCount == 0 {
+		Printf("no snapshots were found\n")
+		return nil
+	}
+
+	Printf("Stats for %d snapshots in %s mode:\n", stats.SnapshotsCount, opts.Mode)
+	if opts.Mode == countModeRawData {
+		Printf("  Total Blob Count:   %d\n", stats.TotalBlobCount)
+	} else {
+		Printf("  Total File Count:   %d\n", stats.TotalFileCount)
+	}
+	Printf("        Total Size:   %s\n", formatBytes(stats.TotalSize))
+
+	return nil
+}
+
+// statsSnapshot adds the statistics for sn to stats, according to mode.
+func statsSnapshot(ctx context.Context, repo *repository.Repository, mode string, sn *restic.Snapshot, stats *statsContainer) error {
+	if mode == countModeRawData {
+		// the root tree is not added to seenTrees by FindUsedBlobs
+		h := restic.BlobHandle{ID: *sn.Tree, Type: restic.TreeBlob}
+		if stats.seenTrees.Has(h) {
+			return nil
+		}
+		stats.seenTrees.Insert(h)
+
+		return restic.FindUsedBlobs(ctx, repo, *sn.Tree, stats.blobs, stats.seenTrees)
+	}
+
+	return statsWalkTree(ctx, repo, mode, *sn.Tree, stats)
+}
+
+// statsWalkTree recursively walks the tree with the given id and counts the
+// files in it.
+func statsWalkTree(ctx context.Context, repo *repository.Repository, mode string, id restic.ID, stats *statsContainer) error {
+	tree, err := repo.LoadTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		switch node.Type {
+		case "file":
+			if mode == countModeUniqueFilesByID {
+				key := fileContentsKey(node.Content)
+				if _, ok := stats.uniqueFiles[key]; ok {
+					continue
+				}
+				stats.uniqueFiles[key] = struct{}{}
+			}
+
+			stats.TotalFileCount++
+			stats.TotalSize += node.Size
+		case "dir":
+			if node.Subtree == nil {
+				return errors.Errorf("dir %v has nil subtree", node.Name)
+			}
+
+			err = statsWalkTree(ctx, repo, mode, *node.Subtree, stats)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileContentsKey returns a string which uniquely identifies the contents of
+// a file consisting of the given blobs.
+func fileContentsKey(content restic.IDs) string {
+	buf := make([]byte, 0, len(content)*len(restic.ID{}))
+	for _, id := range content {
+		buf = append(buf, id[:]...)
+	}
+
+	return string(buf)
+}
@@ -13,17 +13,25 @@ import (
 
 var cmdTag = &cobra.Command{
 	Use:   "tag [flags] [snapshot-ID ...]",
-	Short: "Modify tags on snapshots",
+	Short: "Modify tags, labels and the description of snapshots",
 	Long: `
 The "tag" command allows you to modify tags on exiting snapshots.
 
 You can either set/replace the entire set of tags on a snapshot, or
 add tags to/remove tags from the existing set.
 
-When no snapshot-ID is given, all snapshots matching the host, tag and path filter criteria are modified.
+Labels are added or replaced with --add-label key=value and removed with
+--remove-label key. The description of the snapshots is replaced with
+--description, an empty description removes it.
+
+Snapshots marked with --protect cannot be removed by the "forget" command until
+they are released again with --unprotect.
+
+When no snapshot-ID is given, all snapshots matching the host, tag, label and path filter criteria are modified.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		tagOptions.SetDescription = cmd.Flags().Changed("description")
 		return runTag(tagOptions, globalOptions, args)
 	},
 }
@@ -33,9 +41,21 @@ type TagOptions struct {
 	Host       string
 	Paths      []string
 	Tags       restic.TagLists
+	Labels     restic.Labels
 	SetTags    []string
 	AddTags    []string
 	RemoveTags []string
+
+	AddLabels    restic.Labels
+	RemoveLabels []string
+
+	// Description replaces the description of the snapshots if
+	// SetDescription is true.
+	Description    string
+	SetDescription bool
+
+	Protect   bool
+	Unprotect bool
 }
 
 var tagOptions TagOptions
@@ -47,13 +67,24 @@ func init() {
 	tagFlags.StringSliceVar(&tagOptions.SetTags, "set", nil, "`tag` which will replace the existing tags (can be given multiple times)")
 	tagFlags.StringSliceVar(&tagOptions.AddTags, "add", nil, "`tag` which will be added to the existing tags (can be given multiple times)")
 	tagFlags.StringSliceVar(&tagOptions.RemoveTags, "remove", nil, "`tag` which will be removed from the existing tags (can be given multiple times)")
+	tagFlags.Var(&tagOptions.AddLabels, "add-label", "label `key=value` which will be added or replaced (can be given multiple times)")
+	tagFlags.StringArrayVar(&tagOptions.RemoveLabels, "remove-label", nil, "remove the label with this `key` (can be given multiple times)")
+	tagFlags.StringVar(&tagOptions.Description, "description", "", "replace the description with this `text`, an empty text removes it")
+	tagFlags.BoolVar(&tagOptions.Protect, "protect", false, "protect the snapshots from being removed by forget")
+	tagFlags.BoolVar(&tagOptions.Unprotect, "unprotect", false, "remove the protection from the snapshots")
 
 	tagFlags.StringVarP(&tagOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	tagFlags.Var(&tagOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot-ID is given")
+	tagFlags.Var(&tagOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times), when no snapshot-ID is given")
 	tagFlags.StringArrayVar(&tagOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot-ID is given")
 }
 
-func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string) (bool, error) {
+// changeSnapshot applies the changes to tags, labels, the description and the
+// protection selected in opts to sn and replaces the snapshot in the repository if
+// anything has been modified.
+func changeSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, opts TagOptions) (bool, error) {
+	setTags, addTags, removeTags := opts.SetTags, opts.AddTags, opts.RemoveTags
+
 	var changed bool
 
 	if len(setTags) != 0 {
@@ -70,8 +101,25 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 		}
 	}
 
+	if sn.SetLabels(opts.AddLabels) {
+		changed = true
+	}
+	if sn.RemoveLabels(opts.RemoveLabels) {
+		changed = true
+	}
+
+	if opts.SetDescription && sn.Description != opts.Description {
+		sn.Description = opts.Description
+		changed = true
+	}
+
+	if (opts.Protect && !sn.Protected) || (opts.Unprotect && sn.Protected) {
+		sn.Protected = opts.Protect
+		changed = true
+	}
+
 	if changed {
-		// Retain the original snapshot id over all tag changes.
+		// Retain the original snapshot id over all changes.
 		if sn.Original == nil {
 			sn.Original = sn.ID()
 		}
@@ -88,7 +136,8 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 			return false, err
 		}
 
-		// Remove the old snapshot.
+		// Remove the old snapshot. It has been replaced by the new one, so
+		// this is done even if it is protected.
 		h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
 		if err = repo.Backend().Remove(ctx, h); err != nil {
 			return false, err
@@ -100,9 +149,14 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 }
 
 func runTag(opts TagOptions, gopts GlobalOptions, args []string) error {
-	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 {
+	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 &&
+		len(opts.AddLabels) == 0 && len(opts.RemoveLabels) == 0 && !opts.SetDescription &&
+		!opts.Protect && !opts.Unprotect {
 		return errors.Fatal("nothing to do!")
 	}
+	if opts.Protect && opts.Unprotect {
+		return errors.Fatal("--protect and --unprotect cannot be given at the same time")
+	}
 	if len(opts.SetTags) != 0 && (len(opts.AddTags) != 0 || len(opts.RemoveTags) != 0) {
 		return errors.Fatal("--set and --add/--remove cannot be given at the same time")
 	}
@@ -124,10 +178,10 @@ func runTag(opts TagOptions, gopts GlobalOptions, args []string) error {
 	changeCnt := 0
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
-	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
-		changed, err := changeTags(ctx, repo, sn, opts.SetTags, opts.AddTags, opts.RemoveTags)
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Labels, opts.Paths, args) {
+		changed, err := changeSnapshot(ctx, repo, sn, opts)
 		if err != nil {
-			Warnf("unable to modify the tags for snapshot ID %q, ignoring: %v\n", sn.ID(), err)
+			Warnf("unable to modify snapshot ID %q, ignoring: %v\n", sn.ID(), err)
 			continue
 		}
 		if changed {
@@ -137,7 +191,7 @@ func runTag(opts TagOptions, gopts GlobalOptions, args []string) error {
 	if changeCnt == 0 {
 		Verbosef("no snapshots were modified\n")
 	} else {
-		Verbosef("modified tags on %v snapshots\n", changeCnt)
+		Verbosef("modified %v snapshots\n", changeCnt)
 	}
 	return nil
 }
@@ -31,7 +31,7 @@ func init() {
 }
 
 func runUnlock(opts UnlockOptions, gopts GlobalOptions) error {
-	repo, err := OpenRepository(gopts)
+	repo, err := OpenRepositoryWriteOnly(gopts)
 	if err != nil {
 		return err
 	}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -67,9 +68,9 @@ type RejectFunc func(path string, fi os.FileInfo) bool
 
 // rejectByPattern returns a RejectFunc which rejects files that match
 // one of the patterns.
-func rejectByPattern(patterns []string) RejectFunc {
+func rejectByPattern(patterns []filter.Pattern) RejectFunc {
 	return func(item string, fi os.FileInfo) bool {
-		matched, _, err := filter.List(patterns, item)
+		matched, _, err := filter.ListPatterns(patterns, item)
 		if err != nil {
 			Warnf("error for exclude pattern: %v", err)
 		}
@@ -83,6 +84,85 @@ func rejectByPattern(patterns []string) RejectFunc {
 	}
 }
 
+// patternKind identifies the option a value of a pattern option was given
+// with.
+type patternKind int
+
+const (
+	patternSensitive patternKind = iota
+	patternInsensitive
+	patternFile
+)
+
+// patternFlag is a flag.Value for options like --exclude, --iexclude and
+// --exclude-file. Each value is appended to strs and its kind is recorded in
+// order, which is shared by the related options. This way, the patterns of
+// all these options can be evaluated in the order in which they were given on
+// the command line.
+type patternFlag struct {
+	strs  *[]string
+	order *[]patternKind
+	kind  patternKind
+}
+
+func (f patternFlag) String() string {
+	return strings.Join(*f.strs, ",")
+}
+
+// Set adds a value.
+func (f patternFlag) Set(s string) error {
+	*f.strs = append(*f.strs, s)
+	*f.order = append(*f.order, f.kind)
+	return nil
+}
+
+// Type returns the type of the flag for the help text.
+func (patternFlag) Type() string {
+	return "stringArray"
+}
+
+// collectPatterns returns the patterns in sensitive and insensitive, and the
+// patterns read from the files in files, in the order recorded by
+// patternFlag. Values which were not set by patternFlag, e.g. in tests, have
+// no recorded position and follow in the order sensitive, insensitive, files.
+func collectPatterns(order []patternKind, sensitive, insensitive, files []string) []filter.Pattern {
+	lists := [...][]string{
+		patternSensitive:   sensitive,
+		patternInsensitive: insensitive,
+		patternFile:        files,
+	}
+
+	var patterns []filter.Pattern
+	var next [len(lists)]int
+
+	add := func(kind patternKind) {
+		i := next[kind]
+		if i >= len(lists[kind]) {
+			return
+		}
+		next[kind]++
+
+		value := lists[kind][i]
+		if kind == patternFile {
+			patterns = append(patterns, filter.NewPatterns(readExcludePatternsFromFiles([]string{value}), false)...)
+			return
+		}
+		patterns = append(patterns, filter.Pattern{Pattern: value, Insensitive: kind == patternInsensitive})
+	}
+
+	for _, kind := range order {
+		add(kind)
+	}
+
+	for kind := range lists {
+		for next[kind] < len(lists[kind]) {
+			add(patternKind(kind))
+		}
+	}
+
+	return patterns
+}
+
 // rejectIfPresent returns a RejectFunc which itself returns whether a path
 // should be excluded. The RejectFunc considers a file to be excluded when
 // it resides in a directory with an exclusion file, that is specified by
@@ -180,6 +260,153 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 	return true
 }
 
+// ignoreFileDir holds the patterns of the ignore files in a directory.
+type ignoreFileDir struct {
+	dir      string
+	patterns filter.IgnoreList
+}
+
+// ignoreFileStack holds the ignore files of the directories from a backup
+// target down to the directory which is currently walked. Directories are
+// added when the walk descends into them and removed when it leaves them, so
+// only the ignore files of the current directory and its parents are kept in
+// memory.
+type ignoreFileStack struct {
+	filenames []string
+	targets   []string
+	dirs      []ignoreFileDir
+}
+
+// loadIgnoreFiles reads the patterns of the ignore files in dir.
+func loadIgnoreFiles(dir string, filenames []string) filter.IgnoreList {
+	var list filter.IgnoreList
+	for _, name := range filenames {
+		filename := filepath.Join(dir, name)
+		f, err := fs.Open(filename)
+		if os.IsNotExist(errors.Cause(err)) {
+			continue
+		}
+		if err != nil {
+			Warnf("could not open ignore file: %v\n", err)
+			continue
+		}
+
+		patterns, err := filter.ParseIgnoreFile(f)
+		_ = f.Close()
+		if err != nil {
+			Warnf("ignoring invalid ignore file %v: %v\n", filename, err)
+			continue
+		}
+
+		debug.Log("loaded %d patterns from ignore file %v", len(patterns), filename)
+		list = append(list, patterns...)
+	}
+
+	return list
+}
+
+// isSubpath returns true if p is dir or a path below dir.
+func isSubpath(dir, p string) bool {
+	if p == dir {
+		return true
+	}
+
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(p, dir)
+}
+
+// target returns the innermost backup target which contains item.
+func (s *ignoreFileStack) target(item string) (target string, ok bool) {
+	for _, t := range s.targets {
+		if isSubpath(t, item) && len(t) >= len(target) {
+			target, ok = t, true
+		}
+	}
+	return target, ok
+}
+
+// enter updates the stack so that it holds the ignore files of all
+// directories from target down to dir.
+func (s *ignoreFileStack) enter(target, dir string) {
+	var path []string
+	for d := dir; ; d = filepath.Dir(d) {
+		path = append(path, d)
+		if d == target || filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	// keep the directories which are shared with the current stack
+	n := 0
+	for n < len(s.dirs) && n < len(path) && s.dirs[n].dir == path[len(path)-1-n] {
+		n++
+	}
+	s.dirs = s.dirs[:n]
+
+	for i := len(path) - 1 - n; i >= 0; i-- {
+		s.dirs = append(s.dirs, ignoreFileDir{
+			dir:      path[i],
+			patterns: loadIgnoreFiles(path[i], s.filenames),
+		})
+	}
+}
+
+// rejectByIgnoreFile returns a RejectFunc which rejects files and directories
+// matched by ignore files with the syntax of gitignore. The ignore files with
+// one of the names in filenames are read from the directory of an item and all
+// directories above it up to the enclosing backup target in targets. Patterns
+// in the ignore file of a directory are relative to it and take precedence
+// over those of the directories above.
+//
+// The returned function keeps the ignore files of the directories which are
+// currently walked, it must not be shared between concurrent walks.
+func rejectByIgnoreFile(filenames []string, targets []string) (RejectFunc, error) {
+	for _, name := range filenames {
+		if name == "" || strings.ContainsRune(name, filepath.Separator) {
+			return nil, errors.Fatalf("invalid name for ignore files: %q", name)
+		}
+	}
+
+	s := &ignoreFileStack{filenames: filenames}
+	for _, target := range targets {
+		abstarget, err := filepath.Abs(target)
+		if err != nil {
+			return nil, err
+		}
+		s.targets = append(s.targets, filepath.Clean(abstarget))
+	}
+
+	return func(item string, fi os.FileInfo) bool {
+		target, ok := s.target(item)
+		if !ok || item == target {
+			return false
+		}
+
+		s.enter(target, filepath.Dir(item))
+
+		isDir := fi != nil && fi.IsDir()
+		for i := len(s.dirs) - 1; i >= 0; i-- {
+			dir := s.dirs[i].dir
+			rel, err := filepath.Rel(dir, item)
+			if err != nil {
+				return false
+			}
+
+			ignored, decided := s.dirs[i].patterns.Match(rel, isDir)
+			if decided {
+				if ignored {
+					debug.Log("path %q excluded by an ignore file in %v", item, dir)
+				}
+				return ignored
+			}
+		}
+
+		return false
+	}, nil
+}
+
 // gatherDevices returns the set of unique device ids of the files and/or
 // directory paths listed in "items".
 func gatherDevices(items []string) (deviceMap map[string]uint64, err error) {
@@ -265,3 +492,73 @@ func rejectResticCache(repo *repository.Repository) (RejectFunc, error) {
 		return false
 	}, nil
 }
+
+// rejectBySize returns a RejectFunc that rejects regular files which are
+// larger than maxSize bytes.
+func rejectBySize(maxSize int64) RejectFunc {
+	return func(item string, fi os.FileInfo) bool {
+		if fi == nil || !fi.Mode().IsRegular() {
+			return false
+		}
+
+		if fi.Size() > maxSize {
+			debug.Log("file %v is larger than %d bytes", item, maxSize)
+			return true
+		}
+
+		return false
+	}
+}
+
+// rejectByAge returns a RejectFunc that rejects all items except directories
+// which were last modified before cutoff. Directories are never rejected, as
+// they may still contain new files.
+func rejectByAge(cutoff time.Time) RejectFunc {
+	return func(item string, fi os.FileInfo) bool {
+		if fi == nil || fi.IsDir() {
+			return false
+		}
+
+		if fi.ModTime().Before(cutoff) {
+			debug.Log("file %v was last modified before %v", item, cutoff)
+			return true
+		}
+
+		return false
+	}
+}
+
+// rejectNoDump returns a RejectFunc that rejects files and directories which
+// have the nodump flag set. The first item of samples is used to check
+// whether the flag can be read on this system.
+func rejectNoDump(samples []string) (RejectFunc, error) {
+	if len(samples) > 0 {
+		fi, err := fs.Lstat(samples[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = isNoDump(samples[0], fi); err != nil {
+			return nil, errors.Fatalf("unable to read the nodump flag: %v", err)
+		}
+	}
+
+	return func(item string, fi os.FileInfo) bool {
+		if fi == nil {
+			return false
+		}
+
+		nodump, err := isNoDump(item, fi)
+		if err != nil {
+			Warnf("unable to read the nodump flag of %v: %v\n", item, err)
+			return false
+		}
+
+		if nodump {
+			debug.Log("path %q has the nodump flag set", item)
+			return true
+		}
+
+		return false
+	}, nil
+}
@@ -0,0 +1,24 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ufNoDump is the flag UF_NODUMP from sys/stat.h, set with "chflags nodump".
+const ufNoDump = 0x00000001
+
+// isNoDump returns true if the nodump flag of the file is set.
+func isNoDump(item string, fi os.FileInfo) (bool, error) {
+	s, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, errors.Errorf("unable to read the file flags: fi.Sys() is %T", fi.Sys())
+	}
+
+	return s.Flags&ufNoDump != 0, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// isNoDump returns true if the nodump flag (FS_NODUMP_FL, set with
+// "chattr +d") of the file is set. The flag is read with statx, which is
+// available since Linux 4.11.
+func isNoDump(item string, fi os.FileInfo) (bool, error) {
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, item, unix.AT_SYMLINK_NOFOLLOW, 0, &stx)
+	if err != nil {
+		return false, errors.Wrap(err, "statx")
+	}
+
+	return stx.Attributes&unix.STATX_ATTR_NODUMP != 0, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/test"
+)
+
+func TestRejectNoDump(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	nodump := filepath.Join(tempDir, "nodump")
+	other := filepath.Join(tempDir, "other")
+	test.OK(t, ioutil.WriteFile(nodump, []byte("nodump"), 0600))
+	test.OK(t, ioutil.WriteFile(other, []byte("other"), 0600))
+
+	// not all file systems support the flag
+	out, err := exec.Command("chattr", "+d", nodump).CombinedOutput()
+	if err != nil {
+		t.Skipf("unable to set the nodump flag: %v, output: %s", err, out)
+	}
+
+	reject, err := rejectNoDump([]string{tempDir})
+	test.OK(t, err)
+
+	for _, item := range []struct {
+		path   string
+		reject bool
+	}{
+		{nodump, true},
+		{other, false},
+	} {
+		fi, err := os.Lstat(item.path)
+		test.OK(t, err)
+
+		if res := reject(item.path, fi); res != item.reject {
+			t.Errorf("wrong result for %v: want %v, got %v", item.path, item.reject, res)
+		}
+	}
+}
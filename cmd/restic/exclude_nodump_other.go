@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// isNoDump always returns an error, the nodump flag is not supported on this
+// operating system.
+func isNoDump(item string, fi os.FileInfo) (bool, error) {
+	return false, errors.New("the nodump flag is not supported on this operating system")
+}
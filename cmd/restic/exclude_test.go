@@ -5,8 +5,13 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
+	"github.com/spf13/pflag"
 )
 
 func TestRejectByPattern(t *testing.T) {
@@ -26,7 +31,7 @@ func TestRejectByPattern(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run("", func(t *testing.T) {
-			reject := rejectByPattern(patterns)
+			reject := rejectByPattern(filter.NewPatterns(patterns, false))
 			res := reject(tc.filename, nil)
 			if res != tc.reject {
 				t.Fatalf("wrong result for filename %v: want %v, got %v",
@@ -36,6 +41,75 @@ func TestRejectByPattern(t *testing.T) {
 	}
 }
 
+func TestRejectByInsensitivePattern(t *testing.T) {
+	var tests = []struct {
+		filename string
+		reject   bool
+	}{
+		{filename: "/home/user/foo.GO", reject: true},
+		{filename: "/home/user/foo.c", reject: false},
+		{filename: "/home/user/Important.go", reject: false},
+		{filename: "/home/USER/readme.md", reject: true},
+	}
+
+	patterns := []string{"*.go", "!important.go", "README.md"}
+
+	for _, tc := range tests {
+		t.Run("", func(t *testing.T) {
+			reject := rejectByPattern(filter.NewPatterns(patterns, true))
+			res := reject(tc.filename, nil)
+			if res != tc.reject {
+				t.Fatalf("wrong result for filename %v: want %v, got %v",
+					tc.filename, tc.reject, res)
+			}
+		})
+	}
+}
+
+func TestPatternFlagOrder(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	excludeFile := filepath.Join(tempDir, "excludes")
+	test.OK(t, ioutil.WriteFile(excludeFile, []byte("*.log\n"), 0644))
+
+	var opts BackupOptions
+	f := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	f.Var(patternFlag{&opts.Excludes, &opts.excludeOrder, patternSensitive}, "exclude", "")
+	f.Var(patternFlag{&opts.InsensitiveExcludes, &opts.excludeOrder, patternInsensitive}, "iexclude", "")
+	f.Var(patternFlag{&opts.ExcludeFiles, &opts.excludeOrder, patternFile}, "exclude-file", "")
+	test.OK(t, f.Parse([]string{"--iexclude", "*.TXT", "--exclude", "!important.*",
+		"--exclude-file", excludeFile, "--exclude", "!debug.log"}))
+
+	test.Equals(t, []string{"!important.*", "!debug.log"}, opts.Excludes)
+	test.Equals(t, []string{"*.TXT"}, opts.InsensitiveExcludes)
+	test.Equals(t, []string{excludeFile}, opts.ExcludeFiles)
+
+	test.Equals(t, []filter.Pattern{
+		{Pattern: "*.TXT", Insensitive: true},
+		{Pattern: "!important.*"},
+		{Pattern: "*.log"},
+		{Pattern: "!debug.log"},
+	}, collectPatterns(opts.excludeOrder, opts.Excludes, opts.InsensitiveExcludes, opts.ExcludeFiles))
+
+	reject := rejectByPattern(collectPatterns(opts.excludeOrder, opts.Excludes, opts.InsensitiveExcludes, opts.ExcludeFiles))
+	test.Assert(t, reject("/var/log/notes.txt", nil), "notes.txt was not rejected")
+	test.Assert(t, !reject("/var/log/important.txt", nil), "important.txt was rejected")
+	test.Assert(t, reject("/var/log/important.log", nil), "important.log was not rejected")
+	test.Assert(t, !reject("/var/log/debug.log", nil), "debug.log was rejected")
+}
+
+func TestCollectPatternsUnrecorded(t *testing.T) {
+	// values set without patternFlag follow the recorded ones
+	order := []patternKind{patternInsensitive}
+	patterns := collectPatterns(order, []string{"*.go"}, []string{"*.C", "*.H"}, nil)
+	test.Equals(t, []filter.Pattern{
+		{Pattern: "*.C", Insensitive: true},
+		{Pattern: "*.go"},
+		{Pattern: "*.H", Insensitive: true},
+	}, patterns)
+}
+
 func TestIsExcludedByFile(t *testing.T) {
 	const (
 		tagFilename = "CACHEDIR.TAG"
@@ -162,3 +236,183 @@ func TestMultipleIsExcludedByFile(t *testing.T) {
 		}
 	}
 }
+
+func TestRejectBySizeAndAge(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	now := time.Now()
+	files := []struct {
+		path   string
+		size   int
+		age    time.Duration
+		bySize bool
+		byAge  bool
+		isDir  bool
+	}{
+		{path: "small", size: 10, bySize: false, byAge: false},
+		{path: "large", size: 2048, bySize: true, byAge: false},
+		{path: "old", size: 10, age: 48 * time.Hour, bySize: false, byAge: true},
+		{path: "old-large", size: 4096, age: 48 * time.Hour, bySize: true, byAge: true},
+		{path: "olddir", age: 48 * time.Hour, isDir: true, bySize: false, byAge: false},
+	}
+
+	bySize := rejectBySize(1024)
+	byAge := rejectByAge(now.Add(-24 * time.Hour))
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, f.path)
+		if f.isDir {
+			test.OK(t, os.Mkdir(p, 0700))
+		} else {
+			test.OK(t, ioutil.WriteFile(p, make([]byte, f.size), 0600))
+		}
+		mtime := now.Add(-f.age)
+		test.OK(t, os.Chtimes(p, mtime, mtime))
+
+		fi, err := os.Lstat(p)
+		test.OK(t, err)
+
+		if res := bySize(p, fi); res != f.bySize {
+			t.Errorf("wrong result of rejectBySize for %v: want %v, got %v", f.path, f.bySize, res)
+		}
+		if res := byAge(p, fi); res != f.byAge {
+			t.Errorf("wrong result of rejectByAge for %v: want %v, got %v", f.path, f.byAge, res)
+		}
+	}
+}
+
+func TestRejectRuleReason(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	opts := BackupOptions{
+		Excludes:          []string{"*.log"},
+		ExcludeLargerThan: "2k",
+		ExcludeOlderThan:  restic.Duration{Days: 1},
+	}
+	rules, err := collectRejectRules(opts, repository.New(nil), []string{tempDir})
+	test.OK(t, err)
+
+	now := time.Now()
+	files := []struct {
+		path   string
+		size   int
+		age    time.Duration
+		reason string
+	}{
+		{path: "small", size: 10},
+		{path: "debug.log", size: 10, reason: "exclude pattern"},
+		{path: "large", size: 4096, reason: "larger than 2.000 KiB"},
+		{path: "old", size: 10, age: 48 * time.Hour, reason: "older than 1d"},
+	}
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, f.path)
+		test.OK(t, ioutil.WriteFile(p, make([]byte, f.size), 0600))
+		mtime := now.Add(-f.age)
+		test.OK(t, os.Chtimes(p, mtime, mtime))
+
+		fi, err := os.Lstat(p)
+		test.OK(t, err)
+
+		reason := ""
+		if rule := rejectedBy(rules, p, fi); rule != nil {
+			reason = rule.reason
+		}
+
+		if reason != f.reason {
+			t.Errorf("wrong reason for %v: want %q, got %q", f.path, f.reason, reason)
+		}
+	}
+}
+
+func TestRejectByIgnoreFile(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	files := []struct {
+		path string
+		incl bool
+	}{
+		{".resticignore", true},
+		{"main.go", true},
+		{"main.o", false},
+		{"build/out", false},
+		{"logs/debug.log", false},
+		{"logs/important.log", true},
+		{"src/.resticignore", true},
+		{"src/lib.o", true},
+		{"src/gen/code.go", false},
+		{"src/lib/build/out", false},
+		{"src/lib/tmp", true},
+		{"tmp/x", false},
+	}
+
+	ignoreFiles := map[string]string{
+		".resticignore":     "*.o\nbuild/\n*.log\n!important.log\n/tmp\n",
+		"src/.resticignore": "!*.o\ngen/\n",
+	}
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		test.OK(t, os.MkdirAll(filepath.Dir(p), 0700))
+
+		data, ok := ignoreFiles[f.path]
+		if !ok {
+			data = f.path
+		}
+		test.OK(t, ioutil.WriteFile(p, []byte(data), 0600))
+	}
+
+	// walk returns the inclusion status of all items below target
+	walk := func(target string) map[string]bool {
+		reject, err := rejectByIgnoreFile([]string{".resticignore"}, []string{target})
+		test.OK(t, err)
+
+		m := make(map[string]bool)
+		test.OK(t, filepath.Walk(target, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			excluded := reject(p, fi)
+			m[p] = !excluded
+			if excluded && fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}))
+		return m
+	}
+
+	m := walk(tempDir)
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		if m[p] != f.incl {
+			t.Errorf("inclusion status of %s is wrong: want %v, got %v", f.path, f.incl, m[p])
+		}
+	}
+
+	// ignore files above the backup target are not read
+	m = walk(filepath.Join(tempDir, "src"))
+	for _, f := range []struct {
+		path string
+		incl bool
+	}{
+		{"src", true},
+		{"src/lib.o", true},
+		{"src/gen/code.go", false},
+		{"src/lib/build/out", true},
+	} {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		if m[p] != f.incl {
+			t.Errorf("target src: inclusion status of %s is wrong: want %v, got %v", f.path, f.incl, m[p])
+		}
+	}
+
+	_, err := rejectByIgnoreFile([]string{"dir/.resticignore"}, nil)
+	if err == nil {
+		t.Errorf("invalid name for ignore files was accepted")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// forgetPolicyFile is the JSON document read from the file given with
+// --policy-file.
+type forgetPolicyFile struct {
+	Rules []forgetPolicyFileRule `json:"rules"`
+}
+
+// forgetPolicyFileRule selects snapshots by host, tags, paths and labels and
+// configures which of these are kept.
+type forgetPolicyFileRule struct {
+	Name   string            `json:"name"`
+	Host   string            `json:"host"`
+	Tags   []string          `json:"tags"`
+	Paths  []string          `json:"paths"`
+	Labels map[string]string `json:"labels"`
+
+	Keep struct {
+		Last    int      `json:"last"`
+		Hourly  int      `json:"hourly"`
+		Daily   int      `json:"daily"`
+		Weekly  int      `json:"weekly"`
+		Monthly int      `json:"monthly"`
+		Yearly  int      `json:"yearly"`
+		Tags    []string `json:"tags"`
+
+		Within        string `json:"within"`
+		WithinDaily   string `json:"within_daily"`
+		WithinWeekly  string `json:"within_weekly"`
+		WithinMonthly string `json:"within_monthly"`
+		WithinYearly  string `json:"within_yearly"`
+	} `json:"keep"`
+}
+
+// forgetRule is a rule of a policy file which is ready to be applied.
+type forgetRule struct {
+	Name   string
+	Host   string
+	Tags   restic.TagLists
+	Paths  []string
+	Labels restic.Labels
+	Policy restic.ExpirePolicy
+}
+
+// Matches returns true if the snapshot is selected by the rule. The host may
+// be a pattern as understood by filepath.Match.
+func (r forgetRule) Matches(sn *restic.Snapshot) bool {
+	if r.Host != "" {
+		match, err := filepath.Match(r.Host, sn.Hostname)
+		if err != nil || !match {
+			return false
+		}
+	}
+
+	return sn.HasTagList(r.Tags) && sn.HasPaths(r.Paths) && sn.HasLabels(r.Labels)
+}
+
+func (r forgetRule) String() string {
+	var selectors []string
+	if r.Host != "" {
+		selectors = append(selectors, "host "+r.Host)
+	}
+	if len(r.Tags) > 0 {
+		selectors = append(selectors, "tags "+r.Tags.String())
+	}
+	if len(r.Paths) > 0 {
+		selectors = append(selectors, "paths ["+strings.Join(r.Paths, ", ")+"]")
+	}
+	if len(r.Labels) > 0 {
+		selectors = append(selectors, "labels "+r.Labels.String())
+	}
+	if len(selectors) == 0 {
+		selectors = append(selectors, "all snapshots")
+	}
+
+	return fmt.Sprintf("rule %q for %v", r.Name, strings.Join(selectors, ", "))
+}
+
+// durationValue is a duration from the policy file and its destination.
+type durationValue struct {
+	s string
+	d *restic.Duration
+}
+
+// parseDurations parses the strings in list into the Durations, empty
+// strings are skipped.
+func parseDurations(list []durationValue) error {
+	for _, v := range list {
+		if v.s == "" {
+			continue
+		}
+
+		d, err := restic.ParseDuration(v.s)
+		if err != nil {
+			return err
+		}
+		*v.d = d
+	}
+
+	return nil
+}
+
+// loadForgetPolicyFile reads the rules from the policy file filename.
+func loadForgetPolicyFile(filename string) ([]forgetRule, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read policy file: %v", err)
+	}
+
+	var file forgetPolicyFile
+	err = json.Unmarshal(buf, &file)
+	if err != nil {
+		return nil, errors.Fatalf("unable to parse policy file %v: %v", filename, err)
+	}
+
+	if len(file.Rules) == 0 {
+		return nil, errors.Fatalf("policy file %v does not contain any rules", filename)
+	}
+
+	rules := make([]forgetRule, 0, len(file.Rules))
+	for i, fr := range file.Rules {
+		rule := forgetRule{
+			Name:   fr.Name,
+			Host:   fr.Host,
+			Paths:  fr.Paths,
+			Labels: restic.Labels(fr.Labels),
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("%d", i+1)
+		}
+
+		if _, err = filepath.Match(rule.Host, ""); err != nil {
+			return nil, errors.Fatalf("rule %q: invalid host pattern %q: %v", rule.Name, rule.Host, err)
+		}
+
+		for _, tags := range fr.Tags {
+			if err = rule.Tags.Set(tags); err != nil {
+				return nil, errors.Fatalf("rule %q: %v", rule.Name, err)
+			}
+		}
+
+		keep := fr.Keep
+		rule.Policy = restic.ExpirePolicy{
+			Last:    keep.Last,
+			Hourly:  keep.Hourly,
+			Daily:   keep.Daily,
+			Weekly:  keep.Weekly,
+			Monthly: keep.Monthly,
+			Yearly:  keep.Yearly,
+		}
+
+		var keepTags restic.TagLists
+		for _, tags := range keep.Tags {
+			if err = keepTags.Set(tags); err != nil {
+				return nil, errors.Fatalf("rule %q: %v", rule.Name, err)
+			}
+		}
+		rule.Policy.Tags = keepTags
+
+		err = parseDurations([]durationValue{
+			{keep.Within, &rule.Policy.Within},
+			{keep.WithinDaily, &rule.Policy.WithinDaily},
+			{keep.WithinWeekly, &rule.Policy.WithinWeekly},
+			{keep.WithinMonthly, &rule.Policy.WithinMonthly},
+			{keep.WithinYearly, &rule.Policy.WithinYearly},
+		})
+		if err != nil {
+			return nil, errors.Fatalf("rule %q: %v", rule.Name, err)
+		}
+
+		if rule.Policy.Empty() {
+			return nil, errors.Fatalf("rule %q does not specify which snapshots to keep", rule.Name)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
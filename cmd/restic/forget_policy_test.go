@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func writePolicyFile(t testing.TB, dir, data string) string {
+	filename := filepath.Join(dir, "policy.json")
+	rtest.OK(t, ioutil.WriteFile(filename, []byte(data), 0600))
+	return filename
+}
+
+func TestLoadForgetPolicyFile(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := writePolicyFile(t, tempdir, `{
+		"rules": [
+			{
+				"name": "databases",
+				"host": "db-*",
+				"tags": ["mysql,daily", "postgres"],
+				"keep": {"daily": 90, "within": "14d", "within_monthly": "2y", "tags": ["important"]}
+			},
+			{
+				"labels": {"env": "test"},
+				"paths": ["/srv"],
+				"keep": {"last": 1}
+			}
+		]
+	}`)
+
+	rules, err := loadForgetPolicyFile(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(rules))
+
+	rtest.Equals(t, "databases", rules[0].Name)
+	rtest.Equals(t, "db-*", rules[0].Host)
+	rtest.Equals(t, restic.TagLists{{"mysql", "daily"}, {"postgres"}}, rules[0].Tags)
+	rtest.Equals(t, restic.ExpirePolicy{
+		Daily:         90,
+		Tags:          []restic.TagList{{"important"}},
+		Within:        restic.Duration{Days: 14},
+		WithinMonthly: restic.Duration{Years: 2},
+	}, rules[0].Policy)
+
+	rtest.Equals(t, "2", rules[1].Name)
+	rtest.Equals(t, restic.Labels{"env": "test"}, rules[1].Labels)
+	rtest.Equals(t, []string{"/srv"}, rules[1].Paths)
+	rtest.Equals(t, restic.ExpirePolicy{Last: 1}, rules[1].Policy)
+
+	var tests = []struct {
+		sn    restic.Snapshot
+		match int
+	}{
+		{restic.Snapshot{Hostname: "db-1", Tags: []string{"postgres"}}, 0},
+		{restic.Snapshot{Hostname: "db-1", Tags: []string{"mysql"}}, -1},
+		{restic.Snapshot{Hostname: "web", Tags: []string{"postgres"}}, -1},
+		{restic.Snapshot{Hostname: "db-2", Tags: []string{"mysql", "daily"}}, 0},
+		{restic.Snapshot{Hostname: "web", Paths: []string{"/srv"}, Labels: restic.Labels{"env": "test"}}, 1},
+		{restic.Snapshot{Hostname: "web", Paths: []string{"/srv"}, Labels: restic.Labels{"env": "prod"}}, -1},
+	}
+
+	for i, test := range tests {
+		match := -1
+		for j, rule := range rules {
+			if rule.Matches(&test.sn) {
+				match = j
+				break
+			}
+		}
+
+		if match != test.match {
+			t.Errorf("test %d: snapshot matched rule %d, want %d", i, match, test.match)
+		}
+	}
+}
+
+func TestLoadForgetPolicyFileInvalid(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	var tests = []string{
+		``,
+		`{"rules": []}`,
+		`{"rules": [{"host": "foo"}]}`,
+		`{"rules": [{"keep": {"daly": 7}}]}`,
+		`{"rules": [{"keep": {"within": "7x"}}]}`,
+		`{"rules": [{"host": "[", "keep": {"last": 1}}]}`,
+	}
+
+	for _, data := range tests {
+		filename := writePolicyFile(t, tempdir, data)
+		_, err := loadForgetPolicyFile(filename)
+		if err == nil {
+			t.Errorf("no error returned for policy file %q", data)
+		}
+	}
+
+	_, err := loadForgetPolicyFile(filepath.Join(tempdir, "missing"))
+	rtest.Assert(t, err != nil, "no error returned for missing policy file")
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -26,6 +29,43 @@ func formatBytes(c uint64) string {
 	}
 }
 
+// parseSizeStr parses a size given as a number of bytes with an optional
+// suffix k, m, g or t (case-insensitive) for KiB, MiB, GiB and TiB.
+func parseSizeStr(sizeStr string) (int64, error) {
+	if sizeStr == "" {
+		return 0, errors.New("expected size, got empty string")
+	}
+
+	numStr := sizeStr[:len(sizeStr)-1]
+	var unit int64 = 1
+
+	switch sizeStr[len(sizeStr)-1] {
+	case 'b', 'B':
+		// use byte unit
+	case 'k', 'K':
+		unit = 1 << 10
+	case 'm', 'M':
+		unit = 1 << 20
+	case 'g', 'G':
+		unit = 1 << 30
+	case 't', 'T':
+		unit = 1 << 40
+	default:
+		numStr = sizeStr
+	}
+
+	value, err := strconv.ParseInt(numStr, 10, 64)
+	if err != nil || value < 0 {
+		return 0, errors.Errorf("invalid size %q", sizeStr)
+	}
+
+	if value > math.MaxInt64/unit {
+		return 0, errors.Errorf("size %q is too large", sizeStr)
+	}
+
+	return value * unit, nil
+}
+
 func formatSeconds(sec uint64) string {
 	hours := sec / 3600
 	sec -= hours * 3600
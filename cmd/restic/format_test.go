@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseSizeStr(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"1024b", 1024},
+		{"1024B", 1024},
+		{"1k", 1024},
+		{"100k", 102400},
+		{"100K", 102400},
+		{"10m", 10485760},
+		{"100M", 104857600},
+		{"20G", 21474836480},
+		{"10g", 10737418240},
+		{"2T", 2199023255552},
+		{"2t", 2199023255552},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			result, err := parseSizeStr(test.input)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.expected, result)
+		})
+	}
+}
+
+func TestParseInvalidSizeStr(t *testing.T) {
+	invalidSizes := []string{
+		"",
+		"k",
+		"-1",
+		"10x",
+		"1.5G",
+		"9999999999T",
+	}
+
+	for _, s := range invalidSizes {
+		t.Run(s, func(t *testing.T) {
+			_, err := parseSizeStr(s)
+			if err == nil {
+				t.Errorf("wanted error for invalid value %q, got nil", s)
+			}
+		})
+	}
+}
+
+func TestFormatPruneLimit(t *testing.T) {
+	opts := PruneOptions{MaxUnused: "5%"}
+	rtest.OK(t, verifyPruneOptions(&opts))
+
+	// the limit is shown relative to the total size, like --max-unused
+	used := uint64(95 * 1024 * 1024)
+	rtest.Equals(t, "5.000 MiB / 5.00%", formatLimit(opts.maxUnusedBytes(used), used))
+
+	opts = PruneOptions{MaxUnused: "unlimited"}
+	rtest.OK(t, verifyPruneOptions(&opts))
+	rtest.Equals(t, "unlimited", formatLimit(opts.maxUnusedBytes(used), used))
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -40,21 +41,26 @@ var version = "compiled manually"
 
 // GlobalOptions hold all global options for restic.
 type GlobalOptions struct {
-	Repo          string
-	PasswordFile  string
-	Quiet         bool
-	Verbose       int
-	NoLock        bool
-	JSON          bool
-	CacheDir      string
-	NoCache       bool
-	CACerts       []string
-	TLSClientCert string
-	CleanupCache  bool
+	Repo            string
+	PasswordFile    string
+	PasswordCommand string
+	Quiet           bool
+	Verbose         int
+	NoLock          bool
+	JSON            bool
+	CacheDir        string
+	NoCache         bool
+	CACerts         []string
+	TLSClientCert   string
+	CleanupCache    bool
 
 	LimitUploadKb   int
 	LimitDownloadKb int
 
+	// PackSize is the target size of new pack files in MiB, zero uses the
+	// size configured for the repository
+	PackSize uint
+
 	ctx      context.Context
 	password string
 	stdout   io.Writer
@@ -88,6 +94,7 @@ func init() {
 	f := cmdRoot.PersistentFlags()
 	f.StringVarP(&globalOptions.Repo, "repo", "r", os.Getenv("RESTIC_REPOSITORY"), "repository to backup to or restore from (default: $RESTIC_REPOSITORY)")
 	f.StringVarP(&globalOptions.PasswordFile, "password-file", "p", os.Getenv("RESTIC_PASSWORD_FILE"), "read the repository password from a file (default: $RESTIC_PASSWORD_FILE)")
+	f.StringVar(&globalOptions.PasswordCommand, "password-command", os.Getenv("RESTIC_PASSWORD_COMMAND"), "run `command` and use its output as the repository password (default: $RESTIC_PASSWORD_COMMAND)")
 	f.BoolVarP(&globalOptions.Quiet, "quiet", "q", false, "do not output comprehensive progress report")
 	f.CountVarP(&globalOptions.Verbose, "verbose", "v", "be verbose (specify --verbose multiple times or level `n`)")
 	f.BoolVar(&globalOptions.NoLock, "no-lock", false, "do not lock the repo, this allows some operations on read-only repos")
@@ -99,6 +106,7 @@ func init() {
 	f.BoolVar(&globalOptions.CleanupCache, "cleanup-cache", false, "auto remove old cache directories")
 	f.IntVar(&globalOptions.LimitUploadKb, "limit-upload", 0, "limits uploads to a maximum rate in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.LimitDownloadKb, "limit-download", 0, "limits downloads to a maximum rate in KiB/s. (default: unlimited)")
+	f.UintVar(&globalOptions.PackSize, "pack-size", 0, "target `size` of new pack files in MiB, overrides the repository setting (default: size configured for the repository)")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
 
 	restoreTerminal()
@@ -234,6 +242,14 @@ func Exitf(exitcode int, format string, args ...interface{}) {
 
 // resolvePassword determines the password to be used for opening the repository.
 func resolvePassword(opts GlobalOptions, env string) (string, error) {
+	if opts.PasswordFile != "" && opts.PasswordCommand != "" {
+		return "", errors.Fatal("--password-file and --password-command are mutually exclusive")
+	}
+
+	if opts.PasswordCommand != "" {
+		return readPasswordCommand(opts.PasswordCommand)
+	}
+
 	if opts.PasswordFile != "" {
 		s, err := ioutil.ReadFile(opts.PasswordFile)
 		if os.IsNotExist(err) {
@@ -249,6 +265,35 @@ func resolvePassword(opts GlobalOptions, env string) (string, error) {
 	return "", nil
 }
 
+// readPasswordCommand runs the command and returns its output as the
+// password. The command can interact with the user via stdin and stderr.
+func readPasswordCommand(command string) (string, error) {
+	args, err := backend.SplitShellStrings(command)
+	if err != nil {
+		return "", errors.Fatalf("invalid password command %q: %v", command, err)
+	}
+
+	if len(args) == 0 {
+		return "", errors.Fatal("password command is empty")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", errors.Fatalf("password command %q failed: %v", command, err)
+	}
+
+	password := strings.TrimRight(string(output), "\r\n")
+	if len(password) == 0 {
+		return "", errors.Fatalf("password command %q returned an empty password", command)
+	}
+
+	return password, nil
+}
+
 // readPassword reads the password from the given reader directly.
 func readPassword(in io.Reader) (password string, err error) {
 	buf := make([]byte, 1000)
@@ -327,8 +372,28 @@ func ReadPasswordTwice(gopts GlobalOptions, prompt1, prompt2 string) (string, er
 
 const maxKeys = 20
 
-// OpenRepository reads the password and opens the repository.
+// packSizeBytes converts the pack size given in MiB to bytes.
+func packSizeBytes(mib uint) (uint, error) {
+	if mib > restic.MaxPackSize/(1024*1024) {
+		return 0, errors.Fatalf("invalid --pack-size %d, at most %d MiB are allowed", mib, restic.MaxPackSize/(1024*1024))
+	}
+
+	return mib * 1024 * 1024, nil
+}
+
+// OpenRepository reads the password and opens the repository. Write-only keys
+// are rejected, since they cannot be used to read data.
 func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
+	return openRepository(opts, false)
+}
+
+// OpenRepositoryWriteOnly opens the repository like OpenRepository, but also
+// accepts write-only keys.
+func OpenRepositoryWriteOnly(opts GlobalOptions) (*repository.Repository, error) {
+	return openRepository(opts, true)
+}
+
+func openRepository(opts GlobalOptions, allowWriteOnly bool) (*repository.Repository, error) {
 	if opts.Repo == "" {
 		return nil, errors.Fatal("Please specify repository location (-r)")
 	}
@@ -354,10 +419,25 @@ func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
 		return nil, err
 	}
 
+	if s.WriteOnly() && !allowWriteOnly {
+		return nil, errors.Fatal("this command cannot be used with a write-only key")
+	}
+
 	if stdoutIsTerminal() {
 		Verbosef("password is correct\n")
 	}
 
+	if opts.PackSize > 0 {
+		size, err := packSizeBytes(opts.PackSize)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = s.SetPackSize(size); err != nil {
+			return nil, errors.Fatalf("%v", err)
+		}
+	}
+
 	if opts.NoCache {
 		return s, nil
 	}
@@ -50,7 +50,7 @@ func testRunInit(t testing.TB, opts GlobalOptions) {
 	restic.TestDisableCheckPolynomial(t)
 	restic.TestSetLockTimeout(t, 0)
 
-	rtest.OK(t, runInit(opts, nil))
+	rtest.OK(t, runInit(InitOptions{RepositoryVersion: "stable", Compression: "auto"}, opts, nil))
 	t.Logf("repository initialized at %v", opts.Repo)
 }
 
@@ -216,11 +216,11 @@ func testRunSnapshots(t testing.TB, gopts GlobalOptions) (newest *Snapshot, snap
 
 func testRunForget(t testing.TB, gopts GlobalOptions, args ...string) {
 	opts := ForgetOptions{}
-	rtest.OK(t, runForget(opts, gopts, args))
+	rtest.OK(t, runForget(opts, PruneOptions{}, gopts, args))
 }
 
-func testRunPrune(t testing.TB, gopts GlobalOptions) {
-	rtest.OK(t, runPrune(gopts))
+func testRunPrune(t testing.TB, gopts GlobalOptions, opts PruneOptions) {
+	rtest.OK(t, runPrune(opts, gopts))
 }
 
 func TestBackup(t *testing.T) {
@@ -250,6 +250,12 @@ func TestBackup(t *testing.T) {
 	testRunCheck(t, env.gopts)
 	stat1 := dirStats(env.repo)
 
+	first, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, first.Summary != nil, "first snapshot has no summary")
+	rtest.Assert(t, first.Summary.FilesNew > 0 && first.Summary.FilesNew == first.Summary.TotalFilesProcessed,
+		"unexpected summary for first snapshot: %+v", first.Summary)
+	rtest.Assert(t, first.Summary.DataAdded > 0, "first snapshot did not add any data")
+
 	// second backup, implicit incremental
 	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
 	snapshotIDs = testRunList(t, "snapshots", env.gopts)
@@ -262,6 +268,12 @@ func TestBackup(t *testing.T) {
 	}
 	t.Logf("repository grown by %d bytes", stat2.size-stat1.size)
 
+	second, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, second.Summary != nil, "second snapshot has no summary")
+	rtest.Assert(t, second.Summary.FilesNew == 0 && second.Summary.FilesChanged == 0,
+		"unexpected summary for second snapshot: %+v", second.Summary)
+	rtest.Equals(t, first.Summary.TotalFilesProcessed, second.Summary.FilesUnmodified)
+
 	testRunCheck(t, env.gopts)
 	// third backup, explicit incremental
 	opts.Parent = snapshotIDs[0].String()
@@ -288,6 +300,309 @@ func TestBackup(t *testing.T) {
 	testRunCheck(t, env.gopts)
 }
 
+func TestInitRepositoryVersion(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+
+	var tests = []struct {
+		version     string
+		want        uint
+		compression restic.CompressionMode
+	}{
+		{"1", 1, restic.CompressionOff},
+		{"2", 2, restic.CompressionAuto},
+		{"stable", restic.RepoVersion, restic.CompressionAuto},
+		{"latest", restic.MaxRepoVersion, restic.CompressionAuto},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			env, cleanup := withTestEnvironment(t)
+			defer cleanup()
+
+			rtest.OK(t, runInit(InitOptions{RepositoryVersion: test.version}, env.gopts, nil))
+
+			repo, err := OpenRepository(env.gopts)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.want, repo.Config().Version)
+			rtest.Equals(t, test.compression, repo.Config().Compression)
+		})
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	err := runInit(InitOptions{RepositoryVersion: "1", Compression: "auto"}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "compression for repository version 1 was accepted")
+}
+
+func TestRepositoryUpgradeV2(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+	rtest.OK(t, runInit(InitOptions{RepositoryVersion: "1"}, env.gopts, nil))
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	opts := BackupOptions{}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	rtest.OK(t, runMigrate(MigrateOptions{}, env.gopts, []string{"upgrade_repo_v2"}))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(2), repo.Config().Version)
+	rtest.Equals(t, restic.CompressionAuto, repo.Config().Compression)
+
+	// add a file with compressible content, so the repo contains packs with
+	// both uncompressed and compressed blobs
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "compressible"),
+		bytes.Repeat([]byte("restic compression test\n"), 100000), 0644))
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2,
+		"expected two snapshots, got %v", snapshotIDs)
+
+	newest, _ := testRunSnapshots(t, env.gopts)
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, *newest.ID)
+	rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+		"directories are not equal")
+}
+
+func TestRepositoryUpgradeV3(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	opts := BackupOptions{}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Join("testdata", "0", "0", "9")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	indexesBefore := testRunList(t, "index", env.gopts)
+
+	rtest.OK(t, runMigrate(MigrateOptions{}, env.gopts, []string{"upgrade_repo_v3"}))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(3), repo.Config().Version)
+
+	// all index files have been converted
+	indexesAfter := testRunList(t, "index", env.gopts)
+	rtest.Equals(t, len(indexesBefore), len(indexesAfter))
+	rtest.Assert(t, len(restic.NewIDSet(indexesBefore...).Intersect(restic.NewIDSet(indexesAfter...))) == 0,
+		"index files were not converted: %v", indexesAfter)
+	testRunCheck(t, env.gopts)
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	// prune rewrites the index
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	testRunCheck(t, env.gopts)
+
+	newest, _ := testRunSnapshots(t, env.gopts)
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, *newest.ID)
+	rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+		"directories are not equal")
+}
+
+func testRunCopy(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions) {
+	passwordFile := filepath.Join(filepath.Dir(srcGopts.Repo), "source-password")
+	rtest.OK(t, ioutil.WriteFile(passwordFile, []byte(srcGopts.password), 0600))
+
+	copyOpts := CopyOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			FromRepo:         srcGopts.Repo,
+			FromPasswordFile: passwordFile,
+		},
+	}
+
+	rtest.OK(t, runCopy(copyOpts, dstGopts, nil))
+}
+
+func TestCopy(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+	testRunInit(t, env2.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	opts := BackupOptions{}
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	testRunCopy(t, env.gopts, env2.gopts)
+	testRunCheck(t, env2.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	copiedSnapshotIDs := testRunList(t, "snapshots", env2.gopts)
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs),
+		"expected %v copied snapshots, got %v", len(snapshotIDs), len(copiedSnapshotIDs))
+
+	// copying a second time must not create new snapshots
+	testRunCopy(t, env.gopts, env2.gopts)
+	copiedSnapshotIDs = testRunList(t, "snapshots", env2.gopts)
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs),
+		"expected %v snapshots after second copy, got %v", len(snapshotIDs), len(copiedSnapshotIDs))
+
+	repo, err := OpenRepository(env2.gopts)
+	rtest.OK(t, err)
+
+	for i, snapshotID := range copiedSnapshotIDs {
+		restoredir := filepath.Join(env.base, fmt.Sprintf("restore%d", i))
+		testRunRestore(t, env2.gopts, restoredir, snapshotID)
+
+		sn, err := restic.LoadSnapshot(env2.gopts.ctx, repo, snapshotID)
+		rtest.OK(t, err)
+		rtest.Assert(t, sn.Original != nil, "copied snapshot %v has no original ID", snapshotID.Str())
+
+		origdir := filepath.Join(env.base, fmt.Sprintf("orig%d", i))
+		testRunRestore(t, env.gopts, origdir, *sn.Original)
+		rtest.Assert(t, directoriesEqualContents(origdir, restoredir),
+			"restored copy of snapshot %v differs from the original", sn.Original.Str())
+	}
+}
+
+func TestInitCopyChunkerParams(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testRunInit(t, env2.gopts)
+
+	passwordFile := filepath.Join(env.base, "secondary-password")
+	rtest.OK(t, ioutil.WriteFile(passwordFile, []byte(env2.gopts.password), 0600))
+
+	initOpts := InitOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			FromRepo:         env2.gopts.Repo,
+			FromPasswordFile: passwordFile,
+		},
+		RepositoryVersion: "stable",
+		Compression:       "auto",
+		CopyChunkerParams: true,
+	}
+	rtest.OK(t, runInit(initOpts, env.gopts, nil))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+
+	otherRepo, err := OpenRepository(env2.gopts)
+	rtest.OK(t, err)
+
+	rtest.Assert(t, repo.Config().ChunkerPolynomial == otherRepo.Config().ChunkerPolynomial,
+		"expected equal chunker polynomials, got %v and %v",
+		repo.Config().ChunkerPolynomial, otherRepo.Config().ChunkerPolynomial)
+}
+
+func testRunStats(t testing.TB, mode string, gopts GlobalOptions) statsContainer {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+
+	rtest.OK(t, runStats(StatsOptions{Mode: mode}, gopts, nil))
+
+	var stats statsContainer
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &stats))
+	return stats
+}
+
+func TestStats(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+
+	stat := dirStats(env.testdata)
+
+	stats := testRunStats(t, countModeRestoreSize, env.gopts)
+	rtest.Equals(t, 1, stats.SnapshotsCount)
+	rtest.Equals(t, uint64(stat.files), stats.TotalFileCount)
+	rtest.Equals(t, stat.size, stats.TotalSize)
+
+	uniqueStats := testRunStats(t, countModeUniqueFilesByID, env.gopts)
+	rtest.Assert(t, uniqueStats.TotalFileCount > 0 && uniqueStats.TotalFileCount <= stats.TotalFileCount,
+		"unexpected number of unique files %v", uniqueStats.TotalFileCount)
+
+	rawStats := testRunStats(t, countModeRawData, env.gopts)
+	rtest.Assert(t, rawStats.TotalBlobCount > 0, "no blobs counted")
+
+	// a second snapshot of the same data doubles the restore size, but does
+	// not change the number of unique files and blobs
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+
+	stats2 := testRunStats(t, countModeRestoreSize, env.gopts)
+	rtest.Equals(t, 2, stats2.SnapshotsCount)
+	rtest.Equals(t, 2*stats.TotalSize, stats2.TotalSize)
+
+	uniqueStats2 := testRunStats(t, countModeUniqueFilesByID, env.gopts)
+	rtest.Equals(t, uniqueStats.TotalFileCount, uniqueStats2.TotalFileCount)
+	rtest.Equals(t, uniqueStats.TotalSize, uniqueStats2.TotalSize)
+
+	rawStats2 := testRunStats(t, countModeRawData, env.gopts)
+	rtest.Equals(t, rawStats.TotalBlobCount, rawStats2.TotalBlobCount)
+	rtest.Equals(t, rawStats.TotalSize, rawStats2.TotalSize)
+}
+
 func TestBackupNonExistingFile(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -407,6 +722,148 @@ func TestBackupExclude(t *testing.T) {
 		"expected file %q not in first snapshot, but it's included", "passwords.txt")
 }
 
+func TestBackupExcludeSizeAndAge(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	old := time.Now().AddDate(0, -2, 0)
+	for _, f := range []struct {
+		name string
+		size int
+		old  bool
+	}{
+		{"small", 100, false},
+		{"large.img", 20000, false},
+		{"scratch/old", 100, true},
+		{"scratch/new", 100, false},
+	} {
+		fp := filepath.Join(datadir, f.name)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		rtest.OK(t, ioutil.WriteFile(fp, make([]byte, f.size), 0644))
+		if f.old {
+			rtest.OK(t, os.Chtimes(fp, old, old))
+		}
+	}
+
+	opts := BackupOptions{
+		ExcludeLargerThan: "10k",
+		ExcludeOlderThan:  restic.Duration{Months: 1},
+	}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	_, snapshotID := lastSnapshot(make(map[string]struct{}), loadSnapshotMap(t, env.gopts))
+	files := testRunLs(t, env.gopts, snapshotID)
+
+	for name, included := range map[string]bool{
+		"small":       true,
+		"large.img":   false,
+		"scratch":     true,
+		"scratch/old": false,
+		"scratch/new": true,
+	} {
+		p := filepath.Join(string(filepath.Separator), "testdata", filepath.FromSlash(name))
+		rtest.Assert(t, includes(files, p) == included, "wrong inclusion status of %v: want %v", name, included)
+	}
+}
+
+func TestBackupIgnoreFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	for name, data := range map[string]string{
+		".resticignore":        "*.tmp\nnode_modules/\n",
+		"work/main.go":         "package main",
+		"work/scratch.tmp":     "scratch",
+		"work/node_modules/x":  "x",
+		"work/.resticignore":   "!keep.tmp\n",
+		"work/keep.tmp":        "keep",
+		"private/notes.tmp":    "notes",
+		"private/node_modules": "not a directory",
+	} {
+		fp := filepath.Join(datadir, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		rtest.OK(t, ioutil.WriteFile(fp, []byte(data), 0644))
+	}
+
+	opts := BackupOptions{IgnoreFiles: []string{".resticignore"}}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	_, snapshotID := lastSnapshot(make(map[string]struct{}), loadSnapshotMap(t, env.gopts))
+	files := testRunLs(t, env.gopts, snapshotID)
+
+	for name, included := range map[string]bool{
+		".resticignore":        true,
+		"work/main.go":         true,
+		"work/scratch.tmp":     false,
+		"work/node_modules":    false,
+		"work/keep.tmp":        true,
+		"private/notes.tmp":    false,
+		"private/node_modules": true,
+	} {
+		p := filepath.Join(string(filepath.Separator), "testdata", filepath.FromSlash(name))
+		rtest.Assert(t, includes(files, p) == included, "wrong inclusion status of %v: want %v", name, included)
+	}
+}
+
+func TestBackupFilesFromRawAndVerbatim(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(datadir, 0755))
+
+	names := []string{"#hash", " leading space", "trailing space ", "star*", "with\nnewline"}
+	for _, name := range names {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, name), []byte(name), 0644))
+	}
+
+	var raw, verbatim []string
+	for _, name := range names {
+		raw = append(raw, filepath.Join(datadir, name))
+		if !strings.Contains(name, "\n") {
+			verbatim = append(verbatim, filepath.Join(datadir, name))
+		}
+	}
+
+	rawFile := filepath.Join(env.base, "files-raw")
+	rtest.OK(t, ioutil.WriteFile(rawFile, []byte(strings.Join(raw, "\x00")+"\x00"), 0644))
+	verbatimFile := filepath.Join(env.base, "files-verbatim")
+	rtest.OK(t, ioutil.WriteFile(verbatimFile, []byte(strings.Join(verbatim, "\n")+"\n"), 0644))
+
+	snapshots := make(map[string]struct{})
+	for _, test := range []struct {
+		opts  BackupOptions
+		names []string
+	}{
+		{BackupOptions{FilesFromRaw: rawFile}, raw},
+		{BackupOptions{FilesFromVerbatim: verbatimFile}, verbatim},
+	} {
+		testRunBackup(t, "", nil, test.opts, env.gopts)
+		var snapshotID string
+		snapshots, snapshotID = lastSnapshot(snapshots, loadSnapshotMap(t, env.gopts))
+
+		for _, sn := range testRunSnapshotsFiltered(t, SnapshotOptions{}, env.gopts) {
+			if sn.ID.String() == snapshotID {
+				rtest.Equals(t, uint(len(test.names)), sn.Summary.TotalFilesProcessed)
+			}
+		}
+
+		files := testRunLs(t, env.gopts, snapshotID)
+		for _, name := range test.names {
+			if strings.Contains(name, "\n") {
+				continue
+			}
+			rtest.Assert(t, includes(files, name), "file %q not found in snapshot", name)
+		}
+	}
+}
+
 const (
 	incrementalFirstWrite  = 10 * 1042 * 1024
 	incrementalSecondWrite = 1 * 1042 * 1024
@@ -578,36 +1035,235 @@ func TestTag(t *testing.T) {
 		"expected original ID to be set to the first snapshot id")
 }
 
-func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
+func testRunSnapshotsFiltered(t testing.TB, opts SnapshotOptions, gopts GlobalOptions) []Snapshot {
 	buf := bytes.NewBuffer(nil)
-
 	globalOptions.stdout = buf
+	globalOptions.JSON = true
 	defer func() {
 		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = gopts.JSON
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"list"}))
+	rtest.OK(t, runSnapshots(opts, globalOptions, []string{}))
 
-	scanner := bufio.NewScanner(buf)
-	exp := regexp.MustCompile(`^ ([a-f0-9]+) `)
+	snapshots := []Snapshot{}
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &snapshots))
+	return snapshots
+}
 
-	IDs := []string{}
-	for scanner.Scan() {
-		if id := exp.FindStringSubmatch(scanner.Text()); id != nil {
-			IDs = append(IDs, id[1])
-		}
+func TestSnapshotLabels(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	opts := BackupOptions{
+		Description: "before the upgrade",
+		Labels:      restic.Labels{"reason": "pre-upgrade", "ticket": "1234"},
 	}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{Labels: restic.Labels{"ticket": "5678"}}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
 
-	return IDs
-}
+	snapshots := testRunSnapshotsFiltered(t, SnapshotOptions{Labels: restic.Labels{"ticket": "1234"}}, env.gopts)
+	rtest.Assert(t, len(snapshots) == 1, "expected one snapshot with label ticket=1234, got %v", len(snapshots))
+	rtest.Equals(t, "before the upgrade", snapshots[0].Description)
+	rtest.Equals(t, restic.Labels{"reason": "pre-upgrade", "ticket": "1234"}, snapshots[0].Labels)
+
+	// modify labels and the description of the first snapshot
+	testRunTag(t, TagOptions{
+		Labels:         restic.Labels{"ticket": "1234"},
+		AddLabels:      restic.Labels{"reason": "upgrade"},
+		RemoveLabels:   []string{"ticket"},
+		SetDescription: true,
+	}, env.gopts)
+	testRunCheck(t, env.gopts)
 
-func testRunKeyAddNewKey(t testing.TB, newPassword string, gopts GlobalOptions) {
+	snapshots = testRunSnapshotsFiltered(t, SnapshotOptions{Labels: restic.Labels{"reason": "upgrade"}}, env.gopts)
+	rtest.Assert(t, len(snapshots) == 1, "expected one snapshot with label reason=upgrade, got %v", len(snapshots))
+	rtest.Equals(t, "", snapshots[0].Description)
+	rtest.Equals(t, restic.Labels{"reason": "upgrade"}, snapshots[0].Labels)
+
+	snapshots = testRunSnapshotsFiltered(t, SnapshotOptions{Labels: restic.Labels{"ticket": "1234"}}, env.gopts)
+	rtest.Assert(t, len(snapshots) == 0, "expected no snapshot with label ticket=1234, got %v", len(snapshots))
+
+	// each value of the label forms a separate group, so one snapshot is
+	// kept for each of them
+	forgetOpts := ForgetOptions{Last: 1, GroupBy: "label:reason"}
+	rtest.OK(t, runForget(forgetOpts, PruneOptions{}, env.gopts, []string{}))
+	snapshots = testRunSnapshotsFiltered(t, SnapshotOptions{}, env.gopts)
+	rtest.Assert(t, len(snapshots) == 2, "expected two snapshots after forget, got %v", len(snapshots))
+
+	forgetOpts.GroupBy = "label:"
+	err := runForget(forgetOpts, PruneOptions{}, env.gopts, []string{})
+	rtest.Assert(t, err != nil, "forget with invalid grouping option did not fail")
+}
+
+func TestProtectedSnapshots(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, filepath.Join("testdata", "backup-data.tar.gz"))
+
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{Labels: restic.Labels{"release": "1.0"}}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	selectOpts := TagOptions{Labels: restic.Labels{"release": "1.0"}}
+
+	opts := selectOpts
+	opts.Protect = true
+	opts.Unprotect = true
+	rtest.Assert(t, runTag(opts, env.gopts, []string{}) != nil, "tag with --protect and --unprotect did not fail")
+
+	opts.Unprotect = false
+	testRunTag(t, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	snapshots := testRunSnapshotsFiltered(t, SnapshotOptions{Labels: restic.Labels{"release": "1.0"}}, env.gopts)
+	rtest.Assert(t, len(snapshots) == 1, "expected one snapshot with label release=1.0, got %v", len(snapshots))
+	rtest.Assert(t, snapshots[0].Protected, "snapshot was not protected")
+	protected := snapshots[0].ID.String()
+
+	// neither the policy nor the explicit ID removes the protected snapshot
+	rtest.OK(t, runForget(ForgetOptions{Last: 1}, PruneOptions{}, env.gopts, []string{}))
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	testRunForget(t, env.gopts, protected)
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	opts = selectOpts
+	opts.Unprotect = true
+	testRunTag(t, opts, env.gopts)
+
+	// changing the snapshot saves it with a new ID
+	snapshots = testRunSnapshotsFiltered(t, SnapshotOptions{Labels: restic.Labels{"release": "1.0"}}, env.gopts)
+	rtest.Assert(t, len(snapshots) == 1, "expected one snapshot with label release=1.0, got %v", len(snapshots))
+	rtest.Assert(t, !snapshots[0].Protected, "snapshot is still protected")
+
+	testRunForget(t, env.gopts, snapshots[0].ID.String())
+	rtest.Equals(t, 1, len(testRunList(t, "snapshots", env.gopts)))
+}
+
+func TestForgetKeepWithin(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, filepath.Join("testdata", "backup-data.tar.gz"))
+
+	for _, ts := range []string{"2018-01-01 10:00:00", "2018-01-10 10:00:00", "2018-01-14 10:00:00", "2018-01-15 10:00:00"} {
+		testRunBackup(t, "", []string{env.testdata}, BackupOptions{TimeStamp: ts}, env.gopts)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	opts := ForgetOptions{GroupBy: "host,paths"}
+	rtest.OK(t, opts.Within.Set("2d"))
+	rtest.OK(t, opts.WithinWeekly.Set("1m"))
+	gopts := env.gopts
+	gopts.Quiet = false
+	rtest.OK(t, runForget(opts, PruneOptions{}, gopts, []string{}))
+
+	out := buf.String()
+	t.Logf("forget output:\n%s", out)
+	rtest.Assert(t, strings.Contains(out, "Reasons"), "forget output does not contain the reasons: %q", out)
+	rtest.Assert(t, strings.Contains(out, "within 2d"), "forget output does not contain the within reason: %q", out)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 3, "expected 3 snapshots, got %v", len(snapshotIDs))
+}
+
+func TestForgetPolicyFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, filepath.Join("testdata", "backup-data.tar.gz"))
+
+	for _, host := range []string{"db-1", "laptop"} {
+		for _, ts := range []string{"2018-01-01 10:00:00", "2018-01-02 10:00:00", "2018-01-03 10:00:00"} {
+			opts := BackupOptions{Hostname: host, TimeStamp: ts}
+			testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+		}
+	}
+
+	policyFile := filepath.Join(env.base, "policy.json")
+	rtest.OK(t, ioutil.WriteFile(policyFile, []byte(`{
+		"rules": [
+			{"name": "databases", "host": "db-*", "keep": {"last": 2}},
+			{"host": "laptop", "keep": {"last": 1}}
+		]
+	}`), 0600))
+
+	opts := ForgetOptions{PolicyFile: policyFile, GroupBy: "host,paths", DryRun: true}
+	rtest.OK(t, runForget(opts, PruneOptions{}, env.gopts, []string{}))
+	rtest.Equals(t, 6, len(testRunList(t, "snapshots", env.gopts)))
+
+	opts.DryRun = false
+	rtest.OK(t, runForget(opts, PruneOptions{}, env.gopts, []string{}))
+
+	_, snapshots := testRunSnapshots(t, env.gopts)
+	hosts := make(map[string]int)
+	for _, sn := range snapshots {
+		hosts[sn.Hostname]++
+	}
+	rtest.Equals(t, map[string]int{"db-1": 2, "laptop": 1}, hosts)
+
+	// snapshots which are not selected by any rule are kept
+	rtest.OK(t, ioutil.WriteFile(policyFile, []byte(`{"rules": [{"host": "db-*", "keep": {"last": 1}}]}`), 0600))
+	rtest.OK(t, runForget(opts, PruneOptions{}, env.gopts, []string{}))
+
+	_, snapshots = testRunSnapshots(t, env.gopts)
+	hosts = make(map[string]int)
+	for _, sn := range snapshots {
+		hosts[sn.Hostname]++
+	}
+	rtest.Equals(t, map[string]int{"db-1": 1, "laptop": 1}, hosts)
+
+	// the policy file cannot be combined with policy options
+	opts.Last = 1
+	err := runForget(opts, PruneOptions{}, env.gopts, []string{})
+	rtest.Assert(t, err != nil, "forget with --policy-file and --keep-last did not fail")
+}
+
+func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
+	buf := bytes.NewBuffer(nil)
+
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"list"}))
+
+	scanner := bufio.NewScanner(buf)
+	exp := regexp.MustCompile(`^ ([a-f0-9]+) `)
+
+	IDs := []string{}
+	for scanner.Scan() {
+		if id := exp.FindStringSubmatch(scanner.Text()); id != nil {
+			IDs = append(IDs, id[1])
+		}
+	}
+
+	return IDs
+}
+
+func testRunKeyAddNewKey(t testing.TB, newPassword string, gopts GlobalOptions) {
 	testKeyNewPassword = newPassword
 	defer func() {
 		testKeyNewPassword = ""
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"add"}))
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"add"}))
 }
 
 func testRunKeyPasswd(t testing.TB, newPassword string, gopts GlobalOptions) {
@@ -616,13 +1272,13 @@ func testRunKeyPasswd(t testing.TB, newPassword string, gopts GlobalOptions) {
 		testKeyNewPassword = ""
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"passwd"}))
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"passwd"}))
 }
 
 func testRunKeyRemove(t testing.TB, gopts GlobalOptions, IDs []string) {
 	t.Logf("remove %d keys: %q\n", len(IDs), IDs)
 	for _, id := range IDs {
-		rtest.OK(t, runKey(gopts, []string{"remove", id}))
+		rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"remove", id}))
 	}
 }
 
@@ -650,7 +1306,226 @@ func TestKeyAddRemove(t *testing.T) {
 
 	env.gopts.password = passwordList[len(passwordList)-1]
 	t.Logf("testing access with last password %q\n", env.gopts.password)
-	rtest.OK(t, runKey(env.gopts, []string{"list"}))
+	rtest.OK(t, runKey(KeyOptions{}, env.gopts, []string{"list"}))
+	testRunCheck(t, env.gopts)
+}
+
+func testRunKeyListJSON(t testing.TB, gopts GlobalOptions) []keyInfo {
+	buf := bytes.NewBuffer(nil)
+
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	gopts.JSON = true
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"list"}))
+
+	var keys []keyInfo
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &keys))
+	return keys
+}
+
+func TestKeyMetadata(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	testKeyNewPassword = "geheim2"
+	defer func() {
+		testKeyNewPassword = ""
+	}()
+
+	opts := KeyOptions{Username: "backup", Hostname: "server", Comment: "nightly backups", Expires: "2100-01-01"}
+	rtest.OK(t, runKey(opts, env.gopts, []string{"add"}))
+
+	keys := testRunKeyListJSON(t, env.gopts)
+	rtest.Equals(t, 2, len(keys))
+
+	var current, added keyInfo
+	for _, k := range keys {
+		if k.Current {
+			current = k
+		} else {
+			added = k
+		}
+	}
+	rtest.Equals(t, "backup", added.Username)
+	rtest.Equals(t, "server", added.Hostname)
+	rtest.Equals(t, "nightly backups", added.Comment)
+	rtest.Assert(t, added.Expires != nil && added.Expires.Year() == 2100, "wrong expiry date %v", added.Expires)
+
+	// expiry dates in the past are rejected
+	rtest.Assert(t, runKey(KeyOptions{Expires: "2000-01-01"}, env.gopts, []string{"add"}) != nil,
+		"key with expiry date in the past was added")
+
+	// the key currently in use is only removed with --force
+	rtest.Assert(t, runKey(KeyOptions{}, env.gopts, []string{"remove", current.ID}) != nil,
+		"current key was removed without --force")
+	rtest.OK(t, runKey(KeyOptions{Force: true}, env.gopts, []string{"remove", current.ID}))
+
+	env.gopts.password = "geheim2"
+	keys = testRunKeyListJSON(t, env.gopts)
+	rtest.Equals(t, 1, len(keys))
+
+	// the last key is never removed
+	rtest.Assert(t, runKey(KeyOptions{Force: true}, env.gopts, []string{"remove", keys[0].ID}) != nil,
+		"last key was removed")
+
+	// changing the password keeps the metadata
+	testRunKeyPasswd(t, "geheim3", env.gopts)
+	env.gopts.password = "geheim3"
+	keys = testRunKeyListJSON(t, env.gopts)
+	rtest.Equals(t, 1, len(keys))
+	rtest.Equals(t, "nightly backups", keys[0].Comment)
+	rtest.Assert(t, keys[0].Expires != nil, "expiry date was not kept")
+}
+
+func TestPasswordCommand(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	gopts := env.gopts
+	gopts.password = ""
+	gopts.PasswordCommand = "echo " + env.gopts.password
+	pwd, err := resolvePassword(gopts, "RESTIC_PASSWORD")
+	rtest.OK(t, err)
+	rtest.Equals(t, env.gopts.password, pwd)
+
+	gopts.PasswordFile = filepath.Join(env.base, "password")
+	_, err = resolvePassword(gopts, "RESTIC_PASSWORD")
+	rtest.Assert(t, err != nil, "password file and command were accepted at the same time")
+
+	// a failing command is an error
+	gopts.PasswordFile = ""
+	gopts.PasswordCommand = "false"
+	_, err = resolvePassword(gopts, "RESTIC_PASSWORD")
+	rtest.Assert(t, err != nil, "failing password command was accepted")
+
+	// the new password for a key can be read from a command
+	newPasswordCommand = "echo geheim2"
+	defer func() {
+		newPasswordCommand = ""
+	}()
+	rtest.OK(t, runKey(KeyOptions{}, env.gopts, []string{"passwd"}))
+
+	env.gopts.password = "geheim2"
+	testRunCheck(t, env.gopts)
+}
+
+func TestKeyKDF(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	initOpts := InitOptions{
+		RepositoryVersion: "stable",
+		Compression:       "auto",
+		kdfOptions:        kdfOptions{KDF: "argon2id", Time: 1, MemoryMiB: 1, P: 1},
+	}
+	rtest.OK(t, runInit(initOpts, env.gopts, nil))
+
+	keys := testRunKeyListJSON(t, env.gopts)
+	rtest.Equals(t, 1, len(keys))
+	rtest.Equals(t, "argon2id", keys[0].KDF)
+
+	testKeyNewPassword = "geheim2"
+	defer func() {
+		testKeyNewPassword = ""
+	}()
+
+	scrypt := kdfOptions{KDF: "scrypt", N: 1024, R: 1, P: 1}
+	rtest.OK(t, runKey(KeyOptions{kdfOptions: scrypt}, env.gopts, []string{"add"}))
+	keys = testRunKeyListJSON(t, env.gopts)
+	rtest.Equals(t, 2, len(keys))
+	for _, k := range keys {
+		if !k.Current {
+			rtest.Equals(t, "scrypt", k.KDF)
+		}
+	}
+
+	// the current key is derived again with scrypt, the password stays the same
+	rtest.OK(t, runKey(KeyOptions{kdfOptions: scrypt, ReKDF: true}, env.gopts, []string{"passwd"}))
+	keys = testRunKeyListJSON(t, env.gopts)
+	rtest.Equals(t, 2, len(keys))
+	for _, k := range keys {
+		rtest.Equals(t, "scrypt", k.KDF)
+	}
+	testRunCheck(t, env.gopts)
+
+	// invalid combinations of options are rejected
+	for _, opts := range []KeyOptions{
+		{kdfOptions: kdfOptions{KDF: "argon2id", N: 1024}},
+		{kdfOptions: kdfOptions{KDF: "scrypt", MemoryMiB: 1}},
+		{kdfOptions: kdfOptions{KDF: "bcrypt"}},
+		{kdfOptions: kdfOptions{N: 1000}},
+		{ReKDF: true},
+	} {
+		rtest.Assert(t, runKey(opts, env.gopts, []string{"add"}) != nil,
+			"key add with invalid options %v did not fail", opts)
+	}
+}
+
+func TestWriteOnlyKey(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	rtest.OK(t, runInit(InitOptions{RepositoryVersion: "3", Compression: "auto"}, env.gopts, nil))
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	opts := BackupOptions{}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Join("testdata", "0", "0", "9")}, opts, env.gopts)
+
+	testKeyNewPassword = "write-only"
+	defer func() {
+		testKeyNewPassword = ""
+	}()
+
+	// write-only keys require repository version 4
+	rtest.Assert(t, runKey(KeyOptions{WriteOnly: true}, env.gopts, []string{"add"}) != nil,
+		"write-only key was added to repository with version 3")
+	rtest.OK(t, runMigrate(MigrateOptions{}, env.gopts, []string{"upgrade_repo_v4"}))
+	testRunCheck(t, env.gopts)
+
+	rtest.OK(t, runKey(KeyOptions{WriteOnly: true}, env.gopts, []string{"add"}))
+	keys := testRunKeyListJSON(t, env.gopts)
+	rtest.Equals(t, 2, len(keys))
+	for _, k := range keys {
+		rtest.Equals(t, !k.Current, k.WriteOnly)
+	}
+
+	wgopts := env.gopts
+	wgopts.password = "write-only"
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, wgopts)
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", wgopts)))
+
+	// the write-only key cannot read data or manage keys
+	rtest.Assert(t, runSnapshots(SnapshotOptions{}, wgopts, nil) != nil,
+		"listing snapshots with a write-only key did not fail")
+	rtest.Assert(t, runRestore(RestoreOptions{Target: filepath.Join(env.base, "restore")}, wgopts, []string{"latest"}) != nil,
+		"restoring with a write-only key did not fail")
+	rtest.Assert(t, runKey(KeyOptions{}, wgopts, []string{"list"}) != nil,
+		"listing keys with a write-only key did not fail")
+
+	// the data saved with the write-only key can be read with the password
+	testRunCheck(t, env.gopts)
+	newest, _ := testRunSnapshots(t, env.gopts)
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, *newest.ID)
+	rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+		"directories are not equal")
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
 	testRunCheck(t, env.gopts)
 }
 
@@ -717,6 +1592,73 @@ func TestRestoreFilter(t *testing.T) {
 	}
 }
 
+func TestRestoreFilterNegationAndCase(t *testing.T) {
+	testfiles := []string{
+		"Photos/IMG1.JPG",
+		"photos/img2.jpg",
+		"logs/debug.log",
+		"logs/important.log",
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for _, name := range testfiles {
+		p := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, 100))
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshotID := testRunList(t, "snapshots", env.gopts)[0]
+
+	for i, test := range []struct {
+		opts     RestoreOptions
+		restored []string
+	}{
+		{
+			RestoreOptions{Exclude: []string{"*.log", "!important.log"}},
+			[]string{"Photos/IMG1.JPG", "photos/img2.jpg", "logs/important.log"},
+		},
+		{
+			RestoreOptions{InsensitiveExclude: []string{"*.jpg"}},
+			[]string{"logs/debug.log", "logs/important.log"},
+		},
+		{
+			RestoreOptions{Include: []string{"*.log", "!debug.log"}},
+			[]string{"logs/important.log"},
+		},
+		{
+			RestoreOptions{InsensitiveInclude: []string{"*.JPG"}},
+			[]string{"Photos/IMG1.JPG", "photos/img2.jpg"},
+		},
+	} {
+		base := filepath.Join(env.base, fmt.Sprintf("restore%d", i))
+		opts := test.opts
+		opts.Target = base
+		rtest.OK(t, runRestore(opts, env.gopts, []string{snapshotID.String()}))
+
+		for _, name := range testfiles {
+			_, err := os.Lstat(filepath.Join(base, "testdata", filepath.FromSlash(name)))
+			restored := false
+			for _, r := range test.restored {
+				restored = restored || r == name
+			}
+			rtest.Assert(t, restored == (err == nil), "test %d: wrong restore status of %v: want %v, err %v", i, name, restored, err)
+		}
+	}
+
+	opts := RestoreOptions{
+		Target:             filepath.Join(env.base, "restore-invalid"),
+		Exclude:            []string{"*.log"},
+		InsensitiveInclude: []string{"*.jpg"},
+	}
+	err := runRestore(opts, env.gopts, []string{snapshotID.String()})
+	rtest.Assert(t, err != nil, "restore with exclude and include patterns did not fail")
+}
+
 func TestRestore(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1024,6 +1966,79 @@ func TestCheckRestoreNoLock(t *testing.T) {
 	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
 }
 
+// damagePackFiles flips some bits in all pack files of the repository.
+func damagePackFiles(t testing.TB, repodir string) {
+	err := filepath.Walk(filepath.Join(repodir, "data"), func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+
+		buf, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < 32 && i < len(buf); i++ {
+			buf[i] ^= 0xff
+		}
+
+		rtest.OK(t, os.Chmod(p, 0600))
+		return ioutil.WriteFile(p, buf, 0600)
+	})
+	rtest.OK(t, err)
+}
+
+func TestCheckRepairParity(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+
+	initOpts := InitOptions{
+		RepositoryVersion: "stable",
+		Compression:       "auto",
+		DataShards:        10,
+		ParityShards:      2,
+	}
+	rtest.OK(t, runInit(initOpts, env.gopts, nil))
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	backupDir := filepath.Join(env.testdata, "0", "0", "9")
+	testRunBackup(t, "", []string{backupDir}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	damagePackFiles(t, env.repo)
+
+	_, err = testRunCheckOutput(env.gopts)
+	rtest.Assert(t, err != nil, "expected check to fail for a repository with damaged packs")
+
+	// damaged blobs are reconstructed transparently
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotIDs[0])
+	rtest.Assert(t, directoriesEqualContents(backupDir, filepath.Join(restoredir, backupDir)),
+		"directories are not equal")
+
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true, RepairPacks: true}, env.gopts, nil))
+	testRunCheck(t, env.gopts)
+
+	// the copies of the repaired packs are removed after replacing the packs
+	entries, err := ioutil.ReadDir(filepath.Join(env.repo, "repair"))
+	rtest.OK(t, err)
+	rtest.Assert(t, len(entries) == 0, "expected no files in repair/, got %d", len(entries))
+}
+
 func TestPrune(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1055,8 +2070,458 @@ func TestPrune(t *testing.T) {
 		"expected 3 snapshot, got %v", snapshotIDs)
 
 	testRunForget(t, env.gopts, firstSnapshot[0].String())
-	testRunPrune(t, env.gopts)
+
+	// a dry run must not modify the repository
+	packsBefore := testRunList(t, "packs", env.gopts)
+	testRunPrune(t, env.gopts, PruneOptions{DryRun: true, MaxUnused: "0%"})
+	rtest.Equals(t, packsBefore, testRunList(t, "packs", env.gopts))
+
+	// unused data may remain in the repository, so don't check for it
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "5%"})
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil))
+
+	// with a limit of 0% all unused blobs must be removed
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
 	testRunCheck(t, env.gopts)
+
+	// without a grace period, packs are removed right away and not marked
+	rtest.Equals(t, 0, len(testListDeletions(t, env.gopts)))
+
+	rawStats := testRunStats(t, countModeRawData, env.gopts)
+	rtest.Equals(t, rawStats.TotalBlobCount, testCountIndexBlobs(t, env.gopts))
+
+	// a second run does not find anything to do
+	packsBefore = testRunList(t, "packs", env.gopts)
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	rtest.Equals(t, packsBefore, testRunList(t, "packs", env.gopts))
+}
+
+func testCountIndexBlobs(t testing.TB, gopts GlobalOptions) uint64 {
+	repo, err := OpenRepository(gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(gopts.ctx))
+
+	var n uint64
+	for range repo.Index().Each(gopts.ctx) {
+		n++
+	}
+	return n
+}
+
+func TestPruneMaxRepackSize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	opts := BackupOptions{}
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+
+	// with a repack limit of one byte no pack can be repacked, only unused
+	// packs are removed
+	blobsBefore := testCountIndexBlobs(t, env.gopts)
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%", MaxRepackSize: "1"})
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil))
+
+	blobsAfter := testCountIndexBlobs(t, env.gopts)
+	rawStats := testRunStats(t, countModeRawData, env.gopts)
+	rtest.Assert(t, blobsAfter <= blobsBefore, "prune added blobs: %v > %v", blobsAfter, blobsBefore)
+	rtest.Assert(t, blobsAfter >= rawStats.TotalBlobCount, "prune removed used blobs")
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	testRunCheck(t, env.gopts)
+	rtest.Equals(t, rawStats.TotalBlobCount, testCountIndexBlobs(t, env.gopts))
+}
+
+// testListDeletions returns the IDs of all deletion marks in the repository.
+func testListDeletions(t testing.TB, gopts GlobalOptions) restic.IDs {
+	repo, err := OpenRepository(gopts)
+	rtest.OK(t, err)
+
+	var ids restic.IDs
+	rtest.OK(t, repo.List(gopts.ctx, restic.DeletionFile, func(id restic.ID, size int64) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	return ids
+}
+
+func TestPruneGracePeriod(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	opts := BackupOptions{}
+
+	backupDir := filepath.Join(env.testdata, "0", "0", "9")
+	testRunBackup(t, "", []string{backupDir}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(backupDir, "2")}, opts, env.gopts)
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(env.gopts.ctx, repo, firstSnapshot[0])
+	rtest.OK(t, err)
+
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+
+	// packs are only marked for deletion during the grace period
+	packsBefore := restic.NewIDSet(testRunList(t, "packs", env.gopts)...)
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%", GracePeriod: time.Hour})
+	packsAfter := restic.NewIDSet(testRunList(t, "packs", env.gopts)...)
+	rtest.Assert(t, len(packsBefore.Sub(packsAfter)) == 0, "packs were removed during the grace period")
+	rtest.Equals(t, 1, len(testListDeletions(t, env.gopts)))
+	testRunCheck(t, env.gopts)
+
+	// a backup which finishes after the packs have been marked may reference
+	// data stored in them, simulate this by saving the old snapshot again
+	_, err = repo.SaveJSONUnpacked(env.gopts.ctx, restic.SnapshotFile, sn)
+	rtest.OK(t, err)
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%", GracePeriod: time.Hour})
+	testRunCheck(t, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestoreLatest(t, env.gopts, restoredir, []string{backupDir}, "")
+	rtest.Assert(t, directoriesEqualContents(backupDir, filepath.Join(restoredir, backupDir)),
+		"directories are not equal")
+
+	// once the grace period has passed, the packs are deleted by the next run
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 2, len(snapshotIDs))
+	for _, id := range snapshotIDs {
+		if !id.Equal(firstSnapshot[0]) {
+			testRunForget(t, env.gopts, id.String())
+		}
+	}
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%", GracePeriod: time.Nanosecond})
+	rtest.Equals(t, 1, len(testListDeletions(t, env.gopts)))
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%", GracePeriod: time.Nanosecond})
+	rtest.Equals(t, 0, len(testListDeletions(t, env.gopts)))
+	testRunCheck(t, env.gopts)
+
+	// all remaining packs are referenced by the index
+	repo, err = OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(env.gopts.ctx))
+	indexPacks := restic.NewIDSet()
+	for pb := range repo.Index().Each(env.gopts.ctx) {
+		indexPacks.Insert(pb.PackID)
+	}
+	rtest.Equals(t, indexPacks, restic.NewIDSet(testRunList(t, "packs", env.gopts)...))
+}
+
+func TestPackSize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	// the pack size passed to init is stored in the config
+	initOpts := env.gopts
+	initOpts.PackSize = 1
+	testRunInit(t, initOpts)
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1024*1024), repo.Config().PackSize)
+	rtest.Equals(t, uint(1024*1024), repo.PackSize())
+
+	rtest.OK(t, os.MkdirAll(env.testdata, 0755))
+	for i := 0; i < 8; i++ {
+		rtest.OK(t, appendRandomData(filepath.Join(env.testdata, fmt.Sprintf("file%d", i)), 1024*1024))
+	}
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	packsBefore := testRunList(t, "packs", env.gopts)
+	rtest.Assert(t, len(packsBefore) > 2, "expected several packs, got %d", len(packsBefore))
+
+	// a larger pack size given for a single run overrides the config, prune
+	// combines the small packs into larger ones
+	pruneOpts := env.gopts
+	pruneOpts.PackSize = 32
+	testRunPrune(t, pruneOpts, PruneOptions{MaxUnused: "5%", RepackSmall: true})
+
+	packsAfter := testRunList(t, "packs", env.gopts)
+	rtest.Assert(t, len(packsAfter) < len(packsBefore),
+		"small packs were not combined, %d packs before and %d after prune", len(packsBefore), len(packsAfter))
+	testRunCheck(t, env.gopts)
+
+	repo, err = OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1024*1024), repo.Config().PackSize)
+
+	// invalid pack sizes are rejected
+	pruneOpts.PackSize = 1024
+	_, err = OpenRepository(pruneOpts)
+	rtest.Assert(t, err != nil, "expected error for invalid pack size")
+}
+
+func TestBackupWithExclusiveLock(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	lock, err := restic.NewExclusiveLock(env.gopts.ctx, repo)
+	rtest.OK(t, err)
+
+	// backup does not need to lock the repository
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	rtest.OK(t, lock.Unlock())
+	rtest.Equals(t, 1, len(testRunList(t, "snapshots", env.gopts)))
+}
+
+// removePacksOfType removes all pack files which contain blobs of type tpe.
+func removePacksOfType(t testing.TB, gopts GlobalOptions, tpe restic.BlobType) {
+	repo, err := OpenRepository(gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(gopts.ctx))
+
+	packs := restic.NewIDSet()
+	for pb := range repo.Index().Each(gopts.ctx) {
+		if pb.Type == tpe {
+			packs.Insert(pb.PackID)
+		}
+	}
+
+	for id := range packs {
+		rtest.OK(t, repo.Backend().Remove(gopts.ctx, restic.Handle{Type: restic.DataFile, Name: id.String()}))
+	}
+}
+
+func testRunRepairSnapshots(t testing.TB, gopts GlobalOptions, forget bool) {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	rtest.OK(t, runRepairSnapshots(RepairSnapshotsOptions{Forget: forget}, gopts, nil))
+}
+
+func TestRepairSnapshotsMissingData(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	oldSnapshots := testRunList(t, "snapshots", env.gopts)
+
+	removePacksOfType(t, env.gopts, restic.DataBlob)
+	testRunRebuildIndex(t, env.gopts)
+
+	_, err = testRunCheckOutput(env.gopts)
+	rtest.Assert(t, err != nil, "expected check to fail for a repository with missing data")
+
+	testRunRepairSnapshots(t, env.gopts, true)
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil))
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	rtest.Assert(t, !snapshotIDs[0].Equal(oldSnapshots[0]), "old snapshot was not removed")
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(env.gopts.ctx, repo, snapshotIDs[0])
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.HasTags([]string{"repaired"}), "repaired snapshot has tags %v", sn.Tags)
+	rtest.Assert(t, sn.Original != nil && sn.Original.Equal(oldSnapshots[0]),
+		"repaired snapshot has wrong original %v", sn.Original)
+
+	// a second run does not change anything
+	testRunRepairSnapshots(t, env.gopts, true)
+	rtest.Equals(t, snapshotIDs, testRunList(t, "snapshots", env.gopts))
+
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
+}
+
+func TestRepairSnapshotsMissingTrees(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+
+	removePacksOfType(t, env.gopts, restic.TreeBlob)
+	testRunRebuildIndex(t, env.gopts)
+
+	testRunRepairSnapshots(t, env.gopts, false)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+
+	// the old snapshot still references the missing trees
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	for _, id := range snapshotIDs {
+		sn, err := restic.LoadSnapshot(env.gopts.ctx, repo, id)
+		rtest.OK(t, err)
+		if !sn.HasTags([]string{"repaired"}) {
+			rtest.OK(t, repo.Backend().Remove(env.gopts.ctx, restic.Handle{Type: restic.SnapshotFile, Name: id.String()}))
+		}
+	}
+
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil))
+}
+
+func TestRecover(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	stats := testRunStats(t, countModeRestoreSize, env.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	testRunForget(t, env.gopts, snapshotIDs[0].String())
+
+	rtest.OK(t, runRecover(env.gopts))
+
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one recovered snapshot, got %v", snapshotIDs)
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(env.gopts.ctx, repo, snapshotIDs[0])
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.HasTags([]string{"recovered"}), "recovered snapshot has tags %v", sn.Tags)
+
+	recoveredStats := testRunStats(t, countModeRestoreSize, env.gopts)
+	rtest.Equals(t, stats.TotalFileCount, recoveredStats.TotalFileCount)
+	rtest.Equals(t, stats.TotalSize, recoveredStats.TotalSize)
+
+	testRunCheck(t, env.gopts)
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
+
+	// all trees are referenced now, so nothing is recovered
+	rtest.OK(t, runRecover(env.gopts))
+	rtest.Equals(t, snapshotIDs, testRunList(t, "snapshots", env.gopts))
+}
+
+func testRunRewriteExclude(t testing.TB, gopts GlobalOptions, excludes []string, forget bool) {
+	opts := RewriteOptions{
+		Excludes: excludes,
+		Forget:   forget,
+	}
+
+	rtest.OK(t, runRewrite(opts, gopts, nil))
+}
+
+func TestRewrite(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	backupDir := filepath.Join(env.testdata, "0", "0", "9")
+	testRunBackup(t, "", []string{backupDir}, BackupOptions{}, env.gopts)
+	oldSnapshots := testRunList(t, "snapshots", env.gopts)
+	stats := testRunStats(t, countModeRestoreSize, env.gopts)
+
+	// excluding a file which doesn't exist doesn't create a new snapshot
+	testRunRewriteExclude(t, env.gopts, []string{"does-not-exist"}, false)
+	rtest.Equals(t, oldSnapshots, testRunList(t, "snapshots", env.gopts))
+
+	excludedFile := filepath.Join(backupDir, "2")
+	testRunRewriteExclude(t, env.gopts, []string{excludedFile}, true)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	rtest.Assert(t, !snapshotIDs[0].Equal(oldSnapshots[0]), "old snapshot was not removed")
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(env.gopts.ctx, repo, snapshotIDs[0])
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.Original != nil && sn.Original.Equal(oldSnapshots[0]),
+		"rewritten snapshot has wrong original %v", sn.Original)
+
+	newStats := testRunStats(t, countModeRestoreSize, env.gopts)
+	rtest.Equals(t, stats.TotalFileCount-1, newStats.TotalFileCount)
+
+	// the data of the excluded file is still contained in the repository
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil))
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotIDs[0])
+	rtest.OK(t, os.Remove(excludedFile))
+	rtest.Assert(t, directoriesEqualContents(backupDir, filepath.Join(restoredir, backupDir)),
+		"restored directory does not match the original without the excluded file")
 }
 
 func TestHardLink(t *testing.T) {
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+
+	"github.com/spf13/pflag"
+)
+
+// kdfOptions bundles the options which select the key derivation function and
+// its parameters for new keys.
+type kdfOptions struct {
+	KDF       string
+	N         int
+	R         int
+	P         int
+	Time      int
+	MemoryMiB int
+}
+
+func initKDFOptions(f *pflag.FlagSet, opts *kdfOptions) {
+	f.StringVar(&opts.KDF, "kdf", "", "key derivation function for the new key, allowed values are 'scrypt' and 'argon2id' (default: scrypt with parameters calibrated for this machine)")
+	f.IntVar(&opts.N, "kdf-n", 0, "scrypt CPU/memory cost parameter `N`, must be a power of two")
+	f.IntVar(&opts.R, "kdf-r", 0, "scrypt block size parameter `r`")
+	f.IntVar(&opts.P, "kdf-p", 0, "parallelism parameter `p` for scrypt and Argon2id")
+	f.IntVar(&opts.Time, "kdf-time", 0, "number of passes `t` over the memory for Argon2id")
+	f.IntVar(&opts.MemoryMiB, "kdf-memory", 0, "memory size in `MiB` for Argon2id")
+}
+
+// params returns the KDF parameters selected by opts. When no option is set,
+// nil is returned, so the calibrated parameters are used.
+func (opts kdfOptions) params() (*crypto.Params, error) {
+	scryptSet := opts.N != 0 || opts.R != 0
+	argon2idSet := opts.Time != 0 || opts.MemoryMiB != 0
+
+	if opts.KDF == "" && !scryptSet && !argon2idSet && opts.P == 0 {
+		return nil, nil
+	}
+
+	var params crypto.Params
+	switch opts.KDF {
+	case "", crypto.KDFScrypt:
+		if argon2idSet {
+			return nil, errors.Fatal("--kdf-time and --kdf-memory can only be used with --kdf argon2id")
+		}
+
+		params = crypto.DefaultKDFParams
+		params.KDF = crypto.KDFScrypt
+		if opts.N != 0 {
+			params.N = opts.N
+		}
+		if opts.R != 0 {
+			params.R = opts.R
+		}
+	case crypto.KDFArgon2id:
+		if scryptSet {
+			return nil, errors.Fatal("--kdf-n and --kdf-r can only be used with --kdf scrypt")
+		}
+
+		params = crypto.DefaultArgon2idParams
+		if opts.Time != 0 {
+			params.T = opts.Time
+		}
+		if opts.MemoryMiB != 0 {
+			params.M = opts.MemoryMiB * 1024
+		}
+	default:
+		return nil, errors.Fatalf("invalid KDF %q, allowed values are 'scrypt' and 'argon2id'", opts.KDF)
+	}
+
+	if opts.P != 0 {
+		params.P = opts.P
+	}
+
+	if err := params.Check(); err != nil {
+		return nil, errors.Fatalf("invalid KDF parameters: %v", err)
+	}
+
+	return &params, nil
+}
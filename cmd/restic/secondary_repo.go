@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+
+	"github.com/spf13/pflag"
+)
+
+// secondaryRepoOptions bundles the options for commands which access a
+// second repository in addition to the one given by --repo.
+type secondaryRepoOptions struct {
+	FromRepo            string
+	FromPasswordFile    string
+	FromPasswordCommand string
+}
+
+func initSecondaryRepoOptions(f *pflag.FlagSet, opts *secondaryRepoOptions, repoUsage string) {
+	f.StringVar(&opts.FromRepo, "from-repo", os.Getenv("RESTIC_FROM_REPOSITORY"), repoUsage+" (default: $RESTIC_FROM_REPOSITORY)")
+	f.StringVar(&opts.FromPasswordFile, "from-password-file", os.Getenv("RESTIC_FROM_PASSWORD_FILE"), "read the password for the repository given by --from-repo from a `file` (default: $RESTIC_FROM_PASSWORD_FILE)")
+	f.StringVar(&opts.FromPasswordCommand, "from-password-command", os.Getenv("RESTIC_FROM_PASSWORD_COMMAND"), "run `command` and use its output as the password for the repository given by --from-repo (default: $RESTIC_FROM_PASSWORD_COMMAND)")
+}
+
+// openSecondaryRepository opens the repository given by --from-repo. The
+// password is read from --from-password-file, --from-password-command,
+// $RESTIC_FROM_PASSWORD or prompted for. The description is used in the password prompt.
+func openSecondaryRepository(opts secondaryRepoOptions, gopts GlobalOptions, description string) (*repository.Repository, error) {
+	if opts.FromRepo == "" {
+		return nil, errors.Fatalf("Please specify the %s repository location (--from-repo)", description)
+	}
+
+	secondaryGopts := gopts
+	secondaryGopts.Repo = opts.FromRepo
+	secondaryGopts.PasswordFile = opts.FromPasswordFile
+	secondaryGopts.PasswordCommand = opts.FromPasswordCommand
+
+	pwd, err := resolvePassword(secondaryGopts, "RESTIC_FROM_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+
+	secondaryGopts.password = pwd
+	if secondaryGopts.password == "" {
+		secondaryGopts.password, err = ReadPassword(secondaryGopts, fmt.Sprintf("enter password for %s repository: ", description))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return OpenRepository(secondaryGopts)
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"runtime"
 	"sort"
+	"sync"
 	"syscall"
 	"time"
 
@@ -41,6 +42,48 @@ func (s *ItemStats) Add(other ItemStats) {
 	s.TreeSize += other.TreeSize
 }
 
+// summary collects the statistics for the snapshot summary.
+type summary struct {
+	sync.Mutex
+	restic.SnapshotSummary
+}
+
+// add updates the summary for a completed item, current is nil for the root
+// tree of the snapshot.
+func (s *summary) add(previous, current *restic.Node, stats ItemStats) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.DataBlobs += stats.DataBlobs
+	s.TreeBlobs += stats.TreeBlobs
+	s.DataAdded += stats.DataSize + stats.TreeSize
+
+	if current == nil {
+		return
+	}
+
+	var newItems, changed, unmodified *uint
+	switch current.Type {
+	case "file":
+		newItems, changed, unmodified = &s.FilesNew, &s.FilesChanged, &s.FilesUnmodified
+		s.TotalFilesProcessed++
+		s.TotalBytesProcessed += current.Size
+	case "dir":
+		newItems, changed, unmodified = &s.DirsNew, &s.DirsChanged, &s.DirsUnmodified
+	default:
+		return
+	}
+
+	switch {
+	case previous == nil:
+		*newItems++
+	case previous.Equals(*current):
+		*unmodified++
+	default:
+		*changed++
+	}
+}
+
 // Archiver saves a directory structure to the repo.
 type Archiver struct {
 	Repo    restic.Repository
@@ -73,6 +116,18 @@ type Archiver struct {
 	// be saved. Enabling it may result in much metadata, so it's off by
 	// default.
 	WithAtime bool
+
+	// summary collects the statistics during Snapshot, it is nil otherwise.
+	summary *summary
+}
+
+// completeItem updates the summary and calls CompleteItem.
+func (arch *Archiver) completeItem(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
+	if arch.summary != nil {
+		arch.summary.add(previous, current, s)
+	}
+
+	arch.CompleteItem(item, previous, current, s, d)
 }
 
 // Options is used to configure the archiver.
@@ -377,7 +432,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		// use previous node if the file hasn't changed
 		if previous != nil && !fileChanged(fi, previous) {
 			debug.Log("%v hasn't changed, returning old node", target)
-			arch.CompleteItem(snPath, previous, previous, ItemStats{}, time.Since(start))
+			arch.completeItem(snPath, previous, previous, ItemStats{}, time.Since(start))
 			arch.CompleteBlob(snPath, previous.Size)
 			fn.node = previous
 			_ = file.Close()
@@ -389,7 +444,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		fn.file = arch.fileSaver.Save(ctx, snPath, file, fi, func() {
 			arch.StartFile(snPath)
 		}, func(node *restic.Node, stats ItemStats) {
-			arch.CompleteItem(snPath, previous, node, stats, time.Since(start))
+			arch.completeItem(snPath, previous, node, stats, time.Since(start))
 		})
 
 		file = nil
@@ -402,7 +457,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		oldSubtree := arch.loadSubtree(ctx, previous)
 		fn.node, fn.stats, err = arch.SaveDir(ctx, snPath, fi, target, oldSubtree)
 		if err == nil {
-			arch.CompleteItem(snItem, previous, fn.node, fn.stats, time.Since(start))
+			arch.completeItem(snItem, previous, fn.node, fn.stats, time.Since(start))
 		} else {
 			_ = file.Close()
 			return FutureNode{}, false, err
@@ -561,7 +616,7 @@ func (arch *Archiver) SaveTree(ctx context.Context, snPath string, atree *Tree,
 			return nil, err
 		}
 
-		arch.CompleteItem(snItem, oldNode, node, nodeStats, time.Since(start))
+		arch.completeItem(snItem, oldNode, node, nodeStats, time.Since(start))
 	}
 
 	// process all futures
@@ -684,6 +739,8 @@ func resolveRelativeTargets(fs fs.FS, targets []string) ([]string, error) {
 // SnapshotOptions collect attributes for a new snapshot.
 type SnapshotOptions struct {
 	Tags           []string
+	Description    string
+	Labels         restic.Labels
 	Hostname       string
 	Excludes       []string
 	Time           time.Time
@@ -748,6 +805,11 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
+	arch.summary = &summary{}
+	defer func() {
+		arch.summary = nil
+	}()
+
 	start := time.Now()
 	tree, err := arch.SaveTree(ctx, "/", atree, arch.loadParentTree(ctx, opts.ParentSnapshot))
 	if err != nil {
@@ -759,7 +821,7 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
-	arch.CompleteItem("/", nil, nil, stats, time.Since(start))
+	arch.completeItem("/", nil, nil, stats, time.Since(start))
 
 	err = arch.Repo.Flush(ctx)
 	if err != nil {
@@ -773,12 +835,19 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 	sn, err := restic.NewSnapshot(targets, opts.Tags, opts.Hostname, opts.Time)
 	sn.Excludes = opts.Excludes
+	sn.Description = opts.Description
+	sn.Labels = opts.Labels
 	if !opts.ParentSnapshot.IsNull() {
 		id := opts.ParentSnapshot
 		sn.Parent = &id
 	}
 	sn.Tree = &rootTreeID
 
+	summary := arch.summary.SnapshotSummary
+	sn.Summary = &summary
+	sn.Summary.BackupStart = start
+	sn.Summary.BackupEnd = time.Now()
+
 	id, err := arch.Repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
 	if err != nil {
 		return nil, restic.ID{}, err
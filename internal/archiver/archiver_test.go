@@ -1432,6 +1432,112 @@ func TestArchiverParent(t *testing.T) {
 	}
 }
 
+func TestArchiverSnapshotSummary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"subdir": TestDir{
+			"file1": TestFile{Content: "foo"},
+			"file2": TestFile{Content: "bar baz"},
+		},
+	}
+
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, src)
+	defer cleanup()
+
+	back := fs.TestChdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{fs.Local{}}, Options{})
+
+	sn, firstSnapshotID, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := restic.SnapshotSummary{
+		FilesNew:            2,
+		DirsNew:             1,
+		TotalFilesProcessed: 2,
+		TotalBytesProcessed: 10,
+	}
+	checkSnapshotSummary(t, sn, want)
+	if sn.Summary.DataBlobs != 2 || sn.Summary.TreeBlobs == 0 || sn.Summary.DataAdded == 0 {
+		t.Errorf("unexpected blob statistics for first snapshot: %+v", sn.Summary)
+	}
+
+	// modify one file and add a new one
+	for name, data := range map[string]string{"file2": "modified", "file3": "new file"} {
+		err = ioutil.WriteFile(filepath.Join(tempdir, "subdir", name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := SnapshotOptions{
+		Time:           time.Now(),
+		ParentSnapshot: firstSnapshotID,
+	}
+	sn, secondSnapshotID, err := arch.Snapshot(ctx, []string{"."}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = restic.SnapshotSummary{
+		FilesNew:            1,
+		FilesChanged:        1,
+		FilesUnmodified:     1,
+		DirsChanged:         1,
+		TotalFilesProcessed: 3,
+		TotalBytesProcessed: 19,
+	}
+	checkSnapshotSummary(t, sn, want)
+	if sn.Summary.DataBlobs != 2 {
+		t.Errorf("expected 2 new data blobs for second snapshot, got %d", sn.Summary.DataBlobs)
+	}
+
+	// the summary is saved with the snapshot
+	loaded, err := restic.LoadSnapshot(ctx, repo, secondSnapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSnapshotSummary(t, loaded, want)
+}
+
+func checkSnapshotSummary(t testing.TB, sn *restic.Snapshot, want restic.SnapshotSummary) {
+	if sn.Summary == nil {
+		t.Fatalf("snapshot has no summary")
+	}
+
+	got := *sn.Summary
+	if got.BackupStart.IsZero() || got.BackupEnd.Before(got.BackupStart) {
+		t.Errorf("invalid backup start and end time: %v, %v", got.BackupStart, got.BackupEnd)
+	}
+
+	counts := []struct {
+		name      string
+		got, want uint
+	}{
+		{"files_new", got.FilesNew, want.FilesNew},
+		{"files_changed", got.FilesChanged, want.FilesChanged},
+		{"files_unmodified", got.FilesUnmodified, want.FilesUnmodified},
+		{"dirs_new", got.DirsNew, want.DirsNew},
+		{"dirs_changed", got.DirsChanged, want.DirsChanged},
+		{"dirs_unmodified", got.DirsUnmodified, want.DirsUnmodified},
+		{"total_files_processed", got.TotalFilesProcessed, want.TotalFilesProcessed},
+	}
+	for _, c := range counts {
+		if c.got != c.want {
+			t.Errorf("wrong value for %v: want %d, got %d", c.name, c.want, c.got)
+		}
+	}
+
+	if got.TotalBytesProcessed != want.TotalBytesProcessed {
+		t.Errorf("wrong value for total_bytes_processed: want %d, got %d", want.TotalBytesProcessed, got.TotalBytesProcessed)
+	}
+}
+
 func TestArchiverErrorReporting(t *testing.T) {
 	ignoreErrorForBasename := func(basename string) ErrorFunc {
 		return func(item string, fi os.FileInfo, err error) error {
@@ -340,6 +340,10 @@ func (be *b2Backend) removeKeys(ctx context.Context, t restic.FileType) error {
 func (be *b2Backend) Delete(ctx context.Context) error {
 	alltypes := []restic.FileType{
 		restic.DataFile,
+		restic.ParityFile,
+		restic.DeletionFile,
+		restic.SessionKeyFile,
+		restic.RepairFile,
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
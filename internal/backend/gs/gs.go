@@ -430,6 +430,10 @@ func (be *Backend) removeKeys(ctx context.Context, t restic.FileType) error {
 func (be *Backend) Delete(ctx context.Context) error {
 	alltypes := []restic.FileType{
 		restic.DataFile,
+		restic.ParityFile,
+		restic.DeletionFile,
+		restic.SessionKeyFile,
+		restic.RepairFile,
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
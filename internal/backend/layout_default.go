@@ -7,20 +7,24 @@ import (
 )
 
 // DefaultLayout implements the default layout for local and sftp backends, as
-// described in the Design document. The `data` directory has one level of
-// subdirs, two characters each (taken from the first two characters of the
-// file name).
+// described in the Design document. The `data` and `parity` directories have
+// one level of subdirs, two characters each (taken from the first two
+// characters of the file name).
 type DefaultLayout struct {
 	Path string
 	Join func(...string) string
 }
 
 var defaultLayoutPaths = map[restic.FileType]string{
-	restic.DataFile:     "data",
-	restic.SnapshotFile: "snapshots",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "locks",
-	restic.KeyFile:      "keys",
+	restic.DataFile:       "data",
+	restic.SnapshotFile:   "snapshots",
+	restic.IndexFile:      "index",
+	restic.LockFile:       "locks",
+	restic.KeyFile:        "keys",
+	restic.ParityFile:     "parity",
+	restic.DeletionFile:   "deletions",
+	restic.SessionKeyFile: "sessionkeys",
+	restic.RepairFile:     "repair",
 }
 
 func (l *DefaultLayout) String() string {
@@ -36,7 +40,7 @@ func (l *DefaultLayout) Name() string {
 func (l *DefaultLayout) Dirname(h restic.Handle) string {
 	p := defaultLayoutPaths[h.Type]
 
-	if h.Type == restic.DataFile && len(h.Name) > 2 {
+	if hasSubdirs(h.Type) && len(h.Name) > 2 {
 		p = l.Join(p, h.Name[:2]) + "/"
 	}
 
@@ -63,6 +67,7 @@ func (l *DefaultLayout) Paths() (dirs []string) {
 	for i := 0; i < 256; i++ {
 		subdir := hex.EncodeToString([]byte{byte(i)})
 		dirs = append(dirs, l.Join(l.Path, defaultLayoutPaths[restic.DataFile], subdir))
+		dirs = append(dirs, l.Join(l.Path, defaultLayoutPaths[restic.ParityFile], subdir))
 	}
 
 	return dirs
@@ -70,10 +75,12 @@ func (l *DefaultLayout) Paths() (dirs []string) {
 
 // Basedir returns the base dir name for type t.
 func (l *DefaultLayout) Basedir(t restic.FileType) (dirname string, subdirs bool) {
-	if t == restic.DataFile {
-		subdirs = true
-	}
-
+	subdirs = hasSubdirs(t)
 	dirname = l.Join(l.Path, defaultLayoutPaths[t])
 	return
 }
+
+// hasSubdirs returns true if files of type t are stored in subdirs.
+func hasSubdirs(t restic.FileType) bool {
+	return t == restic.DataFile || t == restic.ParityFile
+}
@@ -11,11 +11,15 @@ type S3LegacyLayout struct {
 }
 
 var s3LayoutPaths = map[restic.FileType]string{
-	restic.DataFile:     "data",
-	restic.SnapshotFile: "snapshot",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "lock",
-	restic.KeyFile:      "key",
+	restic.DataFile:       "data",
+	restic.SnapshotFile:   "snapshot",
+	restic.IndexFile:      "index",
+	restic.LockFile:       "lock",
+	restic.KeyFile:        "key",
+	restic.ParityFile:     "parity",
+	restic.DeletionFile:   "deletion",
+	restic.SessionKeyFile: "sessionkey",
+	restic.RepairFile:     "repair",
 }
 
 func (l *S3LegacyLayout) String() string {
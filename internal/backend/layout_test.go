@@ -58,6 +58,12 @@ func TestDefaultLayout(t *testing.T) {
 			restic.Handle{Type: restic.KeyFile, Name: "123456"},
 			filepath.Join(tempdir, "keys", "123456"),
 		},
+		{
+			tempdir,
+			filepath.Join,
+			restic.Handle{Type: restic.ParityFile, Name: "0123456"},
+			filepath.Join(tempdir, "parity", "01", "0123456"),
+		},
 		{
 			"",
 			path.Join,
@@ -110,10 +116,15 @@ func TestDefaultLayout(t *testing.T) {
 			filepath.Join(tempdir, "index"),
 			filepath.Join(tempdir, "locks"),
 			filepath.Join(tempdir, "keys"),
+			filepath.Join(tempdir, "parity"),
+			filepath.Join(tempdir, "deletions"),
+			filepath.Join(tempdir, "sessionkeys"),
+			filepath.Join(tempdir, "repair"),
 		}
 
 		for i := 0; i < 256; i++ {
 			want = append(want, filepath.Join(tempdir, "data", fmt.Sprintf("%02x", i)))
+			want = append(want, filepath.Join(tempdir, "parity", fmt.Sprintf("%02x", i)))
 		}
 
 		sort.Sort(sort.StringSlice(want))
@@ -187,6 +198,10 @@ func TestRESTLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "locks"),
 			filepath.Join(path, "keys"),
+			filepath.Join(path, "parity"),
+			filepath.Join(path, "deletions"),
+			filepath.Join(path, "sessionkeys"),
+			filepath.Join(path, "repair"),
 		}
 
 		sort.Sort(sort.StringSlice(want))
@@ -333,6 +348,10 @@ func TestS3LegacyLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "lock"),
 			filepath.Join(path, "key"),
+			filepath.Join(path, "parity"),
+			filepath.Join(path, "deletion"),
+			filepath.Join(path, "sessionkey"),
+			filepath.Join(path, "repair"),
 		}
 
 		sort.Sort(sort.StringSlice(want))
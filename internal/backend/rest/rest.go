@@ -443,6 +443,10 @@ func (b *Backend) removeKeys(ctx context.Context, t restic.FileType) error {
 func (b *Backend) Delete(ctx context.Context) error {
 	alltypes := []restic.FileType{
 		restic.DataFile,
+		restic.ParityFile,
+		restic.DeletionFile,
+		restic.SessionKeyFile,
+		restic.RepairFile,
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"sync"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
@@ -22,26 +24,29 @@ import (
 // A Checker only tests for internal errors within the data structures of the
 // repository (e.g. missing blobs), and needs a valid Repository to work on.
 type Checker struct {
-	packs    restic.IDSet
-	blobs    restic.IDSet
+	packs restic.IDSet
+
+	// blobRefs counts the references to the blobs, blobs which are not
+	// referenced at all are not contained
 	blobRefs struct {
 		sync.Mutex
 		M map[restic.ID]uint
 	}
-	indexes map[restic.ID]*repository.Index
 
 	masterIndex *repository.MasterIndex
 
 	repo restic.Repository
+
+	// RepairPacks configures ReadPacks to replace damaged packs by the
+	// version reconstructed from their parity data.
+	RepairPacks bool
 }
 
 // New returns a new checker which runs on repo.
 func New(repo restic.Repository) *Checker {
 	c := &Checker{
 		packs:       restic.NewIDSet(),
-		blobs:       restic.NewIDSet(),
 		masterIndex: repository.NewMasterIndex(),
-		indexes:     make(map[restic.ID]*repository.Index),
 		repo:        repo,
 	}
 
@@ -72,6 +77,28 @@ func (err ErrOldIndexFormat) Error() string {
 	return fmt.Sprintf("index %v has old format", err.ID.Str())
 }
 
+// ErrPackRepairable is returned by ReadPacks for a damaged pack which can be
+// reconstructed from its parity data.
+type ErrPackRepairable struct {
+	ID  restic.ID
+	Err error
+}
+
+func (e ErrPackRepairable) Error() string {
+	return fmt.Sprintf("pack %v is damaged, but can be repaired using its parity data: %v", e.ID.Str(), e.Err)
+}
+
+// ErrPackRepaired is returned by ReadPacks when a damaged pack was replaced by
+// the version reconstructed from its parity data.
+type ErrPackRepaired struct {
+	ID  restic.ID
+	Err error
+}
+
+func (e ErrPackRepaired) Error() string {
+	return fmt.Sprintf("pack %v was damaged and has been repaired: %v", e.ID.Str(), e.Err)
+}
+
 // LoadIndex loads all index files.
 func (c *Checker) LoadIndex(ctx context.Context) (hints []error, errs []error) {
 	debug.Log("Start")
@@ -133,15 +160,10 @@ func (c *Checker) LoadIndex(ctx context.Context) (hints []error, errs []error) {
 			continue
 		}
 
-		c.indexes[idxID] = res.Index
-		c.masterIndex.Insert(res.Index)
-
 		debug.Log("process blobs")
 		cnt := 0
 		for blob := range res.Index.Each(ctx) {
 			c.packs.Insert(blob.PackID)
-			c.blobs.Insert(blob.ID)
-			c.blobRefs.M[blob.ID] = 0
 			cnt++
 
 			if _, ok := packToIndex[blob.PackID]; !ok {
@@ -151,6 +173,10 @@ func (c *Checker) LoadIndex(ctx context.Context) (hints []error, errs []error) {
 		}
 
 		debug.Log("%d blobs processed", cnt)
+
+		// the blobs are merged into the compact table of the master index,
+		// so the index itself is not kept
+		c.masterIndex.Insert(res.Index)
 	}
 
 	debug.Log("checking for duplicate packs")
@@ -617,7 +643,7 @@ func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 		debug.Log("blob %v refcount %d", blobID, c.blobRefs.M[blobID])
 		c.blobRefs.Unlock()
 
-		if !c.blobs.Has(blobID) {
+		if !c.masterIndex.Has(blobID, restic.DataBlob) {
 			debug.Log("tree %v references blob %v which isn't contained in index", id, blobID)
 
 			errs = append(errs, Error{TreeID: id, BlobID: blobID, Err: errors.New("not found in index")})
@@ -632,11 +658,15 @@ func (c *Checker) UnusedBlobs() (blobs restic.IDs) {
 	c.blobRefs.Lock()
 	defer c.blobRefs.Unlock()
 
-	debug.Log("checking %d blobs", len(c.blobs))
-	for id := range c.blobs {
-		if c.blobRefs.M[id] == 0 {
-			debug.Log("blob %v not referenced", id)
-			blobs = append(blobs, id)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	seen := restic.NewIDSet()
+	for pb := range c.masterIndex.Each(ctx) {
+		if c.blobRefs.M[pb.ID] == 0 && !seen.Has(pb.ID) {
+			debug.Log("blob %v not referenced", pb.ID)
+			seen.Insert(pb.ID)
+			blobs = append(blobs, pb.ID)
 		}
 	}
 
@@ -654,7 +684,7 @@ func (c *Checker) GetPacks() restic.IDSet {
 }
 
 // checkPack reads a pack and checks the integrity of all blobs.
-func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
+func checkPack(ctx context.Context, r restic.Repository, id restic.ID, repairPacks bool) error {
 	debug.Log("checking pack %v", id)
 	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
 
@@ -668,6 +698,17 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
 		_ = os.Remove(packfile.Name())
 	}()
 
+	err = checkPackFile(r, id, packfile, hash, size)
+	if err == nil || r.Config().Parity == nil {
+		return err
+	}
+
+	return repairPack(ctx, r, id, packfile, repairPacks, err)
+}
+
+// checkPackFile checks the contents of the downloaded pack file with the given
+// id.
+func checkPackFile(r restic.Repository, id restic.ID, packfile *os.File, hash restic.ID, size int64) error {
 	debug.Log("hash for pack %v is %v", id, hash)
 
 	if !hash.Equal(id) {
@@ -711,6 +752,15 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
 			continue
 		}
 
+		if blob.IsCompressed() {
+			plaintext, err = repository.DecompressBlob(plaintext, blob.UncompressedLength, nil)
+			if err != nil {
+				debug.Log("  error decompressing blob %v: %v", blob.ID, err)
+				errs = append(errs, errors.Errorf("blob %v: %v", i, err))
+				continue
+			}
+		}
+
 		hash := restic.Hash(plaintext)
 		if !hash.Equal(blob.ID) {
 			debug.Log("  Blob ID does not match, want %v, got %v", blob.ID, hash)
@@ -726,6 +776,95 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
 	return nil
 }
 
+// repairPack reconstructs the damaged pack file with the given id from its
+// parity data. checkErr describes the damage found by checkPackFile. If
+// repairPacks is set, the pack is replaced in the backend by the reconstructed
+// version.
+func repairPack(ctx context.Context, r restic.Repository, id restic.ID, packfile *os.File, repairPacks bool, checkErr error) error {
+	debug.Log("pack %v is damaged, trying to repair it: %v", id, checkErr)
+
+	_, err := packfile.Seek(0, 0)
+	if err != nil {
+		return errors.Wrap(err, "Seek")
+	}
+
+	data, err := ioutil.ReadAll(packfile)
+	if err != nil {
+		return errors.Wrap(err, "ReadAll")
+	}
+
+	repaired, err := repository.RepairPack(ctx, r, id, data)
+	if err != nil {
+		return errors.Errorf("%v, repair using parity data failed: %v", checkErr, err)
+	}
+
+	if !repairPacks {
+		return ErrPackRepairable{ID: id, Err: checkErr}
+	}
+
+	// keep a verified copy of the reconstructed pack in the backend, so the
+	// damaged pack is never removed before the data is stored elsewhere
+	tmp := restic.Handle{Type: restic.RepairFile, Name: id.String()}
+	if err = saveVerified(ctx, r.Backend(), tmp, id, repaired); err != nil {
+		return errors.Errorf("%v, saving the repaired pack failed: %v", checkErr, err)
+	}
+
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+	if err = r.Backend().Remove(ctx, h); err != nil {
+		return errors.Errorf("%v, removing the damaged pack failed: %v", checkErr, err)
+	}
+
+	if err = saveVerified(ctx, r.Backend(), h, id, repaired); err != nil {
+		return errors.Errorf("%v, replacing the damaged pack failed, the repaired pack is kept as %v: %v", checkErr, tmp, err)
+	}
+
+	if err = r.Backend().Remove(ctx, tmp); err != nil {
+		return errors.Errorf("%v, removing the copy of the repaired pack failed: %v", checkErr, err)
+	}
+
+	return ErrPackRepaired{ID: id, Err: checkErr}
+}
+
+// saveVerified stores data in the backend as h and reads it back to check that
+// its hash matches id. An existing file with the right content is kept.
+func saveVerified(ctx context.Context, be restic.Backend, h restic.Handle, id restic.ID, data []byte) error {
+	exists, err := be.Test(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		if verifyFile(ctx, be, h, id) == nil {
+			return nil
+		}
+
+		if err = be.Remove(ctx, h); err != nil {
+			return err
+		}
+	}
+
+	if err = be.Save(ctx, h, restic.NewByteReader(data)); err != nil {
+		return err
+	}
+
+	return verifyFile(ctx, be, h, id)
+}
+
+// verifyFile loads the file h from the backend and checks that its hash
+// matches id.
+func verifyFile(ctx context.Context, be restic.Backend, h restic.Handle, id restic.ID) error {
+	buf, err := backend.LoadAll(ctx, be, h)
+	if err != nil {
+		return err
+	}
+
+	if hash := restic.Hash(buf); !hash.Equal(id) {
+		return errors.Errorf("%v does not match, want %v, got %v", h, id.Str(), hash.Str())
+	}
+
+	return nil
+}
+
 // ReadData loads all data from the repository and checks the integrity.
 func (c *Checker) ReadData(ctx context.Context, p *restic.Progress, errChan chan<- error) {
 	c.ReadPacks(ctx, c.packs, p, errChan)
@@ -757,7 +896,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.P
 					}
 				}
 
-				err := checkPack(ctx, c.repo, id)
+				err := checkPack(ctx, c.repo, id, c.RepairPacks)
 				p.Report(restic.Stat{Blobs: 1})
 				if err == nil {
 					continue
@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+
+	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const curve25519Size = 32
+
+// PublicKey is a Curve25519 public key. Data sealed with a public key can
+// only be opened with the corresponding PrivateKey.
+type PublicKey [curve25519Size]byte
+
+// PrivateKey is a Curve25519 private key.
+type PrivateKey [curve25519Size]byte
+
+// SealedOverhead is the number of bytes a plaintext is enlarged by sealing it
+// with a PublicKey.
+const SealedOverhead = curve25519Size + Extension
+
+// PrivateKey returns the private key derived from k. Different keys k yield
+// unrelated private keys.
+func (k *Key) PrivateKey() *PrivateKey {
+	priv := &PrivateKey{}
+	if _, err := io.ReadFull(k.derive("restic private key"), priv[:]); err != nil {
+		panic(err)
+	}
+
+	return priv
+}
+
+// Public returns the public key for k.
+func (k *PrivateKey) Public() *PublicKey {
+	pub := &PublicKey{}
+	curve25519.ScalarBaseMult((*[curve25519Size]byte)(pub), (*[curve25519Size]byte)(k))
+	return pub
+}
+
+// sharedKey returns the symmetric key for the shared secret of priv and the
+// public key peer. The ephemeral public key and the public key of the
+// recipient are included in the derivation.
+func sharedKey(priv *PrivateKey, peer, ephemeral, recipient *PublicKey) (*Key, error) {
+	var shared [curve25519Size]byte
+	curve25519.ScalarMult(&shared, (*[curve25519Size]byte)(priv), (*[curve25519Size]byte)(peer))
+
+	// a shared secret of all zeroes is the result of an invalid public key
+	var zero [curve25519Size]byte
+	if shared == zero {
+		return nil, errors.New("invalid public key")
+	}
+
+	info := make([]byte, 0, 2*curve25519Size)
+	info = append(info, ephemeral[:]...)
+	info = append(info, recipient[:]...)
+	rd := hkdf.New(sha256.New, shared[:], nil, info)
+
+	k := &Key{}
+	for _, buf := range [][]byte{k.EncryptionKey[:], k.MACKey.K[:], k.MACKey.R[:]} {
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+	}
+	maskKey(&k.MACKey)
+
+	return k, nil
+}
+
+// Seal encrypts and authenticates plaintext so that it can only be opened
+// with the private key for k. The result is the ephemeral public key used for
+// the key exchange, followed by the nonce and the ciphertext.
+func (k *PublicKey) Seal(plaintext []byte) ([]byte, error) {
+	ephemeral := &PrivateKey{}
+	if _, err := rand.Read(ephemeral[:]); err != nil {
+		return nil, errors.Wrap(err, "rand.Read")
+	}
+	ephemeralPublic := ephemeral.Public()
+
+	key, err := sharedKey(ephemeral, k, ephemeralPublic, k)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := NewRandomNonce()
+	buf := make([]byte, 0, len(plaintext)+SealedOverhead)
+	buf = append(buf, ephemeralPublic[:]...)
+	buf = append(buf, nonce...)
+	return key.Seal(buf, nonce, plaintext, nil), nil
+}
+
+// Open decrypts and authenticates data which has been sealed with the public
+// key for k.
+func (k *PrivateKey) Open(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < SealedOverhead {
+		return nil, errors.New("sealed data is too short")
+	}
+
+	ephemeralPublic := &PublicKey{}
+	copy(ephemeralPublic[:], ciphertext)
+	ciphertext = ciphertext[curve25519Size:]
+
+	key, err := sharedKey(k, ephemeralPublic, ephemeralPublic, k.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, ciphertext := ciphertext[:ivSize], ciphertext[ivSize:]
+	return key.open(nil, nonce, ciphertext)
+}
+
+// MarshalJSON converts the PublicKey to JSON.
+func (k *PublicKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k[:])
+}
+
+// UnmarshalJSON fills the key k with data from the JSON representation.
+func (k *PublicKey) UnmarshalJSON(data []byte) error {
+	var d []byte
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return errors.Wrap(err, "Unmarshal")
+	}
+
+	if len(d) != curve25519Size {
+		return errors.Errorf("invalid public key length %d", len(d))
+	}
+	copy(k[:], d)
+
+	return nil
+}
@@ -4,11 +4,14 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/restic/restic/internal/errors"
 
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/poly1305"
 )
 
@@ -36,6 +39,14 @@ var (
 type Key struct {
 	MACKey        `json:"mac"`
 	EncryptionKey `json:"encrypt"`
+
+	// noncePrefix is stored at the start of all nonces returned by NewNonce,
+	// it allows finding the key which has encrypted some data.
+	noncePrefix []byte
+
+	// fallback returns further keys which Open tries when a ciphertext
+	// cannot be authenticated with this key.
+	fallback func(nonce []byte) []*Key
 }
 
 // EncryptionKey is key used for encryption
@@ -158,6 +169,65 @@ func NewRandomNonce() []byte {
 	return iv
 }
 
+// NoncePrefixSize is the number of bytes at the start of a nonce which
+// identify the key that has been used for encryption, see SetNoncePrefix.
+const NoncePrefixSize = 4
+
+// SetNoncePrefix configures k so that all nonces returned by NewNonce start
+// with prefix, which must be NoncePrefixSize bytes long. The remaining bytes
+// of the nonce are still random.
+func (k *Key) SetNoncePrefix(prefix []byte) {
+	if len(prefix) != NoncePrefixSize {
+		panic("incorrect nonce prefix length")
+	}
+	k.noncePrefix = append([]byte{}, prefix...)
+}
+
+// NewNonce returns a new random nonce for encrypting data with k.
+func (k *Key) NewNonce() []byte {
+	nonce := NewRandomNonce()
+	copy(nonce, k.noncePrefix)
+	return nonce
+}
+
+// SetFallback installs a function which returns further keys that are tried
+// by Open when a ciphertext cannot be authenticated with k. The function is
+// passed the nonce of the ciphertext and must be safe for concurrent use.
+func (k *Key) SetFallback(fn func(nonce []byte) []*Key) {
+	k.fallback = fn
+}
+
+// DeriveKey returns a new key, which is derived from k with HKDF-SHA256 for
+// the given purpose. Different purposes yield independent keys, k cannot be
+// computed from a derived key.
+func (k *Key) DeriveKey(purpose string) *Key {
+	dk := &Key{}
+	rd := k.derive(purpose)
+
+	if _, err := io.ReadFull(rd, dk.EncryptionKey[:]); err != nil {
+		panic(err)
+	}
+	if _, err := io.ReadFull(rd, dk.MACKey.K[:]); err != nil {
+		panic(err)
+	}
+	if _, err := io.ReadFull(rd, dk.MACKey.R[:]); err != nil {
+		panic(err)
+	}
+
+	maskKey(&dk.MACKey)
+	return dk
+}
+
+// derive returns a reader for key material derived from k for purpose.
+func (k *Key) derive(purpose string) io.Reader {
+	secret := make([]byte, 0, aesKeySize+macKeySize)
+	secret = append(secret, k.EncryptionKey[:]...)
+	secret = append(secret, k.MACKey.K[:]...)
+	secret = append(secret, k.MACKey.R[:]...)
+
+	return hkdf.New(sha256.New, secret, nil, []byte(purpose))
+}
+
 type jsonMACKey struct {
 	K []byte `json:"k"`
 	R []byte `json:"r"`
@@ -327,6 +397,24 @@ func (k *Key) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 // Even if the function fails, the contents of dst, up to its capacity,
 // may be overwritten.
 func (k *Key) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	plaintext, err := k.open(dst, nonce, ciphertext)
+	if err != ErrUnauthenticated || k.fallback == nil {
+		return plaintext, err
+	}
+
+	for _, other := range k.fallback(nonce) {
+		plaintext, ferr := other.open(dst, nonce, ciphertext)
+		if ferr == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, err
+}
+
+// open decrypts ciphertext with k only. The ciphertext is not modified when
+// it cannot be authenticated.
+func (k *Key) open(dst, nonce, ciphertext []byte) ([]byte, error) {
 	if !k.Valid() {
 		return nil, errors.New("invalid key")
 	}
@@ -300,3 +300,68 @@ func BenchmarkDecrypt(b *testing.B) {
 		rtest.OK(b, err)
 	}
 }
+
+func TestDeriveKey(t *testing.T) {
+	k := crypto.NewRandomKey()
+
+	k1 := k.DeriveKey("purpose1")
+	rtest.Assert(t, k1.Valid(), "derived key is invalid")
+	rtest.Equals(t, k1, k.DeriveKey("purpose1"))
+	rtest.Assert(t, k1.EncryptionKey != k.DeriveKey("purpose2").EncryptionKey, "keys for different purposes are equal")
+	rtest.Assert(t, k1.EncryptionKey != crypto.NewRandomKey().DeriveKey("purpose1").EncryptionKey, "keys derived from different keys are equal")
+}
+
+func TestNoncePrefixFallback(t *testing.T) {
+	master := crypto.NewRandomKey()
+	other := crypto.NewRandomKey()
+	other.SetNoncePrefix([]byte{1, 2, 3, 4})
+
+	data := rtest.Random(23, 1000)
+	nonce := other.NewNonce()
+	rtest.Equals(t, []byte{1, 2, 3, 4}, nonce[:crypto.NoncePrefixSize])
+	ciphertext := other.Seal(nil, nonce, data, nil)
+
+	_, err := master.Open(nil, nonce, ciphertext, nil)
+	rtest.Assert(t, err == crypto.ErrUnauthenticated, "expected ErrUnauthenticated, got %v", err)
+
+	master.SetFallback(func(nonce []byte) []*crypto.Key {
+		if bytes.HasPrefix(nonce, []byte{1, 2, 3, 4}) {
+			return []*crypto.Key{crypto.NewRandomKey(), other}
+		}
+		return nil
+	})
+
+	plaintext, err := master.Open(nil, nonce, ciphertext, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, plaintext)
+
+	// decrypting in place works with the fallback
+	buf := append([]byte{}, ciphertext...)
+	plaintext, err = master.Open(buf[:0], nonce, buf, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, plaintext)
+}
+
+func TestSealPublicKey(t *testing.T) {
+	priv := crypto.NewRandomKey().PrivateKey()
+	pub := priv.Public()
+
+	for _, size := range []int{0, 23, 1 << 20} {
+		data := rtest.Random(42, size)
+		ciphertext, err := pub.Seal(data)
+		rtest.OK(t, err)
+		rtest.Equals(t, len(data)+crypto.SealedOverhead, len(ciphertext))
+
+		plaintext, err := priv.Open(ciphertext)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(data, plaintext), "wrong plaintext")
+
+		// other private keys cannot open the data
+		_, err = crypto.NewRandomKey().PrivateKey().Open(ciphertext)
+		rtest.Assert(t, err != nil, "data was opened with the wrong private key")
+
+		ciphertext[len(ciphertext)/2] ^= 0x01
+		_, err = priv.Open(ciphertext)
+		rtest.Assert(t, err != nil, "modified data was not detected")
+	}
+}
@@ -7,18 +7,74 @@ import (
 	"github.com/restic/restic/internal/errors"
 
 	sscrypt "github.com/elithrar/simple-scrypt"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/scrypt"
 )
 
 const saltLength = 64
 
-// Params are the default parameters used for the key derivation function KDF().
+// Names of the supported key derivation functions.
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+)
+
+// Params are the parameters used for the key derivation function KDF(). For
+// scrypt, N, R and P are used. For Argon2id, T is the number of passes over
+// the memory, M the memory size in KiB and P the degree of parallelism.
 type Params struct {
+	// KDF is the name of the key derivation function, the empty string
+	// selects scrypt.
+	KDF string
+
 	N int
 	R int
 	P int
+	T int
+	M int
+}
+
+// Name returns the name of the key derivation function selected by p.
+func (p Params) Name() string {
+	if p.KDF == "" {
+		return KDFScrypt
+	}
+	return p.KDF
+}
+
+// Check returns an error if p does not contain valid parameters.
+func (p Params) Check() error {
+	switch p.Name() {
+	case KDFScrypt:
+		params := sscrypt.Params{
+			N:       p.N,
+			R:       p.R,
+			P:       p.P,
+			DKLen:   sscrypt.DefaultParams.DKLen,
+			SaltLen: saltLength,
+		}
+		return errors.Wrap(params.Check(), "Check")
+	case KDFArgon2id:
+		if p.T < 1 {
+			return errors.Errorf("invalid Argon2id time parameter %d", p.T)
+		}
+		if p.P < 1 || p.P > 255 {
+			return errors.Errorf("invalid Argon2id parallelism %d, must be between 1 and 255", p.P)
+		}
+		if p.M < 8*p.P || p.M > maxArgon2idMemory {
+			return errors.Errorf("invalid Argon2id memory size %d KiB", p.M)
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported KDF %q", p.KDF)
+	}
 }
 
+// maxArgon2idMemory is the largest memory size in KiB (4 GiB) accepted for
+// Argon2id, so that a key file cannot make restic allocate arbitrary amounts
+// of memory.
+const maxArgon2idMemory = 4 * 1024 * 1024
+
 // DefaultKDFParams are the default parameters used for Calibrate and KDF().
 var DefaultKDFParams = Params{
 	N: sscrypt.DefaultParams.N,
@@ -26,7 +82,16 @@ var DefaultKDFParams = Params{
 	P: sscrypt.DefaultParams.P,
 }
 
-// Calibrate determines new KDF parameters for the current hardware.
+// DefaultArgon2idParams are the default parameters for Argon2id as recommended
+// by RFC 9106 for memory-constrained environments.
+var DefaultArgon2idParams = Params{
+	KDF: KDFArgon2id,
+	T:   3,
+	M:   64 * 1024,
+	P:   4,
+}
+
+// Calibrate determines new scrypt parameters for the current hardware.
 func Calibrate(timeout time.Duration, memory int) (Params, error) {
 	defaultParams := sscrypt.Params{
 		N:       DefaultKDFParams.N,
@@ -49,42 +114,41 @@ func Calibrate(timeout time.Duration, memory int) (Params, error) {
 }
 
 // KDF derives encryption and message authentication keys from the password
-// using the supplied parameters N, R and P and the Salt.
+// using the KDF selected by p with its parameters and the Salt.
 func KDF(p Params, salt []byte, password string) (*Key, error) {
 	if len(salt) != saltLength {
-		return nil, errors.Errorf("scrypt() called with invalid salt bytes (len %d)", len(salt))
+		return nil, errors.Errorf("KDF() called with invalid salt bytes (len %d)", len(salt))
 	}
 
 	// make sure we have valid parameters
-	params := sscrypt.Params{
-		N:       p.N,
-		R:       p.R,
-		P:       p.P,
-		DKLen:   sscrypt.DefaultParams.DKLen,
-		SaltLen: len(salt),
-	}
-
-	if err := params.Check(); err != nil {
-		return nil, errors.Wrap(err, "Check")
+	if err := p.Check(); err != nil {
+		return nil, err
 	}
 
 	derKeys := &Key{}
 
 	keybytes := macKeySize + aesKeySize
-	scryptKeys, err := scrypt.Key([]byte(password), salt, p.N, p.R, p.P, keybytes)
-	if err != nil {
-		return nil, errors.Wrap(err, "scrypt.Key")
+	var keys []byte
+	switch p.Name() {
+	case KDFScrypt:
+		var err error
+		keys, err = scrypt.Key([]byte(password), salt, p.N, p.R, p.P, keybytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "scrypt.Key")
+		}
+	case KDFArgon2id:
+		keys = argon2.IDKey([]byte(password), salt, uint32(p.T), uint32(p.M), uint8(p.P), uint32(keybytes))
 	}
 
-	if len(scryptKeys) != keybytes {
-		return nil, errors.Errorf("invalid numbers of bytes expanded from scrypt(): %d", len(scryptKeys))
+	if len(keys) != keybytes {
+		return nil, errors.Errorf("invalid numbers of bytes expanded from %v(): %d", p.Name(), len(keys))
 	}
 
-	// first 32 byte of scrypt output is the encryption key
-	copy(derKeys.EncryptionKey[:], scryptKeys[:aesKeySize])
+	// first 32 byte of the KDF output is the encryption key
+	copy(derKeys.EncryptionKey[:], keys[:aesKeySize])
 
-	// next 32 byte of scrypt output is the mac key, in the form k||r
-	macKeyFromSlice(&derKeys.MACKey, scryptKeys[aesKeySize:])
+	// next 32 byte of the KDF output is the mac key, in the form k||r
+	macKeyFromSlice(&derKeys.MACKey, keys[aesKeySize:])
 
 	return derKeys, nil
 }
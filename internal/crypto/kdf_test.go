@@ -12,3 +12,59 @@ func TestCalibrate(t *testing.T) {
 	}
 	t.Logf("testing calibrate, params after: %v", params)
 }
+
+func TestKDF(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, params := range []Params{
+		{N: 128, R: 1, P: 1},
+		{KDF: KDFScrypt, N: 128, R: 1, P: 1},
+		{KDF: KDFArgon2id, T: 1, M: 64, P: 2},
+	} {
+		k1, err := KDF(params, salt, "password")
+		if err != nil {
+			t.Fatalf("KDF(%v) failed: %v", params, err)
+		}
+
+		k2, err := KDF(params, salt, "password")
+		if err != nil {
+			t.Fatalf("KDF(%v) failed: %v", params, err)
+		}
+
+		if !k1.Valid() || k1.EncryptionKey != k2.EncryptionKey || k1.MACKey != k2.MACKey {
+			t.Errorf("KDF(%v) returned different keys for the same password", params)
+		}
+
+		k3, err := KDF(params, salt, "other password")
+		if err != nil {
+			t.Fatalf("KDF(%v) failed: %v", params, err)
+		}
+
+		if k1.EncryptionKey == k3.EncryptionKey {
+			t.Errorf("KDF(%v) returned the same key for different passwords", params)
+		}
+	}
+}
+
+func TestKDFInvalidParams(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, params := range []Params{
+		{KDF: "bcrypt", N: 128, R: 1, P: 1},
+		{N: 100, R: 1, P: 1},
+		{KDF: KDFArgon2id, T: 0, M: 64, P: 1},
+		{KDF: KDFArgon2id, T: 1, M: 4, P: 1},
+		{KDF: KDFArgon2id, T: 1, M: 64, P: 0},
+		{KDF: KDFArgon2id, T: 1, M: 64, P: 256},
+	} {
+		if _, err := KDF(params, salt, "password"); err == nil {
+			t.Errorf("KDF(%v) did not return an error", params)
+		}
+	}
+}
@@ -2,4 +2,7 @@
 // in contrast to filepath.Glob a pattern may specify directories.
 //
 // For a list of valid patterns please see the documentation on filepath.Glob.
+//
+// In addition, ignore files with the syntax of gitignore can be parsed with
+// ParseIgnoreFile.
 package filter
@@ -155,29 +155,95 @@ func match(patterns, strs []string) (matched bool, err error) {
 
 // List returns true if str matches one of the patterns. Empty patterns are
 // ignored.
+//
+// Patterns starting with '!' are negated: when such a pattern matches, str is
+// not matched by the list, even if a previous pattern has matched. The last
+// pattern which matches str decides. childMayMatch is true if a child of str
+// may be matched by one of the patterns which are not negated.
 func List(patterns []string, str string) (matched bool, childMayMatch bool, err error) {
+	return ListPatterns(NewPatterns(patterns, false), str)
+}
+
+// ListInsensitive is the same as List, but str is matched against the patterns
+// ignoring the case of letters.
+func ListInsensitive(patterns []string, str string) (matched bool, childMayMatch bool, err error) {
+	return ListPatterns(NewPatterns(patterns, true), str)
+}
+
+// Pattern is a pattern for ListPatterns.
+type Pattern struct {
+	Pattern string
+
+	// Insensitive is true if the pattern ignores the case of letters.
+	Insensitive bool
+}
+
+// NewPatterns returns a Pattern for each of the strings in patterns.
+func NewPatterns(patterns []string, insensitive bool) []Pattern {
+	list := make([]Pattern, 0, len(patterns))
 	for _, pat := range patterns {
+		list = append(list, Pattern{Pattern: pat, Insensitive: insensitive})
+	}
+	return list
+}
+
+// ListPatterns is the same as List, but each pattern may ignore the case of
+// letters. All patterns are evaluated in the given order, so a negated pattern
+// also applies to str if it has been matched by a previous pattern which
+// handles the case of letters differently.
+func ListPatterns(patterns []Pattern, str string) (matched bool, childMayMatch bool, err error) {
+	negation := hasNegatedPattern(patterns)
+	lower := strings.ToLower(str)
+
+	for _, p := range patterns {
+		pat, s := p.Pattern, str
 		if pat == "" {
 			continue
 		}
 
-		m, err := Match(pat, str)
-		if err != nil {
-			return false, false, err
+		if p.Insensitive {
+			pat, s = strings.ToLower(pat), lower
+		}
+
+		negated := false
+		if pat[0] == '!' {
+			negated = true
+			pat = pat[1:]
 		}
 
-		c, err := ChildMatch(pat, str)
+		m, err := Match(pat, s)
 		if err != nil {
 			return false, false, err
 		}
 
-		matched = matched || m
-		childMayMatch = childMayMatch || c
+		if m {
+			matched = !negated
+		}
+
+		if !negated {
+			c, err := ChildMatch(pat, s)
+			if err != nil {
+				return false, false, err
+			}
 
-		if matched && childMayMatch {
+			childMayMatch = childMayMatch || c
+		}
+
+		// without negated patterns, the result cannot change anymore
+		if !negation && matched && childMayMatch {
 			return true, true, nil
 		}
 	}
 
 	return matched, childMayMatch, nil
 }
+
+// hasNegatedPattern returns true if one of the patterns starts with '!'.
+func hasNegatedPattern(patterns []Pattern) bool {
+	for _, p := range patterns {
+		if strings.HasPrefix(p.Pattern, "!") {
+			return true
+		}
+	}
+	return false
+}
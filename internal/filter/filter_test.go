@@ -226,6 +226,13 @@ var filterListTests = []struct {
 	{[]string{"/*/*/bar/test.*"}, "/foo/bar/test.go", false},
 	{[]string{"/*/*/bar/test.*", "*.go"}, "/foo/bar/test.go", true},
 	{[]string{"", "*.c"}, "/foo/bar/test.go", false},
+	{[]string{"*.log", "!important.log"}, "/var/log/debug.log", true},
+	{[]string{"*.log", "!important.log"}, "/var/log/important.log", false},
+	{[]string{"!important.log", "*.log"}, "/var/log/important.log", true},
+	{[]string{"/var", "!/var/cache", "/var/cache/x"}, "/var/cache/x", true},
+	{[]string{"/var", "!/var/cache", "/var/cache/x"}, "/var/cache/y", false},
+	{[]string{"!*.go"}, "/foo/bar/test.go", false},
+	{[]string{`\!important.log`}, "/var/log/!important.log", true},
 }
 
 func TestList(t *testing.T) {
@@ -244,6 +251,86 @@ func TestList(t *testing.T) {
 	}
 }
 
+var filterListChildTests = []struct {
+	patterns []string
+	path     string
+	child    bool
+}{
+	{[]string{"/home/user/work"}, "/home", true},
+	{[]string{"/home/user/work", "!/home"}, "/home", true},
+	{[]string{"!/home/user/work"}, "/home", false},
+	{[]string{"/srv"}, "/home", false},
+}
+
+func TestListChildMatch(t *testing.T) {
+	for i, test := range filterListChildTests {
+		_, child, err := filter.List(test.patterns, test.path)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if child != test.child {
+			t.Errorf("test %d: filter.List(%q, %q): expected childMayMatch %v, got %v",
+				i, test.patterns, test.path, test.child, child)
+		}
+	}
+}
+
+var filterListInsensitiveTests = []struct {
+	patterns []string
+	path     string
+	match    bool
+}{
+	{[]string{"*.JPG"}, "/photos/img.jpg", true},
+	{[]string{"*.jpg"}, "/Photos/IMG.JPG", true},
+	{[]string{"/photos/Holiday"}, "/PHOTOS/holiday/img.jpg", true},
+	{[]string{"*.jpg", "!img.JPG"}, "/photos/IMG.jpg", false},
+	{[]string{"*.png"}, "/photos/IMG.jpg", false},
+}
+
+func TestListInsensitive(t *testing.T) {
+	for i, test := range filterListInsensitiveTests {
+		match, _, err := filter.ListInsensitive(test.patterns, test.path)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if match != test.match {
+			t.Errorf("test %d: filter.ListInsensitive(%q, %q): expected %v, got %v",
+				i, test.patterns, test.path, test.match, match)
+		}
+	}
+}
+
+var filterListPatternsTests = []struct {
+	patterns []filter.Pattern
+	path     string
+	match    bool
+}{
+	{[]filter.Pattern{{Pattern: "*.LOG", Insensitive: true}, {Pattern: "!important.log"}}, "/var/log/important.log", false},
+	{[]filter.Pattern{{Pattern: "*.LOG", Insensitive: true}, {Pattern: "!important.log"}}, "/var/log/IMPORTANT.log", true},
+	{[]filter.Pattern{{Pattern: "*.log"}, {Pattern: "!IMPORTANT.LOG", Insensitive: true}}, "/var/log/important.log", false},
+	{[]filter.Pattern{{Pattern: "!important.log"}, {Pattern: "*.LOG", Insensitive: true}}, "/var/log/important.log", true},
+	{[]filter.Pattern{{Pattern: "*.log"}, {Pattern: "/VAR/cache", Insensitive: true}}, "/var/Cache/x", true},
+}
+
+func TestListPatterns(t *testing.T) {
+	for i, test := range filterListPatternsTests {
+		match, _, err := filter.ListPatterns(test.patterns, test.path)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if match != test.match {
+			t.Errorf("test %d: filter.ListPatterns(%v, %q): expected %v, got %v",
+				i, test.patterns, test.path, test.match, match)
+		}
+	}
+}
+
 func ExampleList() {
 	match, _, _ := filter.List([]string{"*.c", "*.go"}, "/home/user/file.go")
 	fmt.Printf("match: %v\n", match)
@@ -251,6 +338,19 @@ func ExampleList() {
 	// match: true
 }
 
+func ExampleList_negation() {
+	patterns := []string{"*.log", "!important.log"}
+
+	match, _, _ := filter.List(patterns, "/var/log/debug.log")
+	fmt.Printf("debug.log: %v\n", match)
+
+	match, _, _ = filter.List(patterns, "/var/log/important.log")
+	fmt.Printf("important.log: %v\n", match)
+	// Output:
+	// debug.log: true
+	// important.log: false
+}
+
 func extractTestLines(t testing.TB) (lines []string) {
 	f, err := os.Open("testdata/libreoffice.txt.bz2")
 	if err != nil {
@@ -0,0 +1,171 @@
+package filter
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// IgnorePattern is a pattern from an ignore file, which uses the syntax of
+// gitignore files. The pattern is relative to the directory which contains the
+// ignore file.
+type IgnorePattern struct {
+	// parts contains the pattern split at '/', a pattern which may match at
+	// any level starts with "**".
+	parts []string
+
+	// Negate is true for patterns starting with '!', which include a path
+	// again that has been excluded by a previous pattern.
+	Negate bool
+
+	// DirOnly is true for patterns with a trailing '/', which only match
+	// directories.
+	DirOnly bool
+}
+
+// ParseIgnorePattern parses a line of an ignore file. For empty lines and
+// comments, ok is false.
+//
+// The syntax is the same as for gitignore files: A leading '!' negates the
+// pattern, a trailing '/' only matches directories. A pattern which contains
+// a '/' at the beginning or in the middle is anchored to the directory which
+// contains the ignore file, other patterns match at any level below it. The
+// wildcard '**' matches an arbitrary number of directories. A backslash
+// escapes a leading '#' or '!' and trailing spaces.
+func ParseIgnorePattern(line string) (p IgnorePattern, ok bool, err error) {
+	line = trimTrailingSpaces(line)
+	if line == "" || line[0] == '#' {
+		return IgnorePattern{}, false, nil
+	}
+
+	if line[0] == '!' {
+		p.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return IgnorePattern{}, false, errors.New("empty pattern")
+	}
+
+	if strings.Contains(line, "/") {
+		p.parts = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	} else {
+		p.parts = []string{"**", line}
+	}
+
+	for _, part := range p.parts {
+		if _, err := filepath.Match(part, ""); err != nil {
+			return IgnorePattern{}, false, errors.Errorf("invalid pattern %q: %v", line, err)
+		}
+	}
+
+	return p, true, nil
+}
+
+// trimTrailingSpaces removes trailing spaces from line unless they are escaped
+// with a backslash.
+func trimTrailingSpaces(line string) string {
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") {
+		if strings.HasSuffix(line, `\ `) {
+			return line[:len(line)-2] + " "
+		}
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Match returns true if the pattern matches relpath, which is a path relative
+// to the directory which contains the ignore file. isDir is true if relpath is
+// a directory.
+func (p IgnorePattern) Match(relpath string, isDir bool) bool {
+	if p.DirOnly && !isDir {
+		return false
+	}
+
+	strs := strings.Split(filepath.ToSlash(relpath), "/")
+	return matchIgnore(p.parts, strs)
+}
+
+// matchIgnore returns true if all of strs is matched by patterns. A "**" in
+// patterns matches zero or more items of strs, a trailing "**" matches one
+// or more.
+func matchIgnore(patterns, strs []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			rest := patterns[1:]
+			if len(rest) == 0 {
+				return len(strs) > 0
+			}
+
+			for i := 0; i <= len(strs); i++ {
+				if matchIgnore(rest, strs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(strs) == 0 {
+			return false
+		}
+
+		// the pattern has been checked in ParseIgnorePattern
+		ok, _ := filepath.Match(patterns[0], strs[0])
+		if !ok {
+			return false
+		}
+
+		patterns, strs = patterns[1:], strs[1:]
+	}
+
+	return len(strs) == 0
+}
+
+// IgnoreList is the list of patterns from an ignore file.
+type IgnoreList []IgnorePattern
+
+// ParseIgnoreFile reads the patterns of an ignore file from rd.
+func ParseIgnoreFile(rd io.Reader) (IgnoreList, error) {
+	var list IgnoreList
+
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		p, ok, err := ParseIgnorePattern(scanner.Text())
+		if err != nil {
+			return nil, errors.Errorf("line %d: %v", n, err)
+		}
+
+		if ok {
+			list = append(list, p)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Scan")
+	}
+
+	return list, nil
+}
+
+// Match returns whether relpath is ignored by the list. The last pattern which
+// matches relpath decides, when no pattern matches, decided is false.
+func (l IgnoreList) Match(relpath string, isDir bool) (ignored, decided bool) {
+	for i := len(l) - 1; i >= 0; i-- {
+		if l[i].Match(relpath, isDir) {
+			return !l[i].Negate, true
+		}
+	}
+
+	return false, false
+}
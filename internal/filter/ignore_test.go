@@ -0,0 +1,139 @@
+package filter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/filter"
+)
+
+var ignorePatternTests = []struct {
+	pattern string
+	path    string
+	isDir   bool
+	match   bool
+}{
+	{"foo", "foo", false, true},
+	{"foo", "foo", true, true},
+	{"foo", "bar/foo", false, true},
+	{"foo", "bar/baz/foo", true, true},
+	{"foo", "foobar", false, false},
+	{"foo", "foo/bar", false, false},
+	{"*.o", "main.o", false, true},
+	{"*.o", "src/lib/util.o", false, true},
+	{"*.o", "main.go", false, false},
+	{"/foo", "foo", false, true},
+	{"/foo", "bar/foo", false, false},
+	{"bar/foo", "bar/foo", false, true},
+	{"bar/foo", "x/bar/foo", false, false},
+	{"bar/*.go", "bar/main.go", false, true},
+	{"bar/*.go", "bar/sub/main.go", false, false},
+	{"build/", "build", true, true},
+	{"build/", "build", false, false},
+	{"build/", "src/build", true, true},
+	{"/build/", "src/build", true, false},
+	{"**/foo", "foo", false, true},
+	{"**/foo", "a/b/foo", false, true},
+	{"**/foo/bar", "a/foo/bar", false, true},
+	{"**/foo/bar", "foo/bar", false, true},
+	{"foo/**", "foo", true, false},
+	{"foo/**", "foo/bar", false, true},
+	{"foo/**", "foo/bar/baz", false, true},
+	{"a/**/b", "a/b", false, true},
+	{"a/**/b", "a/x/b", false, true},
+	{"a/**/b", "a/x/y/b", false, true},
+	{"a/**/b", "a/x/y/c", false, false},
+	{`\#file`, "#file", false, true},
+	{`\!important`, "!important", false, true},
+	{`trailing\ `, "trailing ", false, true},
+	{"trailing   ", "trailing", false, true},
+}
+
+func TestIgnorePatternMatch(t *testing.T) {
+	for _, test := range ignorePatternTests {
+		t.Run("", func(t *testing.T) {
+			p, ok, err := filter.ParseIgnorePattern(test.pattern)
+			if err != nil {
+				t.Fatalf("pattern %q: unexpected error: %v", test.pattern, err)
+			}
+			if !ok {
+				t.Fatalf("pattern %q was not parsed", test.pattern)
+			}
+
+			match := p.Match(test.path, test.isDir)
+			if match != test.match {
+				t.Errorf("pattern %q, path %q (dir %v): want %v, got %v",
+					test.pattern, test.path, test.isDir, test.match, match)
+			}
+		})
+	}
+}
+
+func TestParseIgnorePattern(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment"} {
+		_, ok, err := filter.ParseIgnorePattern(line)
+		if err != nil || ok {
+			t.Errorf("line %q: expected no pattern, got ok %v, err %v", line, ok, err)
+		}
+	}
+
+	for _, line := range []string{"!", "/", "[x"} {
+		_, _, err := filter.ParseIgnorePattern(line)
+		if err == nil {
+			t.Errorf("line %q: expected error, got nil", line)
+		}
+	}
+
+	p, _, err := filter.ParseIgnorePattern("!logs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Negate || !p.DirOnly {
+		t.Errorf("wrong flags for pattern: negate %v, dir only %v", p.Negate, p.DirOnly)
+	}
+}
+
+func TestIgnoreList(t *testing.T) {
+	list, err := filter.ParseIgnoreFile(strings.NewReader(`
+# build output
+*.log
+!important.log
+/tmp/
+cache/
+!cache/keep/
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		path    string
+		isDir   bool
+		ignored bool
+		decided bool
+	}{
+		{"debug.log", false, true, true},
+		{"src/debug.log", false, true, true},
+		{"important.log", false, false, true},
+		{"src/important.log", false, false, true},
+		{"tmp", true, true, true},
+		{"src/tmp", true, false, false},
+		{"cache", true, true, true},
+		{"src/cache", true, true, true},
+		{"cache/keep", true, false, true},
+		{"main.go", false, false, false},
+	}
+
+	for _, test := range tests {
+		ignored, decided := list.Match(test.path, test.isDir)
+		if ignored != test.ignored || decided != test.decided {
+			t.Errorf("path %q: want ignored %v, decided %v, got %v, %v",
+				test.path, test.ignored, test.decided, ignored, decided)
+		}
+	}
+
+	_, err = filter.ParseIgnoreFile(strings.NewReader("*.log\n[x\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error for line 2, got %v", err)
+	}
+}
@@ -20,6 +20,7 @@ type Config struct {
 	OwnerIsRoot      bool
 	Host             string
 	Tags             []restic.TagList
+	Labels           restic.Labels
 	Paths            []string
 	SnapshotTemplate string
 }
@@ -5,10 +5,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/list"
 	"github.com/restic/restic/internal/pack"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/worker"
 
@@ -72,33 +74,45 @@ func New(ctx context.Context, repo restic.Repository, ignorePacks restic.IDSet,
 	return idx, invalidFiles, nil
 }
 
-type packJSON struct {
-	ID    restic.ID  `json:"id"`
-	Blobs []blobJSON `json:"blobs"`
-}
+// FromIndex creates a new index from the blobs known to repoIndex, leaving out
+// all packs contained in ignorePacks. In contrast to New, the pack files are
+// not read.
+func FromIndex(ctx context.Context, repoIndex restic.Index, ignorePacks restic.IDSet) (*Index, error) {
+	idx := newIndex()
 
-type blobJSON struct {
-	ID     restic.ID       `json:"id"`
-	Type   restic.BlobType `json:"type"`
-	Offset uint            `json:"offset"`
-	Length uint            `json:"length"`
-}
+	packs := make(map[restic.ID][]restic.Blob)
+	for pb := range repoIndex.Each(ctx) {
+		if ignorePacks.Has(pb.PackID) {
+			continue
+		}
+		packs[pb.PackID] = append(packs[pb.PackID], pb.Blob)
+	}
 
-type indexJSON struct {
-	Supersedes restic.IDs `json:"supersedes,omitempty"`
-	Packs      []packJSON `json:"packs"`
-}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 
-func loadIndexJSON(ctx context.Context, repo restic.Repository, id restic.ID) (*indexJSON, error) {
-	debug.Log("process index %v\n", id)
+	for id, entries := range packs {
+		// a pack may be listed in several index files, so remove duplicate
+		// entries
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Offset < entries[j].Offset
+		})
 
-	var idx indexJSON
-	err := repo.LoadJSONUnpacked(ctx, restic.IndexFile, id, &idx)
-	if err != nil {
-		return nil, err
+		unique := entries[:0]
+		for _, entry := range entries {
+			if len(unique) > 0 && entry.Offset == unique[len(unique)-1].Offset {
+				continue
+			}
+			unique = append(unique, entry)
+		}
+
+		if err := idx.AddPack(id, 0, unique); err != nil {
+			return nil, err
+		}
 	}
 
-	return &idx, nil
+	return idx, nil
 }
 
 // Load creates an index by loading all index files from the repo.
@@ -117,31 +131,25 @@ func Load(ctx context.Context, repo restic.Repository, p *restic.Progress) (*Ind
 		p.Report(restic.Stat{Blobs: 1})
 
 		debug.Log("Load index %v", id)
-		idx, err := loadIndexJSON(ctx, repo, id)
+		idx, err := repository.LoadIndex(ctx, repo, id)
 		if err != nil {
 			return err
 		}
 
 		res := make(map[restic.ID]Pack)
 		supersedes[id] = restic.NewIDSet()
-		for _, sid := range idx.Supersedes {
+		for _, sid := range idx.Supersedes() {
 			debug.Log("  index %v supersedes %v", id, sid)
 			supersedes[id].Insert(sid)
 		}
 
-		for _, jpack := range idx.Packs {
-			entries := make([]restic.Blob, 0, len(jpack.Blobs))
-			for _, blob := range jpack.Blobs {
-				entry := restic.Blob{
-					ID:     blob.ID,
-					Type:   blob.Type,
-					Offset: blob.Offset,
-					Length: blob.Length,
-				}
-				entries = append(entries, entry)
-			}
+		packs := make(map[restic.ID][]restic.Blob)
+		for pb := range idx.Each(ctx) {
+			packs[pb.PackID] = append(packs[pb.PackID], pb.Blob)
+		}
 
-			if err = index.AddPack(jpack.ID, 0, entries); err != nil {
+		for packID, entries := range packs {
+			if err = index.AddPack(packID, 0, entries); err != nil {
 				return err
 			}
 		}
@@ -259,40 +267,33 @@ func (idx *Index) FindBlob(h restic.BlobHandle) (result []Location, err error) {
 
 const maxEntries = 3000
 
-// Save writes the complete index to the repo.
+// Save writes the complete index to the repo. The index files are written in
+// the format used by the repository.
 func (idx *Index) Save(ctx context.Context, repo restic.Repository, supersedes restic.IDs) (restic.IDs, error) {
 	debug.Log("pack files: %d\n", len(idx.Packs))
 
 	var indexIDs []restic.ID
 
 	packs := 0
-	jsonIDX := &indexJSON{
-		Supersedes: supersedes,
-		Packs:      make([]packJSON, 0, maxEntries),
+	newIndex := func() (*repository.Index, error) {
+		ridx := repository.NewIndex()
+		return ridx, ridx.AddToSupersedes(supersedes...)
+	}
+
+	ridx, err := newIndex()
+	if err != nil {
+		return nil, err
 	}
 
 	for packID, pack := range idx.Packs {
 		debug.Log("%04d add pack %v with %d entries", packs, packID, len(pack.Entries))
-		b := make([]blobJSON, 0, len(pack.Entries))
 		for _, blob := range pack.Entries {
-			b = append(b, blobJSON{
-				ID:     blob.ID,
-				Type:   blob.Type,
-				Offset: blob.Offset,
-				Length: blob.Length,
-			})
+			ridx.Store(restic.PackedBlob{Blob: blob, PackID: packID})
 		}
 
-		p := packJSON{
-			ID:    packID,
-			Blobs: b,
-		}
-
-		jsonIDX.Packs = append(jsonIDX.Packs, p)
-
 		packs++
 		if packs == maxEntries {
-			id, err := repo.SaveJSONUnpacked(ctx, restic.IndexFile, jsonIDX)
+			id, err := repository.SaveIndex(ctx, repo, ridx)
 			if err != nil {
 				return nil, err
 			}
@@ -300,12 +301,15 @@ func (idx *Index) Save(ctx context.Context, repo restic.Repository, supersedes r
 
 			indexIDs = append(indexIDs, id)
 			packs = 0
-			jsonIDX.Packs = jsonIDX.Packs[:0]
+			ridx, err = newIndex()
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	if packs > 0 {
-		id, err := repo.SaveJSONUnpacked(ctx, restic.IndexFile, jsonIDX)
+		id, err := repository.SaveIndex(ctx, repo, ridx)
 		if err != nil {
 			return nil, err
 		}
@@ -185,6 +185,62 @@ func BenchmarkIndexSave(b *testing.B) {
 	}
 }
 
+func TestIndexFromIndex(t *testing.T) {
+	repo, cleanup := createFilledRepo(t, 3, 0)
+	defer cleanup()
+
+	err := repo.LoadIndex(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newIdx, _, err := New(context.TODO(), repo, restic.NewIDSet(), nil)
+	if err != nil {
+		t.Fatalf("New() returned error %v", err)
+	}
+
+	idx, err := FromIndex(context.TODO(), repo.Index(), restic.NewIDSet())
+	if err != nil {
+		t.Fatalf("FromIndex() returned error %v", err)
+	}
+
+	validateIndex(t, repo, idx)
+
+	if len(idx.Packs) != len(newIdx.Packs) {
+		t.Fatalf("number of packs does not match: want %v, got %v",
+			len(newIdx.Packs), len(idx.Packs))
+	}
+
+	for packID, pack := range newIdx.Packs {
+		if len(idx.Packs[packID].Entries) != len(pack.Entries) {
+			t.Errorf("number of entries in pack %v does not match: want %d, got %d",
+				packID.Str(), len(pack.Entries), len(idx.Packs[packID].Entries))
+		}
+	}
+
+	// leave out a single pack
+	ignorePacks := restic.NewIDSet()
+	for packID := range newIdx.Packs {
+		ignorePacks.Insert(packID)
+		break
+	}
+
+	idx, err = FromIndex(context.TODO(), repo.Index(), ignorePacks)
+	if err != nil {
+		t.Fatalf("FromIndex() returned error %v", err)
+	}
+
+	if len(idx.Packs) != len(newIdx.Packs)-1 {
+		t.Fatalf("wrong number of packs: want %v, got %v", len(newIdx.Packs)-1, len(idx.Packs))
+	}
+
+	for packID := range ignorePacks {
+		if _, ok := idx.Packs[packID]; ok {
+			t.Errorf("ignored pack %v found in the index", packID.Str())
+		}
+	}
+}
+
 func TestIndexDuplicateBlobs(t *testing.T) {
 	repo, cleanup := createFilledRepo(t, 3, 0.01)
 	defer cleanup()
@@ -96,6 +96,10 @@ func (m *S3Layout) Apply(ctx context.Context, repo restic.Repository) error {
 		restic.DataFile,
 		restic.KeyFile,
 		restic.LockFile,
+		restic.ParityFile,
+		restic.DeletionFile,
+		restic.SessionKeyFile,
+		restic.RepairFile,
 	} {
 		err := m.moveFiles(ctx, be, newLayout, t)
 		if err != nil {
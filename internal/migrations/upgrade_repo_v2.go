@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&UpgradeRepoV2{})
+}
+
+// UpgradeRepoV2 upgrades a repository from format version 1 to version 2 and
+// enables compression for new data.
+type UpgradeRepoV2 struct{}
+
+// Check tests whether the migration can be applied.
+func (m *UpgradeRepoV2) Check(ctx context.Context, repo restic.Repository) (bool, error) {
+	if repo.Config().Version >= 2 {
+		debug.Log("repository already has version %v", repo.Config().Version)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Apply runs the migration.
+func (m *UpgradeRepoV2) Apply(ctx context.Context, repo restic.Repository) error {
+	cfg := repo.Config()
+	cfg.Version = 2
+	if !cfg.Compression.Enabled() {
+		cfg.Compression = restic.CompressionAuto
+	}
+
+	return writeConfig(ctx, repo, cfg)
+}
+
+// writeConfig replaces the config file of repo with cfg.
+func writeConfig(ctx context.Context, repo restic.Repository, cfg restic.Config) error {
+	h := restic.Handle{Type: restic.ConfigFile}
+
+	// keep a copy of the old config file so it can be restored when writing
+	// the new one fails
+	oldConfig, err := backend.LoadAll(ctx, repo.Backend(), h)
+	if err != nil {
+		return errors.Wrap(err, "load old config")
+	}
+
+	err = repo.Backend().Remove(ctx, h)
+	if err != nil {
+		return errors.Wrap(err, "remove old config")
+	}
+
+	// the new config is used from now on, e.g. to select the key for index
+	// files, and also for the config file itself
+	oldCfg := repo.Config()
+	repo.SetConfig(cfg)
+
+	_, err = repo.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
+	if err != nil {
+		debug.Log("saving new config failed: %v, restoring old config", err)
+		repo.SetConfig(oldCfg)
+		rerr := repo.Backend().Save(ctx, h, restic.NewByteReader(oldConfig))
+		if rerr != nil {
+			fmt.Fprintf(os.Stderr, "restoring the old config file failed: %v\n", rerr)
+		}
+
+		return errors.Wrap(err, "save new config")
+	}
+
+	return nil
+}
+
+// Name returns the name for this migration.
+func (m *UpgradeRepoV2) Name() string {
+	return "upgrade_repo_v2"
+}
+
+// Desc returns a short description what the migration does.
+func (m *UpgradeRepoV2) Desc() string {
+	return "upgrade the repository to format version 2, which supports compression"
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&UpgradeRepoV3{})
+}
+
+// UpgradeRepoV3 upgrades a repository to format version 3 and converts all
+// index files to the binary format.
+type UpgradeRepoV3 struct{}
+
+// Check tests whether the migration can be applied.
+func (m *UpgradeRepoV3) Check(ctx context.Context, repo restic.Repository) (bool, error) {
+	if repo.Config().Version >= 3 {
+		debug.Log("repository already has version %v", repo.Config().Version)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Apply runs the migration.
+func (m *UpgradeRepoV3) Apply(ctx context.Context, repo restic.Repository) error {
+	// only the index files which exist before the config is updated are
+	// converted, index files saved by concurrent backups in the meantime are
+	// kept as they are and can still be read
+	var ids restic.IDs
+	err := repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg := repo.Config()
+	if cfg.Version < 2 && !cfg.Compression.Enabled() {
+		cfg.Compression = restic.CompressionAuto
+	}
+	cfg.Version = 3
+
+	// the config is updated first, so that clients which do not support the
+	// binary index format refuse to access the repository
+	err = writeConfig(ctx, repo, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		newID, err := repository.ConvertIndex(ctx, repo, id)
+		if err != nil {
+			return errors.Wrapf(err, "convert index %v", id.Str())
+		}
+		debug.Log("index %v converted to %v", id, newID)
+	}
+
+	return nil
+}
+
+// Name returns the name for this migration.
+func (m *UpgradeRepoV3) Name() string {
+	return "upgrade_repo_v3"
+}
+
+// Desc returns a short description what the migration does.
+func (m *UpgradeRepoV3) Desc() string {
+	return "upgrade the repository to format version 3, which stores index files in a compact binary format"
+}
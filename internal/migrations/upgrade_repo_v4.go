@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&UpgradeRepoV4{})
+}
+
+// UpgradeRepoV4 upgrades a repository from format version 3 to version 4 and
+// encrypts all index files with the index key, so that write-only keys can be
+// used for the repository.
+type UpgradeRepoV4 struct{}
+
+// Check tests whether the migration can be applied.
+func (m *UpgradeRepoV4) Check(ctx context.Context, repo restic.Repository) (bool, error) {
+	if repo.Config().Version != 3 {
+		debug.Log("repository has version %v, not 3", repo.Config().Version)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Apply runs the migration.
+func (m *UpgradeRepoV4) Apply(ctx context.Context, repo restic.Repository) error {
+	cfg := repo.Config()
+	cfg.Version = 4
+
+	// the config is written with the index key, so it must be updated before
+	// the index files
+	err := writeConfig(ctx, repo, cfg)
+	if err != nil {
+		return err
+	}
+
+	var ids restic.IDs
+	err = repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		newID, err := repository.ReencryptIndex(ctx, repo, id)
+		if err != nil {
+			return errors.Wrapf(err, "re-encrypt index %v", id.Str())
+		}
+		debug.Log("index %v re-encrypted as %v", id, newID)
+	}
+
+	return nil
+}
+
+// Name returns the name for this migration.
+func (m *UpgradeRepoV4) Name() string {
+	return "upgrade_repo_v4"
+}
+
+// Desc returns a short description what the migration does.
+func (m *UpgradeRepoV4) Desc() string {
+	return "upgrade the repository to format version 4, which supports write-only keys"
+}
@@ -18,7 +18,8 @@ type Repository struct {
 	SaveIndexFn     func() error
 	LoadIndexFn     func() error
 
-	ConfigFn func() restic.Config
+	ConfigFn    func() restic.Config
+	SetConfigFn func(restic.Config)
 
 	LookupBlobSizeFn func(restic.ID, restic.BlobType) (uint, error)
 
@@ -80,6 +81,11 @@ func (repo Repository) Config() restic.Config {
 	return repo.ConfigFn()
 }
 
+// SetConfig is a stub method.
+func (repo Repository) SetConfig(cfg restic.Config) {
+	repo.SetConfigFn(cfg)
+}
+
 // LookupBlobSize is a stub method.
 func (repo Repository) LookupBlobSize(id restic.ID, t restic.BlobType) (uint, error) {
 	return repo.LookupBlobSizeFn(id, t)
@@ -35,12 +35,14 @@ func NewPacker(k *crypto.Key, wr io.Writer) *Packer {
 }
 
 // Add saves the data read from rd as a new blob to the packer. Returned is the
-// number of bytes written to the pack.
-func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte) (int, error) {
+// number of bytes written to the pack. For compressed blobs,
+// uncompressedLength is the length of the data before compression, it must be
+// zero for blobs that are stored uncompressed.
+func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte, uncompressedLength int) (int, error) {
 	p.m.Lock()
 	defer p.m.Unlock()
 
-	c := restic.Blob{Type: t, ID: id}
+	c := restic.Blob{Type: t, ID: id, UncompressedLength: uint(uncompressedLength)}
 
 	n, err := p.wr.Write(data)
 	c.Length = uint(n)
@@ -51,7 +53,10 @@ func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte) (int, error)
 	return n, errors.Wrap(err, "Write")
 }
 
-var entrySize = uint(binary.Size(restic.BlobType(0)) + binary.Size(uint32(0)) + len(restic.ID{}))
+var (
+	entrySize           = uint(binary.Size(restic.BlobType(0)) + binary.Size(uint32(0)) + len(restic.ID{}))
+	compressedEntrySize = entrySize + uint(binary.Size(uint32(0)))
+)
 
 // headerEntry is used with encoding/binary to read and write header entries
 type headerEntry struct {
@@ -60,6 +65,15 @@ type headerEntry struct {
 	ID     restic.ID
 }
 
+// compressedHeaderEntry is used with encoding/binary to read and write header
+// entries of compressed blobs
+type compressedHeaderEntry struct {
+	Type               uint8
+	Length             uint32
+	UncompressedLength uint32
+	ID                 restic.ID
+}
+
 // Finalize writes the header for all added blobs and finalizes the pack.
 // Returned are the number of bytes written, including the header. If the
 // underlying writer implements io.Closer, it is closed.
@@ -76,7 +90,7 @@ func (p *Packer) Finalize() (uint, error) {
 	}
 
 	encryptedHeader := make([]byte, 0, hdrBuf.Len()+p.k.Overhead()+p.k.NonceSize())
-	nonce := crypto.NewRandomNonce()
+	nonce := p.k.NewNonce()
 	encryptedHeader = append(encryptedHeader, nonce...)
 	encryptedHeader = p.k.Seal(encryptedHeader, nonce, hdrBuf.Bytes(), nil)
 
@@ -94,7 +108,7 @@ func (p *Packer) Finalize() (uint, error) {
 	bytesWritten += uint(hdrBytes)
 
 	// write length
-	err = binary.Write(p.wr, binary.LittleEndian, uint32(restic.CiphertextLength(len(p.blobs)*int(entrySize))))
+	err = binary.Write(p.wr, binary.LittleEndian, uint32(hdrBytes))
 	if err != nil {
 		return 0, errors.Wrap(err, "binary.Write")
 	}
@@ -112,18 +126,42 @@ func (p *Packer) Finalize() (uint, error) {
 // writeHeader constructs and writes the header to wr.
 func (p *Packer) writeHeader(wr io.Writer) (bytesWritten uint, err error) {
 	for _, b := range p.blobs {
-		entry := headerEntry{
-			Length: uint32(b.Length),
-			ID:     b.ID,
-		}
-
-		switch b.Type {
-		case restic.DataBlob:
-			entry.Type = 0
-		case restic.TreeBlob:
-			entry.Type = 1
-		default:
-			return 0, errors.Errorf("invalid blob type %v", b.Type)
+		var entry interface{}
+		var size uint
+
+		if b.IsCompressed() {
+			e := compressedHeaderEntry{
+				Length:             uint32(b.Length),
+				UncompressedLength: uint32(b.UncompressedLength),
+				ID:                 b.ID,
+			}
+
+			switch b.Type {
+			case restic.DataBlob:
+				e.Type = 2
+			case restic.TreeBlob:
+				e.Type = 3
+			default:
+				return 0, errors.Errorf("invalid blob type %v", b.Type)
+			}
+
+			entry, size = e, compressedEntrySize
+		} else {
+			e := headerEntry{
+				Length: uint32(b.Length),
+				ID:     b.ID,
+			}
+
+			switch b.Type {
+			case restic.DataBlob:
+				e.Type = 0
+			case restic.TreeBlob:
+				e.Type = 1
+			default:
+				return 0, errors.Errorf("invalid blob type %v", b.Type)
+			}
+
+			entry, size = e, entrySize
 		}
 
 		err := binary.Write(wr, binary.LittleEndian, entry)
@@ -131,7 +169,7 @@ func (p *Packer) writeHeader(wr io.Writer) (bytesWritten uint, err error) {
 			return bytesWritten, errors.Wrap(err, "binary.Write")
 		}
 
-		bytesWritten += entrySize
+		bytesWritten += size
 	}
 
 	return
@@ -153,6 +191,15 @@ func (p *Packer) Count() int {
 	return len(p.blobs)
 }
 
+// HeaderFull returns true if the header cannot hold another blob entry
+// without exceeding maxHeaderSize.
+func (p *Packer) HeaderFull() bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return uint(len(p.blobs)+1)*compressedEntrySize+crypto.Extension > maxHeaderSize
+}
+
 // Blobs returns the slice of blobs that have been written.
 func (p *Packer) Blobs() []restic.Blob {
 	p.m.Lock()
@@ -186,7 +233,8 @@ const (
 // readRecords reads up to max records from the underlying ReaderAt, returning
 // the raw header, the total number of records in the header, and any error.
 // If the header contains fewer than max entries, the header is truncated to
-// the appropriate size.
+// the appropriate size. Since entries for compressed blobs are larger, the
+// number of records is counted in units of entrySize, rounded up.
 func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
 	var bufsize int
 	bufsize += max * int(entrySize)
@@ -213,8 +261,6 @@ func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
 		err = InvalidFileError{Message: "header length is zero"}
 	case hlen < crypto.Extension:
 		err = InvalidFileError{Message: "header length is too small"}
-	case (hlen-crypto.Extension)%uint32(entrySize) != 0:
-		err = InvalidFileError{Message: "header length is invalid"}
 	case int64(hlen) > size-int64(headerLengthSize):
 		err = InvalidFileError{Message: "header is larger than file"}
 	case int64(hlen) > maxHeaderSize:
@@ -224,8 +270,8 @@ func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
 		return nil, 0, errors.Wrap(err, "readHeader")
 	}
 
-	total := (int(hlen) - crypto.Extension) / int(entrySize)
-	if total < max {
+	total := (int(hlen) - crypto.Extension + int(entrySize) - 1) / int(entrySize)
+	if int(hlen) <= len(b) {
 		// truncate to the beginning of the pack header
 		b = b[len(b)-int(hlen):]
 	}
@@ -287,41 +333,65 @@ func List(k *crypto.Key, rd io.ReaderAt, size int64) (entries []restic.Blob, err
 		return nil, err
 	}
 
-	hdrRd := bytes.NewReader(buf)
-
 	entries = make([]restic.Blob, 0, uint(len(buf))/entrySize)
 
 	pos := uint(0)
-	for {
-		e := headerEntry{}
-		err = binary.Read(hdrRd, binary.LittleEndian, &e)
-		if errors.Cause(err) == io.EOF {
-			break
-		}
-
+	for len(buf) > 0 {
+		entry, n, err := parseHeaderEntry(buf)
 		if err != nil {
-			return nil, errors.Wrap(err, "binary.Read")
+			return nil, err
 		}
 
-		entry := restic.Blob{
-			Length: uint(e.Length),
-			ID:     e.ID,
-			Offset: pos,
-		}
+		entry.Offset = pos
+		entries = append(entries, entry)
 
-		switch e.Type {
-		case 0:
-			entry.Type = restic.DataBlob
-		case 1:
-			entry.Type = restic.TreeBlob
-		default:
-			return nil, errors.Errorf("invalid type %d", e.Type)
+		pos += entry.Length
+		buf = buf[n:]
+	}
+
+	return entries, nil
+}
+
+// parseHeaderEntry decodes the header entry at the start of p. Returned is the
+// blob and the number of bytes the entry occupies.
+func parseHeaderEntry(p []byte) (b restic.Blob, size uint, err error) {
+	if uint(len(p)) < entrySize {
+		return b, 0, errors.Errorf("parseHeaderEntry: buffer of size %d too short", len(p))
+	}
+
+	switch p[0] {
+	case 0, 2:
+		b.Type = restic.DataBlob
+	case 1, 3:
+		b.Type = restic.TreeBlob
+	default:
+		return b, 0, errors.Errorf("invalid type %d", p[0])
+	}
+
+	if p[0] < 2 {
+		var e headerEntry
+		err = binary.Read(bytes.NewReader(p[:entrySize]), binary.LittleEndian, &e)
+		if err != nil {
+			return b, 0, errors.Wrap(err, "binary.Read")
 		}
 
-		entries = append(entries, entry)
+		b.Length = uint(e.Length)
+		b.ID = e.ID
+		return b, entrySize, nil
+	}
 
-		pos += uint(e.Length)
+	if uint(len(p)) < compressedEntrySize {
+		return b, 0, errors.Errorf("parseHeaderEntry: buffer of size %d too short", len(p))
 	}
 
-	return entries, nil
+	var e compressedHeaderEntry
+	err = binary.Read(bytes.NewReader(p[:compressedEntrySize]), binary.LittleEndian, &e)
+	if err != nil {
+		return b, 0, errors.Wrap(err, "binary.Read")
+	}
+
+	b.Length = uint(e.Length)
+	b.UncompressedLength = uint(e.UncompressedLength)
+	b.ID = e.ID
+	return b, compressedEntrySize, nil
 }
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -108,3 +109,22 @@ func TestReadRecords(t *testing.T) {
 		}
 	}
 }
+
+func TestPackerHeaderFull(t *testing.T) {
+	buf := &bytes.Buffer{}
+	p := NewPacker(crypto.NewRandomKey(), buf)
+
+	for !p.HeaderFull() {
+		_, err := p.Add(restic.DataBlob, restic.NewRandomID(), []byte{0}, 1)
+		rtest.OK(t, err)
+	}
+
+	_, err := p.Finalize()
+	rtest.OK(t, err)
+
+	data := buf.Bytes()
+	hlen := binary.LittleEndian.Uint32(data[len(data)-headerLengthSize:])
+	rtest.Assert(t, hlen <= maxHeaderSize, "header length %d exceeds maxHeaderSize", hlen)
+	rtest.Assert(t, hlen+uint32(compressedEntrySize) > maxHeaderSize,
+		"packer reported a full header at %d bytes", hlen)
+}
@@ -38,7 +38,7 @@ func newPack(t testing.TB, k *crypto.Key, lengths []int) ([]Buf, []byte, uint) {
 	// pack blobs
 	p := pack.NewPacker(k, nil)
 	for _, b := range bufs {
-		p.Add(restic.TreeBlob, b.id, b.data)
+		p.Add(restic.TreeBlob, b.id, b.data, 0)
 	}
 
 	_, err := p.Finalize()
@@ -94,6 +94,50 @@ func TestCreatePack(t *testing.T) {
 	verifyBlobs(t, bufs, k, bytes.NewReader(packData), packSize)
 }
 
+func TestCreatePackCompressed(t *testing.T) {
+	k := crypto.NewRandomKey()
+
+	p := pack.NewPacker(k, nil)
+	var blobs []restic.Blob
+	for i, l := range testLens {
+		b := restic.Blob{
+			Type: restic.DataBlob,
+			ID:   restic.NewRandomID(),
+		}
+		if i%2 == 0 {
+			b.Type = restic.TreeBlob
+		}
+		// mix compressed and uncompressed blobs
+		if i%3 != 0 {
+			b.UncompressedLength = uint(2 * l)
+		}
+
+		_, err := p.Add(b.Type, b.ID, rtest.Random(i, l), int(b.UncompressedLength))
+		rtest.OK(t, err)
+		blobs = append(blobs, b)
+	}
+
+	size, err := p.Finalize()
+	rtest.OK(t, err)
+
+	packData := p.Writer().(*bytes.Buffer).Bytes()
+	rtest.Equals(t, uint(len(packData)), size)
+
+	entries, err := pack.List(k, bytes.NewReader(packData), int64(len(packData)))
+	rtest.OK(t, err)
+	rtest.Equals(t, len(blobs), len(entries))
+
+	var offset uint
+	for i, e := range entries {
+		rtest.Equals(t, blobs[i].ID, e.ID)
+		rtest.Equals(t, blobs[i].Type, e.Type)
+		rtest.Equals(t, blobs[i].UncompressedLength, e.UncompressedLength)
+		rtest.Equals(t, uint(testLens[i]), e.Length)
+		rtest.Equals(t, offset, e.Offset)
+		offset += e.Length
+	}
+}
+
 var blobTypeJSON = []struct {
 	t   restic.BlobType
 	res string
@@ -0,0 +1,4 @@
+// Package parity implements a Reed-Solomon erasure code, which is used to
+// store redundancy data for files in the repository. With the parity data,
+// damaged parts of a file can be located and reconstructed.
+package parity
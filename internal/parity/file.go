@@ -0,0 +1,218 @@
+package parity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// fileVersion is the version of the binary format of a parity file.
+const fileVersion = 1
+
+// header is the fixed-size beginning of an encoded parity file. It is
+// followed by the SHA-256 hashes of all shards, followed by the parity shards.
+type header struct {
+	Version      uint8
+	DataShards   uint8
+	ParityShards uint8
+	ShardSize    uint32
+	Length       uint64
+}
+
+var headerSize = binary.Size(header{})
+
+// File contains the redundancy data for a file: The file is split into
+// DataShards shards of equal size (the last shard is padded with zeroes), for
+// which ParityShards parity shards are computed. The hashes of all shards are
+// used to find out which shards of a damaged file need to be reconstructed.
+type File struct {
+	DataShards   int
+	ParityShards int
+	ShardSize    int
+	Length       int64
+
+	// Hashes contains the hashes of the data shards followed by the hashes
+	// of the parity shards.
+	Hashes [][sha256.Size]byte
+	Parity [][]byte
+}
+
+// New computes the parity data for data.
+func New(data []byte, dataShards, parityShards int) (*File, error) {
+	enc, err := NewEncoder(dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		DataShards:   dataShards,
+		ParityShards: parityShards,
+		ShardSize:    (len(data) + dataShards - 1) / dataShards,
+		Length:       int64(len(data)),
+	}
+
+	shards := f.split(data)
+	for i := 0; i < parityShards; i++ {
+		shards = append(shards, make([]byte, f.ShardSize))
+	}
+
+	if err = enc.Encode(shards); err != nil {
+		return nil, err
+	}
+
+	f.Parity = shards[dataShards:]
+	for _, shard := range shards {
+		f.Hashes = append(f.Hashes, sha256.Sum256(shard))
+	}
+
+	return f, nil
+}
+
+// split returns the data shards for data. The data is padded or truncated to
+// the length recorded in f.
+func (f *File) split(data []byte) [][]byte {
+	buf := make([]byte, f.DataShards*f.ShardSize)
+	if int64(len(data)) > f.Length {
+		data = data[:f.Length]
+	}
+	copy(buf, data)
+
+	shards := make([][]byte, 0, f.DataShards+f.ParityShards)
+	for i := 0; i < f.DataShards; i++ {
+		shards = append(shards, buf[i*f.ShardSize:(i+1)*f.ShardSize])
+	}
+
+	return shards
+}
+
+// Damaged returns the indexes of all shards of data and of the parity data
+// which do not match their hash.
+func (f *File) Damaged(data []byte) (damaged []int) {
+	return f.damagedShards(append(f.split(data), f.Parity...))
+}
+
+func (f *File) damagedShards(shards [][]byte) (damaged []int) {
+	for i, shard := range shards {
+		if sha256.Sum256(shard) != f.Hashes[i] {
+			damaged = append(damaged, i)
+		}
+	}
+
+	return damaged
+}
+
+// Repair returns the original data for data, which may be damaged or
+// truncated. If more than ParityShards shards are damaged, ErrTooFewShards is
+// returned.
+func (f *File) Repair(data []byte) ([]byte, error) {
+	shards := append(f.split(data), f.Parity...)
+
+	damaged := f.damagedShards(shards)
+	if len(damaged) > 0 {
+		enc, err := NewEncoder(f.DataShards, f.ParityShards)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range damaged {
+			shards[i] = nil
+		}
+
+		if err = enc.Reconstruct(shards); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, 0, f.DataShards*f.ShardSize)
+	for _, shard := range shards[:f.DataShards] {
+		buf = append(buf, shard...)
+	}
+
+	return buf[:f.Length], nil
+}
+
+// MarshalBinary encodes f.
+func (f *File) MarshalBinary() ([]byte, error) {
+	if len(f.Hashes) != f.DataShards+f.ParityShards || len(f.Parity) != f.ParityShards {
+		return nil, errors.New("invalid parity data")
+	}
+
+	hdr := header{
+		Version:      fileVersion,
+		DataShards:   uint8(f.DataShards),
+		ParityShards: uint8(f.ParityShards),
+		ShardSize:    uint32(f.ShardSize),
+		Length:       uint64(f.Length),
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, headerSize+len(f.Hashes)*sha256.Size+f.ParityShards*f.ShardSize))
+	if err := binary.Write(buf, binary.LittleEndian, hdr); err != nil {
+		return nil, errors.Wrap(err, "binary.Write")
+	}
+
+	for _, h := range f.Hashes {
+		buf.Write(h[:])
+	}
+
+	for _, shard := range f.Parity {
+		if len(shard) != f.ShardSize {
+			return nil, errors.New("invalid parity shard size")
+		}
+		buf.Write(shard)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the parity file in buf into f.
+func (f *File) UnmarshalBinary(buf []byte) error {
+	var hdr header
+	if len(buf) < headerSize {
+		return errors.New("parity file is too short")
+	}
+
+	err := binary.Read(bytes.NewReader(buf[:headerSize]), binary.LittleEndian, &hdr)
+	if err != nil {
+		return errors.Wrap(err, "binary.Read")
+	}
+	buf = buf[headerSize:]
+
+	if hdr.Version != fileVersion {
+		return errors.Errorf("unsupported parity file version %d", hdr.Version)
+	}
+
+	shards := int(hdr.DataShards) + int(hdr.ParityShards)
+	if hdr.DataShards == 0 || hdr.ParityShards == 0 || shards > MaxShards {
+		return errors.Errorf("invalid number of shards %d/%d", hdr.DataShards, hdr.ParityShards)
+	}
+
+	if hdr.Length > uint64(hdr.DataShards)*uint64(hdr.ShardSize) {
+		return errors.New("invalid length")
+	}
+
+	if len(buf) != shards*sha256.Size+int(hdr.ParityShards)*int(hdr.ShardSize) {
+		return errors.New("invalid parity file size")
+	}
+
+	*f = File{
+		DataShards:   int(hdr.DataShards),
+		ParityShards: int(hdr.ParityShards),
+		ShardSize:    int(hdr.ShardSize),
+		Length:       int64(hdr.Length),
+	}
+
+	for i := 0; i < shards; i++ {
+		var h [sha256.Size]byte
+		copy(h[:], buf[i*sha256.Size:])
+		f.Hashes = append(f.Hashes, h)
+	}
+	buf = buf[shards*sha256.Size:]
+
+	for i := 0; i < f.ParityShards; i++ {
+		f.Parity = append(f.Parity, buf[i*f.ShardSize:(i+1)*f.ShardSize])
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package parity
+
+import (
+	"bytes"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRepair(t *testing.T) {
+	data := rtest.Random(23, 100*1024+17)
+
+	f, err := New(data, 10, 2)
+	rtest.OK(t, err)
+
+	// damage two shards
+	damaged := append([]byte{}, data...)
+	damaged[5] ^= 0x01
+	damaged[len(damaged)-1] ^= 0xff
+
+	rtest.Equals(t, []int{0, 9}, f.Damaged(damaged))
+
+	repaired, err := f.Repair(damaged)
+	rtest.OK(t, err)
+	if !bytes.Equal(repaired, data) {
+		t.Fatal("data was not repaired correctly")
+	}
+
+	// repair a truncated file
+	repaired, err = f.Repair(data[:len(data)-20*1024])
+	rtest.OK(t, err)
+	if !bytes.Equal(repaired, data) {
+		t.Fatal("truncated data was not repaired correctly")
+	}
+
+	// too much damage
+	for i := 0; i < 3; i++ {
+		damaged[i*f.ShardSize] ^= 0x01
+	}
+	_, err = f.Repair(damaged)
+	if err != ErrTooFewShards {
+		t.Fatalf("expected ErrTooFewShards, got %v", err)
+	}
+}
+
+func TestFileMarshal(t *testing.T) {
+	data := rtest.Random(42, 12345)
+
+	f, err := New(data, 7, 3)
+	rtest.OK(t, err)
+
+	buf, err := f.MarshalBinary()
+	rtest.OK(t, err)
+
+	var f2 File
+	rtest.OK(t, f2.UnmarshalBinary(buf))
+	rtest.Equals(t, f, &f2)
+
+	_, err = f2.Repair(data)
+	rtest.OK(t, err)
+
+	for _, l := range []int{0, headerSize, len(buf) - 1} {
+		var f3 File
+		if err = f3.UnmarshalBinary(buf[:l]); err == nil {
+			t.Errorf("expected error for truncated buffer of length %d", l)
+		}
+	}
+}
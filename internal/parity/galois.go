@@ -0,0 +1,65 @@
+package parity
+
+// Arithmetic in the finite field GF(2^8), using the polynomial
+// x^8 + x^4 + x^3 + x^2 + 1 (0x11d) and the generator 2.
+
+const fieldSize = 256
+
+var (
+	expTable [2 * fieldSize]byte
+	logTable [fieldSize]byte
+
+	// mulTable contains the products of all pairs of field elements.
+	mulTable [fieldSize][fieldSize]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < fieldSize-1; i++ {
+		expTable[i] = byte(x)
+		logTable[x] = byte(i)
+
+		x <<= 1
+		if x >= fieldSize {
+			x ^= 0x11d
+		}
+	}
+
+	// duplicate the table so that the sum of two logarithms can be used as
+	// an index without reducing it first
+	for i := fieldSize - 1; i < len(expTable); i++ {
+		expTable[i] = expTable[i-(fieldSize-1)]
+	}
+
+	for a := 1; a < fieldSize; a++ {
+		for b := 1; b < fieldSize; b++ {
+			mulTable[a][b] = expTable[int(logTable[a])+int(logTable[b])]
+		}
+	}
+}
+
+// galMul returns the product of a and b.
+func galMul(a, b byte) byte {
+	return mulTable[a][b]
+}
+
+// galInv returns the multiplicative inverse of a, which must not be zero.
+func galInv(a byte) byte {
+	if a == 0 {
+		panic("division by zero")
+	}
+	return expTable[fieldSize-1-int(logTable[a])]
+}
+
+// galMulSliceXor multiplies each byte in in with c and adds (xor) the result
+// to the corresponding byte in out.
+func galMulSliceXor(c byte, in, out []byte) {
+	if c == 0 {
+		return
+	}
+
+	t := &mulTable[c]
+	for i, v := range in {
+		out[i] ^= t[v]
+	}
+}
@@ -0,0 +1,228 @@
+package parity
+
+import (
+	"github.com/restic/restic/internal/errors"
+)
+
+// MaxShards is the maximum number of data and parity shards combined.
+const MaxShards = fieldSize
+
+// ErrTooFewShards is returned when not enough intact shards are available to
+// reconstruct the data.
+var ErrTooFewShards = errors.New("too few intact shards for reconstruction")
+
+// Encoder computes parity shards for data shards using a systematic
+// Reed-Solomon code, and reconstructs missing shards from the remaining ones.
+// Any dataShards intact shards are sufficient to reconstruct all other shards.
+type Encoder struct {
+	dataShards   int
+	parityShards int
+
+	// matrix is the encoding matrix with dataShards+parityShards rows and
+	// dataShards columns. The upper part is the identity matrix, the lower
+	// part is a Cauchy matrix, so that any dataShards rows are linearly
+	// independent.
+	matrix [][]byte
+}
+
+// NewEncoder returns an Encoder for the given number of data and parity
+// shards.
+func NewEncoder(dataShards, parityShards int) (*Encoder, error) {
+	if dataShards <= 0 || parityShards <= 0 {
+		return nil, errors.Errorf("invalid number of shards %d/%d", dataShards, parityShards)
+	}
+
+	if dataShards+parityShards > MaxShards {
+		return nil, errors.Errorf("too many shards, at most %d are supported", MaxShards)
+	}
+
+	e := &Encoder{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		matrix:       make([][]byte, dataShards+parityShards),
+	}
+
+	for i := range e.matrix {
+		e.matrix[i] = make([]byte, dataShards)
+		if i < dataShards {
+			e.matrix[i][i] = 1
+			continue
+		}
+
+		// the elements x_i = i and y_j = j are distinct for i >= dataShards
+		for j := 0; j < dataShards; j++ {
+			e.matrix[i][j] = galInv(byte(i) ^ byte(j))
+		}
+	}
+
+	return e, nil
+}
+
+// checkShards returns an error if shards does not have the right number of
+// shards or if the shards are not all of the same size. Missing shards are
+// nil.
+func (e *Encoder) checkShards(shards [][]byte) (size int, err error) {
+	if len(shards) != e.dataShards+e.parityShards {
+		return 0, errors.Errorf("wrong number of shards, want %d, got %d", e.dataShards+e.parityShards, len(shards))
+	}
+
+	size = -1
+	for _, shard := range shards {
+		if shard == nil {
+			continue
+		}
+
+		if size == -1 {
+			size = len(shard)
+		}
+
+		if len(shard) != size {
+			return 0, errors.New("shards have different sizes")
+		}
+	}
+
+	return size, nil
+}
+
+// Encode computes the parity shards from the data shards. shards must
+// contain the data shards followed by the parity shards, which are
+// overwritten.
+func (e *Encoder) Encode(shards [][]byte) error {
+	for _, shard := range shards {
+		if shard == nil {
+			return errors.New("missing shard")
+		}
+	}
+
+	if _, err := e.checkShards(shards); err != nil {
+		return err
+	}
+
+	for i := e.dataShards; i < len(shards); i++ {
+		e.computeShard(e.matrix[i], shards[:e.dataShards], shards[i])
+	}
+
+	return nil
+}
+
+// computeShard sets out to the linear combination of the shards in input with
+// the coefficients in row.
+func (e *Encoder) computeShard(row []byte, input [][]byte, out []byte) {
+	for i := range out {
+		out[i] = 0
+	}
+
+	for j, c := range row {
+		galMulSliceXor(c, input[j], out)
+	}
+}
+
+// Reconstruct recomputes all missing shards, which must be nil, from the
+// remaining shards in place. ErrTooFewShards is returned when less than
+// dataShards shards are available.
+func (e *Encoder) Reconstruct(shards [][]byte) error {
+	size, err := e.checkShards(shards)
+	if err != nil {
+		return err
+	}
+
+	// select the first dataShards intact shards and the corresponding rows
+	// of the encoding matrix
+	var rows [][]byte
+	var input [][]byte
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+
+		rows = append(rows, e.matrix[i])
+		input = append(input, shard)
+
+		if len(rows) == e.dataShards {
+			break
+		}
+	}
+
+	if len(rows) < e.dataShards {
+		return ErrTooFewShards
+	}
+
+	decode, err := invertMatrix(rows)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < e.dataShards; i++ {
+		if shards[i] != nil {
+			continue
+		}
+
+		shards[i] = make([]byte, size)
+		e.computeShard(decode[i], input, shards[i])
+	}
+
+	for i := e.dataShards; i < len(shards); i++ {
+		if shards[i] != nil {
+			continue
+		}
+
+		shards[i] = make([]byte, size)
+		e.computeShard(e.matrix[i], shards[:e.dataShards], shards[i])
+	}
+
+	return nil
+}
+
+// invertMatrix returns the inverse of the square matrix m using Gauss-Jordan
+// elimination. m is not modified.
+func invertMatrix(m [][]byte) ([][]byte, error) {
+	n := len(m)
+
+	// work on the augmented matrix [m | I]
+	work := make([][]byte, n)
+	for i := range work {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		// find a row with a non-zero element in this column
+		pivot := -1
+		for row := col; row < n; row++ {
+			if work[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+
+		if pivot == -1 {
+			return nil, errors.New("matrix is singular")
+		}
+
+		work[col], work[pivot] = work[pivot], work[col]
+
+		// scale the pivot row so that the pivot element is one
+		if c := work[col][col]; c != 1 {
+			inv := galInv(c)
+			for j := range work[col] {
+				work[col][j] = galMul(work[col][j], inv)
+			}
+		}
+
+		// eliminate the column from all other rows
+		for row := 0; row < n; row++ {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+			galMulSliceXor(work[row][col], work[col], work[row])
+		}
+	}
+
+	inv := make([][]byte, n)
+	for i := range inv {
+		inv[i] = work[i][n:]
+	}
+
+	return inv, nil
+}
@@ -0,0 +1,87 @@
+package parity
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestGaloisInverse(t *testing.T) {
+	for a := 1; a < fieldSize; a++ {
+		if galMul(byte(a), galInv(byte(a))) != 1 {
+			t.Fatalf("wrong inverse for %d", a)
+		}
+	}
+}
+
+func TestEncoderReconstruct(t *testing.T) {
+	var tests = []struct {
+		data, parity int
+		missing      []int
+	}{
+		{1, 1, []int{0}},
+		{4, 2, []int{1, 3}},
+		{4, 2, []int{4, 5}},
+		{10, 3, []int{0, 9, 11}},
+		{10, 3, []int{2}},
+		{200, 56, []int{0, 1, 2, 50, 100, 199, 201, 255}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d/%d", test.data, test.parity), func(t *testing.T) {
+			enc, err := NewEncoder(test.data, test.parity)
+			rtest.OK(t, err)
+
+			shards := make([][]byte, test.data+test.parity)
+			for i := range shards {
+				if i < test.data {
+					shards[i] = rtest.Random(i, 333)
+				} else {
+					shards[i] = make([]byte, 333)
+				}
+			}
+			rtest.OK(t, enc.Encode(shards))
+
+			damaged := make([][]byte, len(shards))
+			copy(damaged, shards)
+			for _, i := range test.missing {
+				damaged[i] = nil
+			}
+
+			rtest.OK(t, enc.Reconstruct(damaged))
+			for i := range shards {
+				if !bytes.Equal(shards[i], damaged[i]) {
+					t.Errorf("shard %d was not reconstructed correctly", i)
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderTooFewShards(t *testing.T) {
+	enc, err := NewEncoder(4, 2)
+	rtest.OK(t, err)
+
+	shards := make([][]byte, 6)
+	for i := range shards {
+		shards[i] = make([]byte, 10)
+	}
+	rtest.OK(t, enc.Encode(shards))
+
+	shards[0], shards[2], shards[5] = nil, nil, nil
+	err = enc.Reconstruct(shards)
+	if err != ErrTooFewShards {
+		t.Fatalf("expected ErrTooFewShards, got %v", err)
+	}
+}
+
+func TestNewEncoderInvalid(t *testing.T) {
+	for _, shards := range [][2]int{{0, 1}, {1, 0}, {200, 57}} {
+		_, err := NewEncoder(shards[0], shards[1])
+		if err == nil {
+			t.Errorf("expected error for %d/%d shards", shards[0], shards[1])
+		}
+	}
+}
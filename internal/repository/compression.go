@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// compressionLevel returns the flate compression level used for mode.
+func compressionLevel(mode restic.CompressionMode) int {
+	if mode == restic.CompressionMax {
+		return flate.BestCompression
+	}
+	return flate.BestSpeed
+}
+
+// flateWriters holds a pool of compressors for each compression level, since
+// allocating a new compressor for each blob is expensive.
+var flateWriters = struct {
+	sync.Mutex
+	pools map[int]*sync.Pool
+}{pools: make(map[int]*sync.Pool)}
+
+func getFlateWriter(level int) *flate.Writer {
+	flateWriters.Lock()
+	pool, ok := flateWriters.pools[level]
+	if !ok {
+		pool = &sync.Pool{
+			New: func() interface{} {
+				// NewWriter only returns an error for invalid levels
+				w, err := flate.NewWriter(nil, level)
+				if err != nil {
+					panic(err)
+				}
+				return w
+			},
+		}
+		flateWriters.pools[level] = pool
+	}
+	flateWriters.Unlock()
+
+	return pool.Get().(*flate.Writer)
+}
+
+func putFlateWriter(level int, w *flate.Writer) {
+	flateWriters.Lock()
+	pool := flateWriters.pools[level]
+	flateWriters.Unlock()
+
+	pool.Put(w)
+}
+
+// compressBlob compresses data according to mode. If compressing does not
+// make the data smaller, nil is returned and the blob should be stored
+// uncompressed.
+func compressBlob(mode restic.CompressionMode, data []byte) ([]byte, error) {
+	if !mode.Enabled() || len(data) == 0 {
+		return nil, nil
+	}
+
+	level := compressionLevel(mode)
+	w := getFlateWriter(level)
+	defer putFlateWriter(level, w)
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+	w.Reset(buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, errors.Wrap(err, "Write")
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "Close")
+	}
+
+	if buf.Len() >= len(data) {
+		return nil, nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecompressBlob decompresses the plaintext data of a compressed blob into
+// buf. If the capacity of buf is less than uncompressedLength bytes, a new
+// buffer is allocated. The decompressed data is returned. It is used by code
+// that reads blobs from pack files directly.
+func DecompressBlob(data []byte, uncompressedLength uint, buf []byte) ([]byte, error) {
+	// the length is taken from the index or the pack header, don't allocate
+	// arbitrarily large buffers for it
+	if uncompressedLength > restic.MaxPackSize {
+		return nil, errors.Errorf("uncompressed length %v is larger than the maximum pack size", uncompressedLength)
+	}
+
+	if uint(cap(buf)) < uncompressedLength {
+		buf = make([]byte, uncompressedLength)
+	}
+	buf = buf[:uncompressedLength]
+
+	rd := flate.NewReader(bytes.NewReader(data))
+
+	_, err := io.ReadFull(rd, buf)
+	if err != nil {
+		_ = rd.Close()
+		return nil, errors.Wrap(err, "decompress")
+	}
+
+	// make sure the compressed data does not contain more than announced
+	n, err := rd.Read(make([]byte, 1))
+	if n != 0 || (err != nil && err != io.EOF) {
+		_ = rd.Close()
+		return nil, errors.New("decompress: uncompressed length does not match")
+	}
+
+	return buf, errors.Wrap(rd.Close(), "Close")
+}
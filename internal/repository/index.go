@@ -26,9 +26,10 @@ type Index struct {
 }
 
 type indexEntry struct {
-	packID restic.ID
-	offset uint
-	length uint
+	packID             restic.ID
+	offset             uint
+	length             uint
+	uncompressedLength uint
 }
 
 // NewIndex returns a new index.
@@ -41,9 +42,10 @@ func NewIndex() *Index {
 
 func (idx *Index) store(blob restic.PackedBlob) {
 	newEntry := indexEntry{
-		packID: blob.PackID,
-		offset: blob.Offset,
-		length: blob.Length,
+		packID:             blob.PackID,
+		offset:             blob.Offset,
+		length:             blob.Length,
+		uncompressedLength: blob.UncompressedLength,
 	}
 	h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
 	idx.pack[h] = append(idx.pack[h], newEntry)
@@ -122,10 +124,11 @@ func (idx *Index) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic.Pack
 		for _, p := range packs {
 			blob := restic.PackedBlob{
 				Blob: restic.Blob{
-					Type:   tpe,
-					Length: p.length,
-					ID:     id,
-					Offset: p.offset,
+					Type:               tpe,
+					Length:             p.length,
+					ID:                 id,
+					Offset:             p.offset,
+					UncompressedLength: p.uncompressedLength,
 				},
 				PackID: p.packID,
 			}
@@ -149,10 +152,11 @@ func (idx *Index) ListPack(id restic.ID) (list []restic.PackedBlob) {
 			if entry.packID == id {
 				list = append(list, restic.PackedBlob{
 					Blob: restic.Blob{
-						ID:     h.ID,
-						Type:   h.Type,
-						Length: entry.length,
-						Offset: entry.offset,
+						ID:                 h.ID,
+						Type:               h.Type,
+						Length:             entry.length,
+						Offset:             entry.offset,
+						UncompressedLength: entry.uncompressedLength,
 					},
 					PackID: entry.packID,
 				})
@@ -175,14 +179,14 @@ func (idx *Index) Has(id restic.ID, tpe restic.BlobType) bool {
 }
 
 // LookupSize returns the length of the plaintext content of the blob with the
-// given id.
+// given id. For compressed blobs, this is the length after decompression.
 func (idx *Index) LookupSize(id restic.ID, tpe restic.BlobType) (plaintextLength uint, found bool) {
 	blobs, found := idx.Lookup(id, tpe)
 	if !found {
 		return 0, found
 	}
 
-	return uint(restic.PlaintextLength(int(blobs[0].Length))), true
+	return blobs[0].DataLength(), true
 }
 
 // Supersedes returns the list of indexes this index supersedes, if any.
@@ -225,10 +229,11 @@ func (idx *Index) Each(ctx context.Context) <-chan restic.PackedBlob {
 					return
 				case ch <- restic.PackedBlob{
 					Blob: restic.Blob{
-						ID:     h.ID,
-						Type:   h.Type,
-						Offset: blob.offset,
-						Length: blob.length,
+						ID:                 h.ID,
+						Type:               h.Type,
+						Offset:             blob.offset,
+						Length:             blob.length,
+						UncompressedLength: blob.uncompressedLength,
 					},
 					PackID: blob.packID,
 				}:
@@ -278,10 +283,11 @@ type packJSON struct {
 }
 
 type blobJSON struct {
-	ID     restic.ID       `json:"id"`
-	Type   restic.BlobType `json:"type"`
-	Offset uint            `json:"offset"`
-	Length uint            `json:"length"`
+	ID                 restic.ID       `json:"id"`
+	Type               restic.BlobType `json:"type"`
+	Offset             uint            `json:"offset"`
+	Length             uint            `json:"length"`
+	UncompressedLength uint            `json:"uncompressed_length,omitempty"`
 }
 
 // generatePackList returns a list of packs.
@@ -316,10 +322,11 @@ func (idx *Index) generatePackList() ([]*packJSON, error) {
 
 			// add blob
 			p.Blobs = append(p.Blobs, blobJSON{
-				ID:     h.ID,
-				Type:   h.Type,
-				Offset: blob.offset,
-				Length: blob.length,
+				ID:                 h.ID,
+				Type:               h.Type,
+				Offset:             blob.offset,
+				Length:             blob.length,
+				UncompressedLength: blob.uncompressedLength,
 			})
 		}
 	}
@@ -371,6 +378,27 @@ func (idx *Index) Finalize(w io.Writer) error {
 	return idx.encode(w)
 }
 
+// FinalizeBinary sets the index to final and writes the binary serialization
+// to w.
+func (idx *Index) FinalizeBinary(w io.Writer) error {
+	debug.Log("encoding index")
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	idx.final = true
+
+	list, err := idx.generatePackList()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(encodeBinaryIndex(&jsonIndex{
+		Supersedes: idx.supersedes,
+		Packs:      list,
+	}))
+	return err
+}
+
 // ID returns the ID of the index, if available. If the index is not yet
 // finalized, an error is returned.
 func (idx *Index) ID() (restic.ID, error) {
@@ -453,9 +481,21 @@ func isErrOldIndex(err error) bool {
 // ErrOldIndexFormat means an index with the old format was detected.
 var ErrOldIndexFormat = errors.New("index has old format")
 
-// DecodeIndex loads and unserializes an index from rd.
+// DecodeIndex loads and unserializes an index from rd. Both the JSON and the
+// binary format are supported.
 func DecodeIndex(buf []byte) (idx *Index, err error) {
 	debug.Log("Start decoding index")
+
+	if isBinaryIndex(buf) {
+		idxJSON, err := decodeBinaryIndex(buf)
+		if err != nil {
+			debug.Log("Error %v", err)
+			return nil, errors.Wrap(err, "DecodeBinary")
+		}
+
+		return indexFromJSON(idxJSON), nil
+	}
+
 	idxJSON := &jsonIndex{}
 
 	err = json.Unmarshal(buf, idxJSON)
@@ -470,17 +510,23 @@ func DecodeIndex(buf []byte) (idx *Index, err error) {
 		return nil, errors.Wrap(err, "Decode")
 	}
 
-	idx = NewIndex()
+	return indexFromJSON(idxJSON), nil
+}
+
+// indexFromJSON returns a finalized index containing the packs in idxJSON.
+func indexFromJSON(idxJSON *jsonIndex) *Index {
+	idx := NewIndex()
 	for _, pack := range idxJSON.Packs {
 		var data, tree bool
 
 		for _, blob := range pack.Blobs {
 			idx.store(restic.PackedBlob{
 				Blob: restic.Blob{
-					Type:   blob.Type,
-					ID:     blob.ID,
-					Offset: blob.Offset,
-					Length: blob.Length,
+					Type:               blob.Type,
+					ID:                 blob.ID,
+					Offset:             blob.Offset,
+					Length:             blob.Length,
+					UncompressedLength: blob.UncompressedLength,
 				},
 				PackID: pack.ID,
 			})
@@ -501,7 +547,7 @@ func DecodeIndex(buf []byte) (idx *Index, err error) {
 	idx.final = true
 
 	debug.Log("done")
-	return idx, nil
+	return idx
 }
 
 // DecodeOldIndex loads and unserializes an index in the old format from rd.
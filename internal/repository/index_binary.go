@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Index files in the binary format start with binaryIndexMagic followed by
+// the format version. Afterwards, the list of superseded indexes and the
+// packs are stored:
+//
+//	Magic (4 bytes) || Version (1 byte) ||
+//	Count(Supersedes) || ID_1 || ... || ID_n ||
+//	Count(Packs) || Pack_1 || ... || Pack_n
+//
+//	Pack = PackID || Count(Blobs) || Blob_1 || ... || Blob_n
+//	Blob = Type (1 byte) || ID || Offset || Length || UncompressedLength
+//
+// IDs are stored as 32 raw bytes, all counts, offsets and lengths are encoded
+// as unsigned varints.
+var binaryIndexMagic = []byte("RIDX")
+
+const binaryIndexVersion = 1
+
+// useBinaryIndex returns true if new index files are written in the binary
+// format, which is supported since repository version 3.
+func useBinaryIndex(cfg restic.Config) bool {
+	return cfg.Version >= 3
+}
+
+// isBinaryIndex returns true if buf contains an index in the binary format.
+// JSON index files always start with '{' or '['.
+func isBinaryIndex(buf []byte) bool {
+	return bytes.HasPrefix(buf, binaryIndexMagic)
+}
+
+// encodeBinaryIndex returns the binary serialization of idx.
+func encodeBinaryIndex(idx *jsonIndex) []byte {
+	blobs := 0
+	for _, p := range idx.Packs {
+		blobs += len(p.Blobs)
+	}
+
+	buf := make([]byte, 0, len(binaryIndexMagic)+1+(len(idx.Supersedes)+len(idx.Packs))*(len(restic.ID{})+binary.MaxVarintLen64)+blobs*(1+len(restic.ID{})+3*binary.MaxVarintLen32))
+	buf = append(buf, binaryIndexMagic...)
+	buf = append(buf, binaryIndexVersion)
+
+	var tmp [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(tmp[:], v)
+		buf = append(buf, tmp[:n]...)
+	}
+
+	putUvarint(uint64(len(idx.Supersedes)))
+	for _, id := range idx.Supersedes {
+		buf = append(buf, id[:]...)
+	}
+
+	putUvarint(uint64(len(idx.Packs)))
+	for _, p := range idx.Packs {
+		buf = append(buf, p.ID[:]...)
+		putUvarint(uint64(len(p.Blobs)))
+		for _, blob := range p.Blobs {
+			buf = append(buf, byte(blob.Type))
+			buf = append(buf, blob.ID[:]...)
+			putUvarint(uint64(blob.Offset))
+			putUvarint(uint64(blob.Length))
+			putUvarint(uint64(blob.UncompressedLength))
+		}
+	}
+
+	return buf
+}
+
+// binaryIndexDecoder reads the fields of a binary index from buf.
+type binaryIndexDecoder struct {
+	buf []byte
+	err error
+}
+
+var errBinaryIndexTruncated = errors.New("binary index is truncated")
+
+func (d *binaryIndexDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errBinaryIndexTruncated
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryIndexDecoder) id() (id restic.ID) {
+	if d.err != nil {
+		return id
+	}
+
+	if len(d.buf) < len(id) {
+		d.err = errBinaryIndexTruncated
+		return id
+	}
+
+	copy(id[:], d.buf)
+	d.buf = d.buf[len(id):]
+	return id
+}
+
+func (d *binaryIndexDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	if len(d.buf) < 1 {
+		d.err = errBinaryIndexTruncated
+		return 0
+	}
+
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+// count reads a number of entries which need at least minSize bytes each,
+// so that corrupt data does not cause huge allocations.
+func (d *binaryIndexDecoder) count(minSize int) int {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(d.buf)/minSize) {
+		d.err = errBinaryIndexTruncated
+		return 0
+	}
+
+	return int(n)
+}
+
+// decodeBinaryIndex parses an index in the binary format.
+func decodeBinaryIndex(buf []byte) (*jsonIndex, error) {
+	if !isBinaryIndex(buf) {
+		return nil, errors.New("binary index has invalid header")
+	}
+
+	d := &binaryIndexDecoder{buf: buf[len(binaryIndexMagic):]}
+	if v := d.byte(); d.err == nil && v != binaryIndexVersion {
+		return nil, errors.Errorf("unsupported binary index version %d", v)
+	}
+
+	idSize := len(restic.ID{})
+	idx := &jsonIndex{}
+
+	n := d.count(idSize)
+	for i := 0; i < n && d.err == nil; i++ {
+		idx.Supersedes = append(idx.Supersedes, d.id())
+	}
+
+	n = d.count(idSize + 1)
+	idx.Packs = make([]*packJSON, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		p := &packJSON{ID: d.id()}
+
+		blobs := d.count(1 + idSize + 3)
+		p.Blobs = make([]blobJSON, 0, blobs)
+		for j := 0; j < blobs && d.err == nil; j++ {
+			tpe := restic.BlobType(d.byte())
+			if d.err == nil && tpe != restic.DataBlob && tpe != restic.TreeBlob {
+				return nil, errors.Errorf("invalid blob type %d in binary index", tpe)
+			}
+
+			p.Blobs = append(p.Blobs, blobJSON{
+				Type:               tpe,
+				ID:                 d.id(),
+				Offset:             uint(d.uvarint()),
+				Length:             uint(d.uvarint()),
+				UncompressedLength: uint(d.uvarint()),
+			})
+		}
+
+		idx.Packs = append(idx.Packs, p)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if len(d.buf) != 0 {
+		return nil, errors.Errorf("binary index has %d bytes of trailing data", len(d.buf))
+	}
+
+	return idx, nil
+}
+
+// ConvertIndex rewrites the index file with the given ID in the binary format
+// and removes the old file. Index files which already use the binary format
+// are left untouched. The ID of the index file is returned.
+func ConvertIndex(ctx context.Context, repo restic.Repository, id restic.ID) (restic.ID, error) {
+	buf, err := repo.LoadAndDecrypt(ctx, restic.IndexFile, id)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	if isBinaryIndex(buf) {
+		debug.Log("index %v already uses the binary format", id)
+		return id, nil
+	}
+
+	idx, err := DecodeIndex(buf)
+	if errors.Cause(err) == ErrOldIndexFormat {
+		idx, err = DecodeOldIndex(buf)
+	}
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	wr := bytes.NewBuffer(nil)
+	if err = idx.FinalizeBinary(wr); err != nil {
+		return restic.ID{}, err
+	}
+
+	newID, err := repo.SaveUnpacked(ctx, restic.IndexFile, wr.Bytes())
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	err = repo.Backend().Remove(ctx, restic.Handle{Type: restic.IndexFile, Name: id.String()})
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	debug.Log("converted index %v to %v", id, newID)
+	return newID, nil
+}
@@ -490,3 +490,98 @@ func TestIndexHas(t *testing.T) {
 	rtest.Assert(t, !idx.Has(restic.NewRandomID(), restic.DataBlob), "Index reports having a data blob not added to it")
 	rtest.Assert(t, !idx.Has(tests[0].id, restic.TreeBlob), "Index reports having a tree blob added to it with the same id as a data blob")
 }
+
+func TestIndexSerializeBinary(t *testing.T) {
+	idx := repository.NewIndex()
+	supersedes := restic.IDs{restic.NewRandomID(), restic.NewRandomID()}
+	rtest.OK(t, idx.AddToSupersedes(supersedes...))
+
+	var blobs []restic.PackedBlob
+	treePack := restic.NewRandomID()
+	for i := 0; i < 20; i++ {
+		packID := restic.NewRandomID()
+		tpe := restic.DataBlob
+		if i == 0 {
+			packID = treePack
+			tpe = restic.TreeBlob
+		}
+
+		pos := uint(0)
+		for j := 0; j < 30; j++ {
+			pb := restic.PackedBlob{
+				Blob: restic.Blob{
+					Type:   tpe,
+					ID:     restic.NewRandomID(),
+					Offset: pos,
+					Length: uint(i*1000 + j),
+				},
+				PackID: packID,
+			}
+			if j%2 == 0 {
+				pb.UncompressedLength = uint(i*5000 + j)
+			}
+
+			idx.Store(pb)
+			blobs = append(blobs, pb)
+			pos += pb.Length
+		}
+	}
+
+	wr := bytes.NewBuffer(nil)
+	rtest.OK(t, idx.FinalizeBinary(wr))
+	rtest.Assert(t, idx.Final(), "index not final after encoding")
+
+	jsonWr := bytes.NewBuffer(nil)
+	rtest.OK(t, idx.Encode(jsonWr))
+	rtest.Assert(t, wr.Len() < jsonWr.Len()/2,
+		"binary index is not smaller than the JSON index: %d >= %d/2", wr.Len(), jsonWr.Len())
+
+	idx2, err := repository.DecodeIndex(wr.Bytes())
+	rtest.OK(t, err)
+	rtest.Assert(t, idx2.Final(), "decoded index is not final")
+	rtest.Equals(t, supersedes, idx2.Supersedes())
+	rtest.Equals(t, restic.IDs{treePack}, idx2.TreePacks())
+
+	for _, pb := range blobs {
+		list, found := idx2.Lookup(pb.ID, pb.Type)
+		rtest.Assert(t, found, "blob %v not found in decoded index", pb.ID.Str())
+		rtest.Equals(t, []restic.PackedBlob{pb}, list)
+	}
+
+	rtest.Equals(t, uint(len(blobs)-30), idx2.Count(restic.DataBlob))
+	rtest.Equals(t, uint(30), idx2.Count(restic.TreeBlob))
+}
+
+func TestIndexDecodeBinaryInvalid(t *testing.T) {
+	idx := repository.NewIndex()
+	for i := 0; i < 5; i++ {
+		idx.Store(restic.PackedBlob{
+			Blob: restic.Blob{
+				Type:   restic.DataBlob,
+				ID:     restic.NewRandomID(),
+				Offset: uint(i * 100),
+				Length: 100,
+			},
+			PackID: restic.NewRandomID(),
+		})
+	}
+
+	wr := bytes.NewBuffer(nil)
+	rtest.OK(t, idx.FinalizeBinary(wr))
+	buf := wr.Bytes()
+
+	// truncated data must be detected
+	for i := 5; i < len(buf); i++ {
+		_, err := repository.DecodeIndex(buf[:i])
+		rtest.Assert(t, err != nil, "no error for index truncated to %d of %d bytes", i, len(buf))
+	}
+
+	_, err := repository.DecodeIndex(append(buf, 0))
+	rtest.Assert(t, err != nil, "no error for trailing data")
+
+	// unsupported format version
+	invalid := append([]byte(nil), buf...)
+	invalid[4] = 23
+	_, err = repository.DecodeIndex(invalid)
+	rtest.Assert(t, err != nil, "no error for invalid version")
+}
@@ -22,6 +22,9 @@ var (
 
 	// ErrMaxKeysReached is returned when the maximum number of keys was checked and no key could be found.
 	ErrMaxKeysReached = errors.Fatal("maximum number of keys reached")
+
+	// ErrKeyExpired is returned when the password only matches keys which have expired.
+	ErrKeyExpired = errors.Fatal("the key for this password has expired")
 )
 
 // Key represents an encrypted master key for a repository.
@@ -29,20 +32,73 @@ type Key struct {
 	Created  time.Time `json:"created"`
 	Username string    `json:"username"`
 	Hostname string    `json:"hostname"`
+	Comment  string    `json:"comment,omitempty"`
+
+	// Expires is the time after which the key is not accepted any more, nil
+	// means that the key does not expire.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// WriteOnly is set for keys which can only be used to add new data to
+	// the repository. Data contains a writeOnlyKey instead of the master key.
+	WriteOnly bool `json:"write_only,omitempty"`
 
+	// KDF is the name of the key derivation function, the parameters N and R
+	// are used by scrypt, T and M by Argon2id.
 	KDF  string `json:"kdf"`
-	N    int    `json:"N"`
-	R    int    `json:"r"`
+	N    int    `json:"N,omitempty"`
+	R    int    `json:"r,omitempty"`
+	T    int    `json:"t,omitempty"`
+	M    int    `json:"m,omitempty"`
 	P    int    `json:"p"`
 	Salt []byte `json:"salt"`
 	Data []byte `json:"data"`
 
-	user   *crypto.Key
-	master *crypto.Key
+	user      *crypto.Key
+	master    *crypto.Key
+	writeOnly *writeOnlyKey
 
 	name string
 }
 
+// writeOnlyKey is stored in write-only keys instead of the master key. It
+// allows saving new data, but not decrypting the data in the repository.
+type writeOnlyKey struct {
+	// Public is the public key of the repository, clients seal the key for
+	// the data they save with it.
+	Public *crypto.PublicKey `json:"public"`
+
+	// Index decrypts the index files and the config, so that new data can be
+	// deduplicated against the data in the repository.
+	Index *crypto.Key `json:"index"`
+}
+
+// newWriteOnlyKey returns the write-only key for the given master key.
+func newWriteOnlyKey(master *crypto.Key) *writeOnlyKey {
+	return &writeOnlyKey{
+		Public: master.PrivateKey().Public(),
+		Index:  deriveIndexKey(master),
+	}
+}
+
+// KeyOptions contains the metadata stored for a new key. When Username or
+// Hostname are empty, the values for the current user and host are used.
+type KeyOptions struct {
+	Username string
+	Hostname string
+	Comment  string
+
+	// Expires is the time after which the key is not accepted any more, the
+	// zero value means that the key does not expire.
+	Expires time.Time
+
+	// WriteOnly creates a key which can only be used to add new data.
+	WriteOnly bool
+
+	// KDF contains the parameters for the key derivation function, if nil
+	// the package-level Params are used.
+	KDF *crypto.Params
+}
+
 // Params tracks the parameters used for the KDF. If not set, it will be
 // calibrated on the first run of AddKey().
 var Params *crypto.Params
@@ -57,8 +113,8 @@ var (
 
 // createMasterKey creates a new master key in the given backend and encrypts
 // it with the password.
-func createMasterKey(s *Repository, password string) (*Key, error) {
-	return AddKey(context.TODO(), s, password, nil)
+func createMasterKey(s *Repository, password string, opts KeyOptions) (*Key, error) {
+	return AddKey(context.TODO(), s, password, opts, nil)
 }
 
 // OpenKey tries do decrypt the key specified by name with the given password.
@@ -70,17 +126,12 @@ func OpenKey(ctx context.Context, s *Repository, name string, password string) (
 	}
 
 	// check KDF
-	if k.KDF != "scrypt" {
-		return nil, errors.New("only supported KDF is scrypt()")
+	if k.KDF != crypto.KDFScrypt && k.KDF != crypto.KDFArgon2id {
+		return nil, errors.Errorf("unsupported KDF %q", k.KDF)
 	}
 
 	// derive user key
-	params := crypto.Params{
-		N: k.N,
-		R: k.R,
-		P: k.P,
-	}
-	k.user, err = crypto.KDF(params, k.Salt, password)
+	k.user, err = crypto.KDF(k.Params(), k.Salt, password)
 	if err != nil {
 		return nil, errors.Wrap(err, "crypto.KDF")
 	}
@@ -93,8 +144,13 @@ func OpenKey(ctx context.Context, s *Repository, name string, password string) (
 	}
 
 	// restore json
-	k.master = &crypto.Key{}
-	err = json.Unmarshal(buf, k.master)
+	if k.WriteOnly {
+		k.writeOnly = &writeOnlyKey{}
+		err = json.Unmarshal(buf, k.writeOnly)
+	} else {
+		k.master = &crypto.Key{}
+		err = json.Unmarshal(buf, k.master)
+	}
 	if err != nil {
 		debug.Log("Unmarshal() returned error %v", err)
 		return nil, errors.Wrap(err, "Unmarshal")
@@ -112,8 +168,13 @@ func OpenKey(ctx context.Context, s *Repository, name string, password string) (
 // given password. If none could be found, ErrNoKeyFound is returned. When
 // maxKeys is reached, ErrMaxKeysReached is returned. When setting maxKeys to
 // zero, all keys in the repo are checked.
+//
+// Keys which have expired are not accepted. If the password only matches
+// expired keys, ErrKeyExpired is returned.
 func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int) (k *Key, err error) {
 	checked := 0
+	expired := false
+	now := time.Now()
 
 	listCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -143,6 +204,12 @@ func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int)
 			return err
 		}
 
+		if key.Expired(now) {
+			debug.Log("key %v has expired on %v", fi.Name, key.Expires)
+			expired = true
+			return nil
+		}
+
 		debug.Log("successfully opened key %v", fi.Name)
 		k = key
 		cancel()
@@ -157,6 +224,10 @@ func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int)
 		return nil, err
 	}
 
+	if k == nil && expired {
+		return nil, ErrKeyExpired
+	}
+
 	if k == nil {
 		return nil, ErrNoKeyFound
 	}
@@ -181,8 +252,9 @@ func LoadKey(ctx context.Context, s *Repository, name string) (k *Key, err error
 	return k, nil
 }
 
-// AddKey adds a new key to an already existing repository.
-func AddKey(ctx context.Context, s *Repository, password string, template *crypto.Key) (*Key, error) {
+// AddKey adds a new key to an already existing repository. The metadata for
+// the key is taken from opts.
+func AddKey(ctx context.Context, s *Repository, password string, opts KeyOptions, template *crypto.Key) (*Key, error) {
 	// make sure we have valid KDF parameters
 	if Params == nil {
 		p, err := crypto.Calibrate(KDFTimeout, KDFMemory)
@@ -194,23 +266,47 @@ func AddKey(ctx context.Context, s *Repository, password string, template *crypt
 		debug.Log("calibrated KDF parameters are %v", p)
 	}
 
+	params := *Params
+	if opts.KDF != nil {
+		params = *opts.KDF
+	}
+
 	// fill meta data about key
 	newkey := &Key{
-		Created: time.Now(),
-		KDF:     "scrypt",
-		N:       Params.N,
-		R:       Params.R,
-		P:       Params.P,
+		Created:   time.Now(),
+		Username:  opts.Username,
+		Hostname:  opts.Hostname,
+		Comment:   opts.Comment,
+		WriteOnly: opts.WriteOnly,
+		KDF:       params.Name(),
+		P:         params.P,
 	}
 
-	hn, err := os.Hostname()
-	if err == nil {
-		newkey.Hostname = hn
+	switch newkey.KDF {
+	case crypto.KDFScrypt:
+		newkey.N, newkey.R = params.N, params.R
+	case crypto.KDFArgon2id:
+		newkey.T, newkey.M = params.T, params.M
 	}
 
-	usr, err := user.Current()
-	if err == nil {
-		newkey.Username = usr.Username
+	if !opts.Expires.IsZero() {
+		expires := opts.Expires
+		newkey.Expires = &expires
+	}
+
+	var err error
+	if newkey.Hostname == "" {
+		hn, err := os.Hostname()
+		if err == nil {
+			newkey.Hostname = hn
+		}
+	}
+
+	if newkey.Username == "" {
+		usr, err := user.Current()
+		if err == nil {
+			newkey.Username = usr.Username
+		}
 	}
 
 	// generate random salt
@@ -220,7 +316,7 @@ func AddKey(ctx context.Context, s *Repository, password string, template *crypt
 	}
 
 	// call KDF to derive user key
-	newkey.user, err = crypto.KDF(*Params, newkey.Salt, password)
+	newkey.user, err = crypto.KDF(params, newkey.Salt, password)
 	if err != nil {
 		return nil, err
 	}
@@ -233,8 +329,16 @@ func AddKey(ctx context.Context, s *Repository, password string, template *crypt
 		newkey.master = template
 	}
 
-	// encrypt master keys (as json) with user key
-	buf, err := json.Marshal(newkey.master)
+	// encrypt master keys (as json) with user key, write-only keys only
+	// contain the keys derived from the master key
+	var buf []byte
+	if opts.WriteOnly {
+		newkey.writeOnly = newWriteOnlyKey(newkey.master)
+		newkey.master = nil
+		buf, err = json.Marshal(newkey.writeOnly)
+	} else {
+		buf, err = json.Marshal(newkey.master)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "Marshal")
 	}
@@ -279,7 +383,28 @@ func (k Key) Name() string {
 	return k.name
 }
 
+// Expired returns true if the key has an expiry date which is before now.
+func (k *Key) Expired(now time.Time) bool {
+	return k.Expires != nil && now.After(*k.Expires)
+}
+
+// Params returns the parameters of the key derivation function for k.
+func (k *Key) Params() crypto.Params {
+	return crypto.Params{
+		KDF: k.KDF,
+		N:   k.N,
+		R:   k.R,
+		T:   k.T,
+		M:   k.M,
+		P:   k.P,
+	}
+}
+
 // Valid tests whether the mac and encryption keys are valid (i.e. not zero)
 func (k *Key) Valid() bool {
+	if k.writeOnly != nil {
+		return k.user.Valid() && k.writeOnly.Public != nil &&
+			k.writeOnly.Index != nil && k.writeOnly.Index.Valid()
+	}
 	return k.user.Valid() && k.master.Valid()
 }
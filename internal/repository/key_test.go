@@ -0,0 +1,83 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestKeyMetadata(t *testing.T) {
+	r, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	repo := r.(*repository.Repository)
+
+	opts := repository.KeyOptions{
+		Username: "user",
+		Hostname: "host",
+		Comment:  "backup server",
+	}
+	k, err := repository.AddKey(context.TODO(), repo, "secret", opts, repo.Key())
+	rtest.OK(t, err)
+
+	k, err = repository.LoadKey(context.TODO(), repo, k.Name())
+	rtest.OK(t, err)
+	rtest.Equals(t, "user", k.Username)
+	rtest.Equals(t, "host", k.Hostname)
+	rtest.Equals(t, "backup server", k.Comment)
+	rtest.Assert(t, k.Expires == nil, "key without expiry date has expiry date %v", k.Expires)
+}
+
+func TestKeyExpires(t *testing.T) {
+	r, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	repo := r.(*repository.Repository)
+
+	expired, err := repository.AddKey(context.TODO(), repo, "expired",
+		repository.KeyOptions{Expires: time.Now().Add(-time.Hour)}, repo.Key())
+	rtest.OK(t, err)
+	rtest.Assert(t, expired.Expired(time.Now()), "key is not expired")
+
+	valid, err := repository.AddKey(context.TODO(), repo, "valid",
+		repository.KeyOptions{Expires: time.Now().Add(time.Hour)}, repo.Key())
+	rtest.OK(t, err)
+	rtest.Assert(t, !valid.Expired(time.Now()), "key is expired")
+
+	_, err = repository.SearchKey(context.TODO(), repo, "expired", 0)
+	rtest.Equals(t, repository.ErrKeyExpired, err)
+
+	k, err := repository.SearchKey(context.TODO(), repo, "valid", 0)
+	rtest.OK(t, err)
+	rtest.Equals(t, valid.Name(), k.Name())
+
+	_, err = repository.SearchKey(context.TODO(), repo, "wrong", 0)
+	rtest.Equals(t, repository.ErrNoKeyFound, err)
+}
+
+func TestKeyArgon2id(t *testing.T) {
+	r, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	repo := r.(*repository.Repository)
+
+	params := crypto.Params{KDF: crypto.KDFArgon2id, T: 1, M: 64, P: 1}
+	added, err := repository.AddKey(context.TODO(), repo, "argon2",
+		repository.KeyOptions{KDF: &params}, repo.Key())
+	rtest.OK(t, err)
+
+	k, err := repository.LoadKey(context.TODO(), repo, added.Name())
+	rtest.OK(t, err)
+	rtest.Equals(t, params, k.Params())
+
+	found, err := repository.SearchKey(context.TODO(), repo, "argon2", 0)
+	rtest.OK(t, err)
+	rtest.Equals(t, added.Name(), found.Name())
+
+	// invalid parameters are rejected
+	params.M = 1
+	_, err = repository.AddKey(context.TODO(), repo, "argon2",
+		repository.KeyOptions{KDF: &params}, repo.Key())
+	rtest.Assert(t, err != nil, "key with invalid KDF parameters was added")
+}
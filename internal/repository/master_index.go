@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"bytes"
 	"context"
+	"sort"
 	"sync"
 
 	"github.com/restic/restic/internal/restic"
@@ -10,21 +12,158 @@ import (
 )
 
 // MasterIndex is a collection of indexes and IDs of chunks that are in the process of being saved.
+//
+// The blobs of finalized indexes are merged into a single table sorted by blob
+// type and ID, which needs much less memory than a map per index. Only
+// indexes which have not been saved yet are kept as Index.
 type MasterIndex struct {
+	// entries of all finalized indexes, sorted when sorted is true
+	blobs  []masterIndexEntry
+	sorted bool
+
+	// packs contains the IDs of all packs referenced by blobs, packIdx maps a
+	// pack ID to its position in packs
+	packs   restic.IDs
+	packIdx map[restic.ID]uint32
+
+	treePacks restic.IDSet
+	indexIDs  restic.IDSet
+
+	// idx contains the indexes which have not been finalized yet
 	idx      []*Index
 	idxMutex sync.RWMutex
 }
 
+// masterIndexEntry describes the location of a blob. Offsets and lengths are
+// stored as uint32, which is sufficient for pack files smaller than 4 GiB.
+type masterIndexEntry struct {
+	id                 restic.ID
+	pack               uint32
+	offset             uint32
+	length             uint32
+	uncompressedLength uint32
+	tpe                restic.BlobType
+}
+
+// less orders entries by type and ID, then by location.
+func (e *masterIndexEntry) less(other *masterIndexEntry) bool {
+	if e.tpe != other.tpe {
+		return e.tpe < other.tpe
+	}
+
+	if c := bytes.Compare(e.id[:], other.id[:]); c != 0 {
+		return c < 0
+	}
+
+	if e.pack != other.pack {
+		return e.pack < other.pack
+	}
+
+	return e.offset < other.offset
+}
+
 // NewMasterIndex creates a new master index.
 func NewMasterIndex() *MasterIndex {
-	return &MasterIndex{}
+	return &MasterIndex{
+		sorted:    true,
+		packIdx:   make(map[restic.ID]uint32),
+		treePacks: restic.NewIDSet(),
+		indexIDs:  restic.NewIDSet(),
+	}
+}
+
+// rlock acquires the read lock. If new entries have been added since the
+// table has last been sorted, it is sorted first.
+func (mi *MasterIndex) rlock() {
+	for {
+		mi.idxMutex.RLock()
+		if mi.sorted {
+			return
+		}
+		mi.idxMutex.RUnlock()
+
+		mi.idxMutex.Lock()
+		mi.sort()
+		mi.idxMutex.Unlock()
+	}
+}
+
+// sort sorts the table and removes duplicate entries, which occur when a pack
+// is contained in more than one index file. The caller must hold the lock.
+func (mi *MasterIndex) sort() {
+	if mi.sorted {
+		return
+	}
+
+	debug.Log("sorting %d entries", len(mi.blobs))
+	sort.Slice(mi.blobs, func(i, j int) bool {
+		return mi.blobs[i].less(&mi.blobs[j])
+	})
+
+	unique := mi.blobs[:0]
+	for _, e := range mi.blobs {
+		if len(unique) > 0 {
+			last := unique[len(unique)-1]
+			if last.tpe == e.tpe && last.id == e.id && last.pack == e.pack && last.offset == e.offset {
+				continue
+			}
+		}
+		unique = append(unique, e)
+	}
+
+	// release the memory used by the duplicates
+	if cap(unique)-len(unique) > len(unique)/4 {
+		unique = append([]masterIndexEntry(nil), unique...)
+	}
+
+	mi.blobs = unique
+	mi.sorted = true
+}
+
+// search returns the range of entries for the blob. The caller must hold the
+// read lock.
+func (mi *MasterIndex) search(id restic.ID, tpe restic.BlobType) (start, end int) {
+	key := masterIndexEntry{id: id, tpe: tpe}
+	start = sort.Search(len(mi.blobs), func(i int) bool {
+		return !mi.blobs[i].less(&key)
+	})
+
+	end = start
+	for end < len(mi.blobs) && mi.blobs[end].tpe == tpe && mi.blobs[end].id == id {
+		end++
+	}
+
+	return start, end
+}
+
+// packedBlob returns the PackedBlob for the entry e.
+func (mi *MasterIndex) packedBlob(e *masterIndexEntry) restic.PackedBlob {
+	return restic.PackedBlob{
+		Blob: restic.Blob{
+			Type:               e.tpe,
+			ID:                 e.id,
+			Offset:             uint(e.offset),
+			Length:             uint(e.length),
+			UncompressedLength: uint(e.uncompressedLength),
+		},
+		PackID: mi.packs[e.pack],
+	}
 }
 
 // Lookup queries all known Indexes for the ID and returns the first match.
 func (mi *MasterIndex) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic.PackedBlob, found bool) {
-	mi.idxMutex.RLock()
+	mi.rlock()
 	defer mi.idxMutex.RUnlock()
 
+	start, end := mi.search(id, tpe)
+	if start < end {
+		blobs = make([]restic.PackedBlob, 0, end-start)
+		for i := start; i < end; i++ {
+			blobs = append(blobs, mi.packedBlob(&mi.blobs[i]))
+		}
+		return blobs, true
+	}
+
 	for _, idx := range mi.idx {
 		blobs, found = idx.Lookup(id, tpe)
 		if found {
@@ -37,24 +176,32 @@ func (mi *MasterIndex) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic
 
 // LookupSize queries all known Indexes for the ID and returns the first match.
 func (mi *MasterIndex) LookupSize(id restic.ID, tpe restic.BlobType) (uint, bool) {
-	mi.idxMutex.RLock()
-	defer mi.idxMutex.RUnlock()
-
-	for _, idx := range mi.idx {
-		if size, found := idx.LookupSize(id, tpe); found {
-			return size, found
-		}
+	blobs, found := mi.Lookup(id, tpe)
+	if !found {
+		return 0, false
 	}
 
-	return 0, false
+	return blobs[0].DataLength(), true
 }
 
 // ListPack returns the list of blobs in a pack. The first matching index is
 // returned, or nil if no index contains information about the pack id.
 func (mi *MasterIndex) ListPack(id restic.ID) (list []restic.PackedBlob) {
-	mi.idxMutex.RLock()
+	mi.rlock()
 	defer mi.idxMutex.RUnlock()
 
+	if pack, ok := mi.packIdx[id]; ok {
+		for i := range mi.blobs {
+			if mi.blobs[i].pack == pack {
+				list = append(list, mi.packedBlob(&mi.blobs[i]))
+			}
+		}
+
+		if len(list) > 0 {
+			return list
+		}
+	}
+
 	for _, idx := range mi.idx {
 		list := idx.ListPack(id)
 		if len(list) > 0 {
@@ -67,9 +214,13 @@ func (mi *MasterIndex) ListPack(id restic.ID) (list []restic.PackedBlob) {
 
 // Has queries all known Indexes for the ID and returns the first match.
 func (mi *MasterIndex) Has(id restic.ID, tpe restic.BlobType) bool {
-	mi.idxMutex.RLock()
+	mi.rlock()
 	defer mi.idxMutex.RUnlock()
 
+	if start, end := mi.search(id, tpe); start < end {
+		return true
+	}
+
 	for _, idx := range mi.idx {
 		if idx.Has(id, tpe) {
 			return true
@@ -81,10 +232,18 @@ func (mi *MasterIndex) Has(id restic.ID, tpe restic.BlobType) bool {
 
 // Count returns the number of blobs of type t in the index.
 func (mi *MasterIndex) Count(t restic.BlobType) (n uint) {
-	mi.idxMutex.RLock()
+	mi.rlock()
 	defer mi.idxMutex.RUnlock()
 
-	var sum uint
+	// the table is sorted by type first
+	start := sort.Search(len(mi.blobs), func(i int) bool {
+		return mi.blobs[i].tpe >= t
+	})
+	end := sort.Search(len(mi.blobs), func(i int) bool {
+		return mi.blobs[i].tpe > t
+	})
+
+	sum := uint(end - start)
 	for _, idx := range mi.idx {
 		sum += idx.Count(t)
 	}
@@ -92,15 +251,82 @@ func (mi *MasterIndex) Count(t restic.BlobType) (n uint) {
 	return sum
 }
 
-// Insert adds a new index to the MasterIndex.
+// Insert adds a new index to the MasterIndex. The blobs of finalized indexes
+// are merged into the table, afterwards idx is not referenced any more.
 func (mi *MasterIndex) Insert(idx *Index) {
 	mi.idxMutex.Lock()
 	defer mi.idxMutex.Unlock()
 
-	mi.idx = append(mi.idx, idx)
+	if !idx.Final() {
+		mi.idx = append(mi.idx, idx)
+		return
+	}
+
+	mi.merge(idx)
+}
+
+// merge adds the blobs of the finalized index idx to the table. The caller
+// must hold the lock.
+func (mi *MasterIndex) merge(idx *Index) {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	debug.Log("merge index %v with %d blobs", idx.id, len(idx.pack))
+
+	for h, entries := range idx.pack {
+		for _, entry := range entries {
+			pack, ok := mi.packIdx[entry.packID]
+			if !ok {
+				pack = uint32(len(mi.packs))
+				mi.packs = append(mi.packs, entry.packID)
+				mi.packIdx[entry.packID] = pack
+			}
+
+			mi.blobs = append(mi.blobs, masterIndexEntry{
+				id:                 h.ID,
+				tpe:                h.Type,
+				pack:               pack,
+				offset:             uint32(entry.offset),
+				length:             uint32(entry.length),
+				uncompressedLength: uint32(entry.uncompressedLength),
+			})
+		}
+	}
+	mi.sorted = false
+
+	for _, id := range idx.treePacks {
+		mi.treePacks.Insert(id)
+	}
+
+	if !idx.id.IsNull() {
+		mi.indexIDs.Insert(idx.id)
+	}
 }
 
-// Remove deletes an index from the MasterIndex.
+// MergeFinalIndexes moves the blobs of all indexes which have been finalized
+// since they were added into the table.
+func (mi *MasterIndex) MergeFinalIndexes() {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+
+	list := mi.idx[:0]
+	for _, idx := range mi.idx {
+		if idx.Final() {
+			mi.merge(idx)
+			continue
+		}
+		list = append(list, idx)
+	}
+
+	// clear the references to the merged indexes
+	for i := len(list); i < len(mi.idx); i++ {
+		mi.idx[i] = nil
+	}
+	mi.idx = list
+}
+
+// Remove deletes an index which has not been finalized yet from the
+// MasterIndex.
 func (mi *MasterIndex) Remove(index *Index) {
 	mi.idxMutex.Lock()
 	defer mi.idxMutex.Unlock()
@@ -173,19 +399,44 @@ func (mi *MasterIndex) FullIndexes() []*Index {
 	return list
 }
 
-// All returns all indexes.
-func (mi *MasterIndex) All() []*Index {
-	mi.idxMutex.Lock()
-	defer mi.idxMutex.Unlock()
+// IDs returns the IDs of all index files merged into the MasterIndex.
+func (mi *MasterIndex) IDs() restic.IDSet {
+	mi.idxMutex.RLock()
+	defer mi.idxMutex.RUnlock()
 
-	return mi.idx
+	ids := restic.NewIDSet()
+	ids.Merge(mi.indexIDs)
+	return ids
+}
+
+// Packs returns the IDs of all packs known to the MasterIndex.
+func (mi *MasterIndex) Packs() restic.IDSet {
+	mi.idxMutex.RLock()
+	defer mi.idxMutex.RUnlock()
+
+	packs := restic.NewIDSet(mi.packs...)
+	for _, idx := range mi.idx {
+		packs.Merge(idx.Packs())
+	}
+
+	return packs
+}
+
+// TreePacks returns the IDs of all packs which only contain tree blobs.
+func (mi *MasterIndex) TreePacks() restic.IDSet {
+	mi.idxMutex.RLock()
+	defer mi.idxMutex.RUnlock()
+
+	packs := restic.NewIDSet()
+	packs.Merge(mi.treePacks)
+	return packs
 }
 
 // Each returns a channel that yields all blobs known to the index. When the
 // context is cancelled, the background goroutine terminates. This blocks any
 // modification of the index.
 func (mi *MasterIndex) Each(ctx context.Context) <-chan restic.PackedBlob {
-	mi.idxMutex.RLock()
+	mi.rlock()
 
 	ch := make(chan restic.PackedBlob)
 
@@ -195,6 +446,14 @@ func (mi *MasterIndex) Each(ctx context.Context) <-chan restic.PackedBlob {
 			close(ch)
 		}()
 
+		for i := range mi.blobs {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- mi.packedBlob(&mi.blobs[i]):
+			}
+		}
+
 		for _, idx := range mi.idx {
 			idxCh := idx.Each(ctx)
 			for pb := range idxCh {
@@ -212,46 +471,26 @@ func (mi *MasterIndex) Each(ctx context.Context) <-chan restic.PackedBlob {
 
 // RebuildIndex combines all known indexes to a new index, leaving out any
 // packs whose ID is contained in packBlacklist. The new index contains the IDs
-// of all known indexes in the "supersedes" field.
+// of all known index files in the "supersedes" field.
 func (mi *MasterIndex) RebuildIndex(packBlacklist restic.IDSet) (*Index, error) {
-	mi.idxMutex.Lock()
-	defer mi.idxMutex.Unlock()
-
-	debug.Log("start rebuilding index of %d indexes, pack blacklist: %v", len(mi.idx), packBlacklist)
+	debug.Log("start rebuilding index, pack blacklist: %v", packBlacklist)
 
 	newIndex := NewIndex()
 
 	ctx, cancel := context.WithCancel(context.TODO())
 	defer cancel()
 
-	for i, idx := range mi.idx {
-		debug.Log("adding index %d", i)
-
-		for pb := range idx.Each(ctx) {
-			if packBlacklist.Has(pb.PackID) {
-				continue
-			}
-
-			newIndex.Store(pb)
-		}
-
-		if !idx.Final() {
-			debug.Log("index %d isn't final, don't add to supersedes field", i)
+	for pb := range mi.Each(ctx) {
+		if packBlacklist.Has(pb.PackID) {
 			continue
 		}
 
-		id, err := idx.ID()
-		if err != nil {
-			debug.Log("index %d does not have an ID: %v", err)
-			return nil, err
-		}
-
-		debug.Log("adding index id %v to supersedes field", id)
+		newIndex.Store(pb)
+	}
 
-		err = newIndex.AddToSupersedes(id)
-		if err != nil {
-			return nil, err
-		}
+	err := newIndex.AddToSupersedes(mi.IDs().List()...)
+	if err != nil {
+		return nil, err
 	}
 
 	return newIndex, nil
@@ -1,6 +1,8 @@
 package repository_test
 
 import (
+	"bytes"
+	"context"
 	"math/rand"
 	"testing"
 
@@ -121,3 +123,97 @@ func BenchmarkMasterIndexLookupMultipleIndexUnknown(b *testing.B) {
 		mIdx.Lookup(lookupID, restic.DataBlob)
 	}
 }
+
+// finalizeIndex returns a finalized copy of idx, as if it was loaded from the
+// repository.
+func finalizeIndex(t testing.TB, idx *repository.Index) *repository.Index {
+	wr := bytes.NewBuffer(nil)
+	rtest.OK(t, idx.FinalizeBinary(wr))
+
+	idx, err := repository.DecodeIndex(wr.Bytes())
+	rtest.OK(t, err)
+	return idx
+}
+
+func TestMasterIndexFinal(t *testing.T) {
+	newBlob := func(tpe restic.BlobType, packID restic.ID, offset uint) restic.PackedBlob {
+		return restic.PackedBlob{
+			PackID: packID,
+			Blob: restic.Blob{
+				Type:   tpe,
+				ID:     restic.NewRandomID(),
+				Length: 10,
+				Offset: offset,
+			},
+		}
+	}
+
+	pack1, pack2, pack3, pack4 := restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()
+	blob1 := newBlob(restic.DataBlob, pack1, 0)
+	blob2 := newBlob(restic.TreeBlob, pack2, 0)
+	blob3 := newBlob(restic.DataBlob, pack3, 0)
+
+	// the same blob stored in a second pack
+	blob1dup := blob1
+	blob1dup.PackID = pack4
+
+	idx1 := repository.NewIndex()
+	idx1.Store(blob1)
+	idx1.Store(blob2)
+	idx1.Store(blob1dup)
+
+	// both packs are also listed in the second index
+	idx2 := repository.NewIndex()
+	idx2.Store(blob2)
+	idx2.Store(blob1dup)
+
+	mIdx := repository.NewMasterIndex()
+	mIdx.Insert(finalizeIndex(t, idx1))
+	mIdx.Insert(finalizeIndex(t, idx2))
+
+	// not finalized yet
+	idx3 := repository.NewIndex()
+	idx3.Store(blob3)
+	mIdx.Insert(idx3)
+
+	blobs, found := mIdx.Lookup(blob1.ID, restic.DataBlob)
+	rtest.Assert(t, found, "blob1 not found")
+	rtest.Equals(t, 2, len(blobs))
+	for _, pb := range blobs {
+		rtest.Assert(t, pb == blob1 || pb == blob1dup, "unexpected blob %v", pb)
+	}
+
+	blobs, found = mIdx.Lookup(blob2.ID, restic.TreeBlob)
+	rtest.Assert(t, found, "blob2 not found")
+	rtest.Equals(t, []restic.PackedBlob{blob2}, blobs)
+	rtest.Assert(t, !mIdx.Has(blob2.ID, restic.DataBlob), "tree blob found as data blob")
+
+	blobs, found = mIdx.Lookup(blob3.ID, restic.DataBlob)
+	rtest.Assert(t, found, "blob3 not found")
+	rtest.Equals(t, []restic.PackedBlob{blob3}, blobs)
+
+	// duplicate entries for the same location are only counted once
+	rtest.Equals(t, uint(3), mIdx.Count(restic.DataBlob))
+	rtest.Equals(t, uint(1), mIdx.Count(restic.TreeBlob))
+
+	n := 0
+	for range mIdx.Each(context.TODO()) {
+		n++
+	}
+	rtest.Equals(t, 4, n)
+
+	rtest.Equals(t, restic.NewIDSet(pack1, pack2, pack3, pack4), mIdx.Packs())
+	rtest.Equals(t, restic.NewIDSet(pack2), mIdx.TreePacks())
+	rtest.Equals(t, []restic.PackedBlob{blob2}, mIdx.ListPack(pack2))
+
+	// indexes which have been saved are merged into the table
+	rtest.OK(t, idx3.Finalize(bytes.NewBuffer(nil)))
+	mIdx.MergeFinalIndexes()
+	rtest.Equals(t, 0, len(mIdx.NotFinalIndexes()))
+	rtest.Assert(t, mIdx.Has(blob3.ID, restic.DataBlob), "blob3 not found after merging")
+
+	blob4 := newBlob(restic.DataBlob, restic.NewRandomID(), 0)
+	mIdx.Store(blob4)
+	rtest.Equals(t, 1, len(mIdx.NotFinalIndexes()))
+	rtest.Assert(t, mIdx.Has(blob4.ID, restic.DataBlob), "blob4 not found")
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"crypto/sha256"
+	"io/ioutil"
 	"os"
 	"sync"
 
@@ -36,8 +37,6 @@ type packerManager struct {
 	packers []*Packer
 }
 
-const minPackSize = 4 * 1024 * 1024
-
 // newPackerManager returns an new packer manager which writes temporary files
 // to a temporary directory
 func newPackerManager(be Saver, key *crypto.Key) *packerManager {
@@ -111,6 +110,23 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 
 	debug.Log("saved as %v", h)
 
+	if r.cfg.Parity != nil {
+		_, err = p.tmpfile.Seek(0, 0)
+		if err != nil {
+			return errors.Wrap(err, "Seek")
+		}
+
+		data, err := ioutil.ReadAll(p.tmpfile)
+		if err != nil {
+			return errors.Wrap(err, "ReadAll")
+		}
+
+		err = r.saveParity(ctx, id, data)
+		if err != nil {
+			return err
+		}
+	}
+
 	if t == restic.TreeBlob && r.Cache != nil {
 		debug.Log("saving tree pack file in cache")
 
@@ -140,10 +156,11 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 		debug.Log("  updating blob %v to pack %v", b.ID, id)
 		r.idx.Store(restic.PackedBlob{
 			Blob: restic.Blob{
-				Type:   b.Type,
-				ID:     b.ID,
-				Offset: b.Offset,
-				Length: uint(b.Length),
+				Type:               b.Type,
+				ID:                 b.ID,
+				Offset:             b.Offset,
+				Length:             uint(b.Length),
+				UncompressedLength: b.UncompressedLength,
 			},
 			PackID: id,
 		})
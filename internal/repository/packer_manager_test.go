@@ -91,13 +91,13 @@ func fillPacks(t testing.TB, rnd *randReader, be Saver, pm *packerManager, buf [
 			t.Fatal(err)
 		}
 
-		n, err := packer.Add(restic.DataBlob, id, buf)
+		n, err := packer.Add(restic.DataBlob, id, buf, 0)
 		if n != l {
 			t.Errorf("Add() returned invalid number of bytes: want %v, got %v", n, l)
 		}
 		bytes += l
 
-		if packer.Size() < minPackSize {
+		if packer.Size() < restic.DefaultPackSize {
 			pm.insertPacker(packer)
 			continue
 		}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/parity"
+	"github.com/restic/restic/internal/restic"
+)
+
+// saveParity computes the parity data for the pack file with the given id and
+// contents and stores it encrypted in the backend.
+func (r *Repository) saveParity(ctx context.Context, id restic.ID, data []byte) error {
+	cfg := r.cfg.Parity
+	f, err := parity.New(data, cfg.DataShards, cfg.ParityShards)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := f.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	ciphertext := restic.NewBlobBuffer(len(plaintext))
+	ciphertext = ciphertext[:0]
+	nonce := r.key.NewNonce()
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = r.key.Seal(ciphertext, nonce, plaintext, nil)
+
+	h := restic.Handle{Type: restic.ParityFile, Name: id.String()}
+	err = r.be.Save(ctx, h, restic.NewByteReader(ciphertext))
+	if err != nil {
+		debug.Log("Save(%v) error: %v", h, err)
+		return err
+	}
+
+	debug.Log("saved parity data for pack %v", id)
+	return nil
+}
+
+// LoadParity loads and decrypts the parity data for the pack file with the
+// given id.
+func LoadParity(ctx context.Context, repo restic.Repository, id restic.ID) (*parity.File, error) {
+	h := restic.Handle{Type: restic.ParityFile, Name: id.String()}
+	buf, err := backend.LoadAll(ctx, repo.Backend(), h)
+	if err != nil {
+		return nil, err
+	}
+
+	key := repo.Key()
+	if len(buf) < key.NonceSize() {
+		return nil, errors.Errorf("parity file %v is too short", id.Str())
+	}
+
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Errorf("decrypting parity file %v failed: %v", id.Str(), err)
+	}
+
+	var f parity.File
+	if err = f.UnmarshalBinary(plaintext); err != nil {
+		return nil, errors.Errorf("parity file %v: %v", id.Str(), err)
+	}
+
+	return &f, nil
+}
+
+// RepairPack reconstructs the contents of the pack file with the given id from
+// data, which may be damaged or truncated, using the parity data stored in the
+// repository. An error is returned if the pack cannot be reconstructed.
+func RepairPack(ctx context.Context, repo restic.Repository, id restic.ID, data []byte) ([]byte, error) {
+	f, err := LoadParity(ctx, repo, id)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := f.Repair(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !restic.Hash(buf).Equal(id) {
+		return nil, errors.New("reconstructed pack does not match its ID")
+	}
+
+	return buf, nil
+}
+
+// loadRepairedBlob downloads and repairs the pack containing blob and returns
+// the plaintext of the blob. plaintextBuf is used as in loadBlob.
+func (r *Repository) loadRepairedBlob(ctx context.Context, blob restic.PackedBlob, plaintextBuf []byte) ([]byte, error) {
+	h := restic.Handle{Type: restic.DataFile, Name: blob.PackID.String()}
+	data, err := backend.LoadAll(ctx, r.be, h)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = RepairPack(ctx, r, blob.PackID, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint(len(data)) < blob.Offset+blob.Length {
+		return nil, errors.Errorf("blob %v is not contained in pack %v", blob.ID.Str(), blob.PackID.Str())
+	}
+
+	plaintextBuf = plaintextBuf[:blob.Length]
+	copy(plaintextBuf, data[blob.Offset:blob.Offset+blob.Length])
+
+	debug.Log("repaired pack %v to load blob %v", blob.PackID, blob.ID)
+	return r.decryptBlob(blob, plaintextBuf)
+}
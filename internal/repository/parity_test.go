@@ -0,0 +1,82 @@
+package repository_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// damagePack flips some bits at the start of the pack file with the given id.
+func damagePack(t testing.TB, be restic.Backend, id restic.ID) []byte {
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+	buf, err := backend.LoadAll(context.TODO(), be, h)
+	rtest.OK(t, err)
+
+	damaged := append([]byte{}, buf...)
+	for i := 0; i < 100; i++ {
+		damaged[i] ^= 0x55
+	}
+
+	rtest.OK(t, be.Remove(context.TODO(), h))
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(damaged)))
+
+	return damaged
+}
+
+func TestLoadBlobParity(t *testing.T) {
+	repo, cleanup := repository.TestRepositoryWithParity(t, &restic.ParityConfig{DataShards: 10, ParityShards: 2})
+	defer cleanup()
+
+	length := 100000
+	buf := restic.NewBlobBuffer(length)
+	_, err := io.ReadFull(rnd, buf)
+	rtest.OK(t, err)
+
+	id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.Background()))
+
+	blobs, found := repo.Index().Lookup(id, restic.DataBlob)
+	rtest.Assert(t, found, "blob %v not found in the index", id.Str())
+	packID := blobs[0].PackID
+
+	exists, err := repo.Backend().Test(context.TODO(), restic.Handle{Type: restic.ParityFile, Name: packID.String()})
+	rtest.OK(t, err)
+	rtest.Assert(t, exists, "no parity file was saved for pack %v", packID.Str())
+
+	damaged := damagePack(t, repo.Backend(), packID)
+
+	// the blob is loaded from the reconstructed pack
+	loaded := make([]byte, 0, restic.CiphertextLength(len(buf)))
+	n, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, loaded)
+	rtest.OK(t, err)
+	rtest.Equals(t, id, restic.Hash(loaded[:n]))
+
+	repaired, err := repository.RepairPack(context.TODO(), repo, packID, damaged)
+	rtest.OK(t, err)
+	rtest.Equals(t, packID, restic.Hash(repaired))
+}
+
+func TestLoadBlobWithoutParity(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	buf := restic.NewBlobBuffer(1000)
+	_, err := io.ReadFull(rnd, buf)
+	rtest.OK(t, err)
+
+	id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.Background()))
+
+	blobs, _ := repo.Index().Lookup(id, restic.DataBlob)
+	damagePack(t, repo.Backend(), blobs[0].PackID)
+
+	_, err = repo.LoadBlob(context.TODO(), restic.DataBlob, id, make([]byte, 0, restic.CiphertextLength(len(buf))))
+	rtest.Assert(t, err != nil, "loading a damaged blob did not return an error")
+}
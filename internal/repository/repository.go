@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/errors"
@@ -30,6 +31,24 @@ type Repository struct {
 	idx     *MasterIndex
 	restic.Cache
 
+	// indexKey encrypts index, lock and config files in repositories with
+	// version 4 or later
+	indexKey *crypto.Key
+
+	// sessions contains the session keys of write-only clients, it is nil
+	// when the repository was opened with a write-only key
+	sessions *sessionKeys
+
+	// for write-only keys, the session key in key is sealed with
+	// sessionPublic and saved before it is used for the first time
+	writeOnly     bool
+	sessionPublic *crypto.PublicKey
+	sessionM      sync.Mutex
+	sessionSaved  bool
+
+	// packSize overrides the target pack size from the config if non-zero
+	packSize uint
+
 	treePM *packerManager
 	dataPM *packerManager
 }
@@ -51,6 +70,46 @@ func (r *Repository) Config() restic.Config {
 	return r.cfg
 }
 
+// SetConfig replaces the repository configuration used from now on, e.g. to
+// select the key for index files. The config file is not saved.
+func (r *Repository) SetConfig(cfg restic.Config) {
+	r.cfg = cfg
+}
+
+// SetPackSize overrides the target size of pack files stored in the
+// repository config for this process, zero restores the configured size.
+func (r *Repository) SetPackSize(size uint) error {
+	if size != 0 {
+		if err := restic.CheckPackSize(size); err != nil {
+			return err
+		}
+	}
+
+	r.packSize = size
+	return nil
+}
+
+// PackSize returns the target size of new pack files.
+func (r *Repository) PackSize() uint {
+	if r.packSize != 0 {
+		return r.packSize
+	}
+	return r.cfg.TargetPackSize()
+}
+
+// WriteOnly returns true if the repository has been opened with a write-only
+// key, which cannot decrypt the data stored in the repository.
+func (r *Repository) WriteOnly() bool {
+	return r.writeOnly
+}
+
+// errWriteOnly is returned when data is to be read with a write-only key.
+var errWriteOnly = errors.Fatal("the repository has been opened with a write-only key, which cannot read data")
+
+// errWriteOnlyConfig is returned when the config is to be saved with a
+// write-only key.
+var errWriteOnlyConfig = errors.Fatal("the repository has been opened with a write-only key, which cannot change the config")
+
 // UseCache replaces the backend with the wrapped cache.
 func (r *Repository) UseCache(c restic.Cache) {
 	if c == nil {
@@ -72,6 +131,10 @@ func (r *Repository) PrefixLength(t restic.FileType) (int, error) {
 func (r *Repository) LoadAndDecrypt(ctx context.Context, t restic.FileType, id restic.ID) (buf []byte, err error) {
 	debug.Log("load %v with id %v", t, id)
 
+	if r.writeOnly && !useIndexKey(r.cfg, t) {
+		return nil, errWriteOnly
+	}
+
 	h := restic.Handle{Type: t, Name: id.String()}
 	buf, err = backend.LoadAll(ctx, r.be, h)
 	if err != nil {
@@ -143,6 +206,10 @@ func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobTy
 			return 0, errors.Errorf("buffer is too small: %v < %v", cap(plaintextBuf), blob.Length)
 		}
 
+		if uint(cap(plaintextBuf)) < blob.UncompressedLength {
+			return 0, errors.Errorf("buffer is too small: %v < %v", cap(plaintextBuf), blob.UncompressedLength)
+		}
+
 		plaintextBuf = plaintextBuf[:blob.Length]
 
 		n, err := restic.ReadAt(ctx, r.be, h, int64(blob.Offset), plaintextBuf)
@@ -159,21 +226,26 @@ func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobTy
 			continue
 		}
 
-		// decrypt
-		nonce, ciphertext := plaintextBuf[:r.key.NonceSize()], plaintextBuf[r.key.NonceSize():]
-		plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
-		if err != nil {
-			lastError = errors.Errorf("decrypting blob %v failed: %v", id, err)
-			continue
+		plaintext, err := r.decryptBlob(blob, plaintextBuf)
+		if err != nil && r.cfg.Parity != nil {
+			// the pack is damaged, try to reconstruct it from the parity data
+			debug.Log("blob %v in pack %v is damaged: %v", id, blob.PackID, err)
+			var repairErr error
+			plaintext, repairErr = r.loadRepairedBlob(ctx, blob, plaintextBuf)
+			if repairErr != nil {
+				err = errors.Errorf("%v, repair using parity data failed: %v", err, repairErr)
+			} else {
+				err = nil
+			}
 		}
 
-		// check hash
-		if !restic.Hash(plaintext).Equal(id) {
-			lastError = errors.Errorf("blob %v returned invalid hash", id)
+		if err != nil {
+			lastError = err
 			continue
 		}
 
 		// move decrypted data to the start of the provided buffer
+		plaintextBuf = plaintextBuf[:len(plaintext)]
 		copy(plaintextBuf[0:], plaintext)
 		return len(plaintext), nil
 	}
@@ -185,6 +257,31 @@ func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobTy
 	return 0, errors.Errorf("loading blob %v from %v packs failed", id.Str(), len(blobs))
 }
 
+// decryptBlob decrypts and, if necessary, decompresses the ciphertext of blob
+// contained in buf and verifies its hash. The plaintext is returned, buf is
+// overwritten in the process.
+func (r *Repository) decryptBlob(blob restic.PackedBlob, buf []byte) ([]byte, error) {
+	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
+	plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Errorf("decrypting blob %v failed: %v", blob.ID, err)
+	}
+
+	if blob.IsCompressed() {
+		plaintext, err = DecompressBlob(plaintext, blob.UncompressedLength, nil)
+		if err != nil {
+			return nil, errors.Errorf("decompressing blob %v failed: %v", blob.ID, err)
+		}
+	}
+
+	// check hash
+	if !restic.Hash(plaintext).Equal(blob.ID) {
+		return nil, errors.Errorf("blob %v returned invalid hash", blob.ID)
+	}
+
+	return plaintext, nil
+}
+
 // LoadJSONUnpacked decrypts the data and afterwards calls json.Unmarshal on
 // the item.
 func (r *Repository) LoadJSONUnpacked(ctx context.Context, t restic.FileType, id restic.ID, item interface{}) (err error) {
@@ -202,7 +299,9 @@ func (r *Repository) LookupBlobSize(id restic.ID, tpe restic.BlobType) (uint, bo
 }
 
 // SaveAndEncrypt encrypts data and stores it to the backend as type t. If data
-// is small enough, it will be packed together with other small blobs.
+// is small enough, it will be packed together with other small blobs. When
+// compression is enabled for the repository, data is compressed before it is
+// encrypted.
 func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data []byte, id *restic.ID) (restic.ID, error) {
 	if id == nil {
 		// compute plaintext hash
@@ -212,11 +311,27 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 
 	debug.Log("save id %v (%v, %d bytes)", id, t, len(data))
 
+	uncompressedLength := 0
+	compressed, err := compressBlob(r.cfg.Compression, data)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	if compressed != nil {
+		debug.Log("compressed blob %v from %d to %d bytes", id, len(data), len(compressed))
+		uncompressedLength = len(data)
+		data = compressed
+	}
+
+	if err = r.saveSession(ctx); err != nil {
+		return restic.ID{}, err
+	}
+
 	// get buf from the pool
 	ciphertext := getBuf()
 
 	ciphertext = ciphertext[:0]
-	nonce := crypto.NewRandomNonce()
+	nonce := r.key.NewNonce()
 	ciphertext = append(ciphertext, nonce...)
 	defer freeBuf(ciphertext)
 
@@ -241,13 +356,13 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 	}
 
 	// save ciphertext
-	_, err = packer.Add(t, *id, ciphertext)
+	_, err = packer.Add(t, *id, ciphertext, uncompressedLength)
 	if err != nil {
 		return restic.ID{}, err
 	}
 
 	// if the pack is not full enough, put back to the list
-	if packer.Size() < minPackSize {
+	if packer.Size() < r.PackSize() && !packer.HeaderFull() {
 		debug.Log("pack is not full enough (%d bytes)", packer.Size())
 		pm.insertPacker(packer)
 		return *id, nil
@@ -272,12 +387,23 @@ func (r *Repository) SaveJSONUnpacked(ctx context.Context, t restic.FileType, it
 // SaveUnpacked encrypts data and stores it in the backend. Returned is the
 // storage hash.
 func (r *Repository) SaveUnpacked(ctx context.Context, t restic.FileType, p []byte) (id restic.ID, err error) {
+	if r.writeOnly && t == restic.ConfigFile {
+		return restic.ID{}, errWriteOnlyConfig
+	}
+
+	key := r.key
+	if useIndexKey(r.cfg, t) {
+		key = r.indexKey
+	} else if err = r.saveSession(ctx); err != nil {
+		return restic.ID{}, err
+	}
+
 	ciphertext := restic.NewBlobBuffer(len(p))
 	ciphertext = ciphertext[:0]
-	nonce := crypto.NewRandomNonce()
+	nonce := key.NewNonce()
 	ciphertext = append(ciphertext, nonce...)
 
-	ciphertext = r.key.Seal(ciphertext, nonce, p, nil)
+	ciphertext = key.Seal(ciphertext, nonce, p, nil)
 
 	id = restic.Hash(ciphertext)
 	h := restic.Handle{Type: t, Name: id.String()}
@@ -334,29 +460,30 @@ func (r *Repository) Index() restic.Index {
 func (r *Repository) SetIndex(i restic.Index) error {
 	r.idx = i.(*MasterIndex)
 
-	ids := restic.NewIDSet()
-	for _, idx := range r.idx.All() {
-		id, err := idx.ID()
-		if err != nil {
-			debug.Log("not using index, ID() returned error %v", err)
-			continue
-		}
-		ids.Insert(id)
-	}
-
-	return r.PrepareCache(ids)
+	return r.PrepareCache(r.idx.IDs())
 }
 
-// SaveIndex saves an index in the repository.
+// SaveIndex saves an index in the repository. The binary format is used if
+// the repository version supports it.
 func SaveIndex(ctx context.Context, repo restic.Repository, index *Index) (restic.ID, error) {
 	buf := bytes.NewBuffer(nil)
 
-	err := index.Finalize(buf)
+	var err error
+	if useBinaryIndex(repo.Config()) {
+		err = index.FinalizeBinary(buf)
+	} else {
+		err = index.Finalize(buf)
+	}
 	if err != nil {
 		return restic.ID{}, err
 	}
 
-	return repo.SaveUnpacked(ctx, restic.IndexFile, buf.Bytes())
+	id, err := repo.SaveUnpacked(ctx, restic.IndexFile, buf.Bytes())
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	return id, index.SetID(id)
 }
 
 // saveIndex saves all indexes in the backend.
@@ -372,6 +499,9 @@ func (r *Repository) saveIndex(ctx context.Context, indexes ...*Index) error {
 		debug.Log("Saved index %d as %v", i, sid)
 	}
 
+	// saved indexes are kept in the compact representation
+	r.idx.MergeFinalIndexes()
+
 	return nil
 }
 
@@ -448,25 +578,13 @@ func (r *Repository) PrepareCache(indexIDs restic.IDSet) error {
 		fmt.Fprintf(os.Stderr, "error clearing index files in cache: %v\n", err)
 	}
 
-	packs := restic.NewIDSet()
-	for _, idx := range r.idx.All() {
-		for id := range idx.Packs() {
-			packs.Insert(id)
-		}
-	}
-
 	// clear old data files
-	err = r.Cache.Clear(restic.DataFile, packs)
+	err = r.Cache.Clear(restic.DataFile, r.idx.Packs())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error clearing data files in cache: %v\n", err)
 	}
 
-	treePacks := restic.NewIDSet()
-	for _, idx := range r.idx.All() {
-		for _, id := range idx.TreePacks() {
-			treePacks.Insert(id)
-		}
-	}
+	treePacks := r.idx.TreePacks()
 
 	// use readahead
 	debug.Log("using readahead")
@@ -517,10 +635,12 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 		return err
 	}
 
-	r.key = key.master
-	r.dataPM.key = key.master
-	r.treePM.key = key.master
 	r.keyName = key.Name()
+	if key.WriteOnly {
+		return r.openWriteOnly(ctx, key.writeOnly)
+	}
+
+	r.setMasterKey(key.master)
 	r.cfg, err = restic.LoadConfig(ctx, r)
 	if err != nil {
 		return errors.Fatalf("config cannot be loaded: %v", err)
@@ -528,9 +648,85 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 	return nil
 }
 
+// setMasterKey configures the repository to use the master key. Data saved by
+// write-only clients is decrypted with their session keys, which are loaded
+// when needed.
+func (r *Repository) setMasterKey(master *crypto.Key) {
+	r.key = master
+	r.dataPM.key = master
+	r.treePM.key = master
+	r.indexKey = deriveIndexKey(master)
+	r.sessions = newSessionKeys(r.be, master.PrivateKey())
+
+	master.SetFallback(func(nonce []byte) []*crypto.Key {
+		prefix := nonce[:crypto.NoncePrefixSize]
+		if bytes.Equal(prefix, indexKeyNoncePrefix) {
+			return []*crypto.Key{r.indexKey}
+		}
+		return r.sessions.Find(context.TODO(), prefix)
+	})
+}
+
+// openWriteOnly configures the repository for the write-only key wk. A new
+// session key is created and used for all data saved afterwards.
+func (r *Repository) openWriteOnly(ctx context.Context, wk *writeOnlyKey) error {
+	wk.Index.SetNoncePrefix(indexKeyNoncePrefix)
+
+	session := crypto.NewRandomKey()
+	session.SetFallback(func(nonce []byte) []*crypto.Key {
+		return []*crypto.Key{wk.Index}
+	})
+
+	r.key = session
+	r.dataPM.key = session
+	r.treePM.key = session
+	r.indexKey = wk.Index
+
+	var err error
+	r.cfg, err = restic.LoadConfig(ctx, r)
+	if err != nil {
+		return errors.Fatalf("config cannot be loaded: %v", err)
+	}
+
+	if r.cfg.Version < 4 {
+		return errors.Fatalf("write-only keys require repository version 4, but the repository has version %d", r.cfg.Version)
+	}
+	r.writeOnly = true
+	r.sessionPublic = wk.Public
+
+	return nil
+}
+
+// saveSession stores the session key of a write-only client sealed with the
+// public key of the repository, so that clients with the password can read the
+// data saved with it. This happens before the session key is used for the
+// first time, so that read-only operations leave no session key behind.
+func (r *Repository) saveSession(ctx context.Context) error {
+	if !r.writeOnly {
+		return nil
+	}
+
+	r.sessionM.Lock()
+	defer r.sessionM.Unlock()
+
+	if r.sessionSaved {
+		return nil
+	}
+
+	_, err := saveSessionKey(ctx, r.be, r.sessionPublic, r.key)
+	if err != nil {
+		return err
+	}
+
+	r.sessionSaved = true
+	return nil
+}
+
 // Init creates a new master key with the supplied password, initializes and
-// saves the repository config.
-func (r *Repository) Init(ctx context.Context, password string) error {
+// saves the repository config cfg, which is usually created by
+// restic.CreateConfig(). The metadata and KDF parameters for the key are taken
+// from opts.
+func (r *Repository) Init(ctx context.Context, password string, opts KeyOptions, cfg restic.Config) error {
 	has, err := r.be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
 	if err != nil {
 		return err
@@ -539,27 +735,20 @@ func (r *Repository) Init(ctx context.Context, password string) error {
 		return errors.New("repository master key and config already initialized")
 	}
 
-	cfg, err := restic.CreateConfig()
-	if err != nil {
-		return err
-	}
-
-	return r.init(ctx, password, cfg)
+	return r.init(ctx, password, opts, cfg)
 }
 
 // init creates a new master key with the supplied password and uses it to save
 // the config into the repo.
-func (r *Repository) init(ctx context.Context, password string, cfg restic.Config) error {
-	key, err := createMasterKey(r, password)
+func (r *Repository) init(ctx context.Context, password string, opts KeyOptions, cfg restic.Config) error {
+	key, err := createMasterKey(r, password, opts)
 	if err != nil {
 		return err
 	}
 
-	r.key = key.master
-	r.dataPM.key = key.master
-	r.treePM.key = key.master
+	r.setMasterKey(key.master)
 	r.keyName = key.Name()
-	r.cfg = cfg
+	r.SetConfig(cfg)
 	_, err = r.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
 	return err
 }
@@ -615,6 +804,10 @@ func (r *Repository) Close() error {
 // space.
 func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) (int, error) {
 	debug.Log("load blob %v into buf (len %v, cap %v)", id, len(buf), cap(buf))
+	if r.writeOnly {
+		return 0, errWriteOnly
+	}
+
 	size, found := r.idx.LookupSize(id, t)
 	if !found {
 		return 0, errors.Errorf("id %v not found in repository", id)
@@ -649,6 +842,10 @@ func (r *Repository) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte
 func (r *Repository) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
 	debug.Log("load tree %v", id)
 
+	if r.writeOnly {
+		return nil, errWriteOnly
+	}
+
 	size, found := r.idx.LookupSize(id, restic.TreeBlob)
 	if !found {
 		return nil, errors.Errorf("tree %v not found in repository", id)
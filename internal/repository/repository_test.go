@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"bytes"
+	"compress/flate"
 	"context"
 	"crypto/sha256"
 	"io"
@@ -90,6 +91,83 @@ func TestSaveFrom(t *testing.T) {
 	}
 }
 
+func TestSaveCompressed(t *testing.T) {
+	for _, mode := range []restic.CompressionMode{restic.CompressionAuto, restic.CompressionMax} {
+		t.Run(string(mode), func(t *testing.T) {
+			repo, cleanup := repository.TestRepositoryWithCompression(t, mode)
+			defer cleanup()
+
+			for _, size := range testSizes {
+				// compressible data: random bytes, each repeated a few times
+				data := make([]byte, size)
+				for i := range data {
+					data[i] = byte(rnd.Intn(4))
+				}
+
+				id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{})
+				rtest.OK(t, err)
+				rtest.OK(t, repo.Flush(context.Background()))
+
+				blobs, found := repo.Index().Lookup(id, restic.DataBlob)
+				rtest.Assert(t, found, "blob %v not found in index", id.Str())
+				if size > 100 {
+					rtest.Assert(t, blobs[0].IsCompressed(), "blob of size %d was not compressed", size)
+					rtest.Assert(t, blobs[0].Length < uint(size), "compressed blob is not smaller (%d >= %d)", blobs[0].Length, size)
+				}
+
+				length, found := repo.LookupBlobSize(id, restic.DataBlob)
+				rtest.Assert(t, found, "blob %v not found in index", id.Str())
+				rtest.Equals(t, uint(size), length)
+
+				buf := restic.NewBlobBuffer(size)
+				n, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, buf)
+				rtest.OK(t, err)
+				rtest.Equals(t, size, n)
+				rtest.Assert(t, bytes.Equal(buf[:n], data), "data does not match for blob of size %d", size)
+			}
+		})
+	}
+}
+
+func TestDecompressBlobLength(t *testing.T) {
+	data := bytes.Repeat([]byte("restic"), 1000)
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	rtest.OK(t, err)
+	_, err = w.Write(data)
+	rtest.OK(t, err)
+	rtest.OK(t, w.Close())
+
+	plaintext, err := repository.DecompressBlob(buf.Bytes(), uint(len(data)), nil)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(plaintext, data), "decompressed data does not match")
+
+	// the length is checked before a buffer is allocated for it
+	_, err = repository.DecompressBlob(buf.Bytes(), restic.MaxPackSize+1, nil)
+	rtest.Assert(t, err != nil, "uncompressed length larger than MaxPackSize was accepted")
+
+	_, err = repository.DecompressBlob(buf.Bytes(), uint(len(data))+1, nil)
+	rtest.Assert(t, err != nil, "wrong uncompressed length was accepted")
+}
+
+func TestSaveIncompressible(t *testing.T) {
+	repo, cleanup := repository.TestRepositoryWithCompression(t, restic.CompressionAuto)
+	defer cleanup()
+
+	data := make([]byte, 1<<16)
+	_, err := io.ReadFull(rnd, data)
+	rtest.OK(t, err)
+
+	id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.Background()))
+
+	blobs, found := repo.Index().Lookup(id, restic.DataBlob)
+	rtest.Assert(t, found, "blob %v not found in index", id.Str())
+	rtest.Assert(t, !blobs[0].IsCompressed(), "random data was stored compressed")
+}
+
 func BenchmarkSaveAndEncrypt(t *testing.B) {
 	repo, cleanup := repository.TestRepository(t)
 	defer cleanup()
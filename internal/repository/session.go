@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Clients which have opened the repository with a write-only key encrypt all
+// new data with a random session key. The session key is sealed with the
+// public key of the repository and stored as a file of type SessionKeyFile, so
+// only clients with access to the master key can open it. All nonces created
+// with a session key start with the first bytes of the ID of its file, which
+// is used to find the session key for some data.
+
+// indexKeyNoncePrefix is used for all nonces created with the index key.
+// Session keys never use this prefix.
+var indexKeyNoncePrefix = make([]byte, crypto.NoncePrefixSize)
+
+// deriveIndexKey returns the key which encrypts the index, lock and config
+// files of repositories with version 4 or later. Write-only clients need to
+// read these files.
+func deriveIndexKey(master *crypto.Key) *crypto.Key {
+	k := master.DeriveKey("restic index key")
+	k.SetNoncePrefix(indexKeyNoncePrefix)
+	return k
+}
+
+// useIndexKey returns true if files of type t are encrypted with the index
+// key in a repository with the given config.
+func useIndexKey(cfg restic.Config, t restic.FileType) bool {
+	if cfg.Version < 4 {
+		return false
+	}
+
+	switch t {
+	case restic.IndexFile, restic.LockFile, restic.ConfigFile:
+		return true
+	}
+	return false
+}
+
+// sessionKeys loads the session keys of write-only clients on demand.
+type sessionKeys struct {
+	be   restic.Backend
+	priv *crypto.PrivateKey
+
+	m       sync.Mutex
+	keys    map[restic.ID]*crypto.Key
+	missing map[string]struct{}
+}
+
+func newSessionKeys(be restic.Backend, priv *crypto.PrivateKey) *sessionKeys {
+	return &sessionKeys{
+		be:      be,
+		priv:    priv,
+		keys:    make(map[restic.ID]*crypto.Key),
+		missing: make(map[string]struct{}),
+	}
+}
+
+// Find returns the session keys whose ID starts with prefix. The session key
+// files are only listed once for each unknown prefix.
+func (s *sessionKeys) Find(ctx context.Context, prefix []byte) []*crypto.Key {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	keys := s.lookup(prefix)
+	if len(keys) > 0 {
+		return keys
+	}
+
+	if _, ok := s.missing[string(prefix)]; ok {
+		return nil
+	}
+
+	err := s.be.List(ctx, restic.SessionKeyFile, func(fi restic.FileInfo) error {
+		id, err := restic.ParseID(fi.Name)
+		if err != nil {
+			debug.Log("ignoring session key with invalid name %v", fi.Name)
+			return nil
+		}
+
+		if _, ok := s.keys[id]; ok || string(id[:len(prefix)]) != string(prefix) {
+			return nil
+		}
+
+		k, err := s.load(ctx, id)
+		if err != nil {
+			debug.Log("unable to load session key %v: %v", id, err)
+			return nil
+		}
+
+		s.keys[id] = k
+		return nil
+	})
+	if err != nil {
+		debug.Log("listing session keys failed: %v", err)
+	}
+
+	keys = s.lookup(prefix)
+	if len(keys) == 0 {
+		s.missing[string(prefix)] = struct{}{}
+	}
+
+	return keys
+}
+
+// lookup returns the loaded session keys whose ID starts with prefix.
+func (s *sessionKeys) lookup(prefix []byte) (keys []*crypto.Key) {
+	for id, k := range s.keys {
+		if string(id[:len(prefix)]) == string(prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// load loads and opens the session key with the given ID.
+func (s *sessionKeys) load(ctx context.Context, id restic.ID) (*crypto.Key, error) {
+	buf, err := backend.LoadAll(ctx, s.be, restic.Handle{Type: restic.SessionKeyFile, Name: id.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	if !restic.Hash(buf).Equal(id) {
+		return nil, errors.Errorf("session key %v does not match its ID", id.Str())
+	}
+
+	plaintext, err := s.priv.Open(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &crypto.Key{}
+	if err = json.Unmarshal(plaintext, k); err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	if !k.Valid() {
+		return nil, errors.Errorf("session key %v is invalid", id.Str())
+	}
+
+	return k, nil
+}
+
+// saveSessionKey seals the session key k with the public key pub and stores
+// it in the backend. Afterwards, the nonces created with k are marked with the
+// ID of the session key.
+func saveSessionKey(ctx context.Context, be restic.Backend, pub *crypto.PublicKey, k *crypto.Key) (restic.ID, error) {
+	plaintext, err := json.Marshal(k)
+	if err != nil {
+		return restic.ID{}, errors.Wrap(err, "Marshal")
+	}
+
+	var buf []byte
+	var id restic.ID
+	for {
+		buf, err = pub.Seal(plaintext)
+		if err != nil {
+			return restic.ID{}, err
+		}
+
+		// the prefix of the index key must not be used by a session key
+		id = restic.Hash(buf)
+		if string(id[:crypto.NoncePrefixSize]) != string(indexKeyNoncePrefix) {
+			break
+		}
+	}
+
+	h := restic.Handle{Type: restic.SessionKeyFile, Name: id.String()}
+	if err = be.Save(ctx, h, restic.NewByteReader(buf)); err != nil {
+		return restic.ID{}, err
+	}
+
+	k.SetNoncePrefix(id[:crypto.NoncePrefixSize])
+	debug.Log("saved session key %v", id)
+
+	return id, nil
+}
+
+// ReencryptIndex saves the index file with the given ID again, so that it is
+// encrypted with the key selected by the current repository config, and
+// removes the old file. The ID of the new index file is returned.
+func ReencryptIndex(ctx context.Context, repo restic.Repository, id restic.ID) (restic.ID, error) {
+	buf, err := repo.LoadAndDecrypt(ctx, restic.IndexFile, id)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	newID, err := repo.SaveUnpacked(ctx, restic.IndexFile, buf)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	err = repo.Backend().Remove(ctx, restic.Handle{Type: restic.IndexFile, Name: id.String()})
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	debug.Log("re-encrypted index %v as %v", id, newID)
+	return newID, nil
+}
@@ -0,0 +1,99 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRepositoryVersion(t *testing.T, be restic.Backend, version uint) *repository.Repository {
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+
+	cfg := restic.TestCreateConfig(t, chunker.Pol(0x3DA3358B4DC173))
+	cfg.Version = version
+
+	repo := repository.New(be)
+	rtest.OK(t, repo.Init(context.TODO(), rtest.TestPassword, repository.KeyOptions{}, cfg))
+	return repo
+}
+
+func saveTestBlob(t *testing.T, repo restic.Repository, data string) restic.ID {
+	id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, []byte(data), restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+	rtest.OK(t, repo.SaveIndex(context.TODO()))
+	return id
+}
+
+func TestWriteOnlyKey(t *testing.T) {
+	be := mem.New()
+	repo := testRepositoryVersion(t, be, 4)
+	existing := saveTestBlob(t, repo, "existing data")
+
+	_, err := repository.AddKey(context.TODO(), repo, "write-only",
+		repository.KeyOptions{WriteOnly: true}, repo.Key())
+	rtest.OK(t, err)
+
+	// open the repository with the write-only key and add new data
+	wrepo := repository.New(be)
+	rtest.OK(t, wrepo.SearchKey(context.TODO(), "write-only", 0))
+	rtest.Assert(t, wrepo.WriteOnly(), "repository was not opened with a write-only key")
+	rtest.OK(t, wrepo.LoadIndex(context.TODO()))
+	rtest.Assert(t, wrepo.Index().Has(existing, restic.DataBlob), "existing blob not found in the index")
+
+	buf := make([]byte, restic.CiphertextLength(len("existing data")))
+	_, err = wrepo.LoadBlob(context.TODO(), restic.DataBlob, existing, buf)
+	rtest.Assert(t, err != nil, "loading a blob with a write-only key did not fail")
+
+	added := saveTestBlob(t, wrepo, "new data")
+	item := map[string]string{"foo": "bar"}
+	itemID, err := wrepo.SaveJSONUnpacked(context.TODO(), restic.SnapshotFile, item)
+	rtest.OK(t, err)
+
+	var loaded map[string]string
+	err = wrepo.LoadJSONUnpacked(context.TODO(), restic.SnapshotFile, itemID, &loaded)
+	rtest.Assert(t, err != nil, "loading a snapshot with a write-only key did not fail")
+
+	_, err = wrepo.SaveJSONUnpacked(context.TODO(), restic.ConfigFile, wrepo.Config())
+	rtest.Assert(t, err != nil, "saving the config with a write-only key did not fail")
+
+	sessions := 0
+	rtest.OK(t, wrepo.List(context.TODO(), restic.SessionKeyFile, func(restic.ID, int64) error {
+		sessions++
+		return nil
+	}))
+	rtest.Equals(t, 1, sessions)
+
+	// the data saved by the write-only client can be read with the password
+	repo = repository.New(be)
+	rtest.OK(t, repo.SearchKey(context.TODO(), rtest.TestPassword, 0))
+	rtest.Assert(t, !repo.WriteOnly(), "repository was opened with a write-only key")
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+	buf = make([]byte, restic.CiphertextLength(len("new data")))
+	n, err := repo.LoadBlob(context.TODO(), restic.DataBlob, added, buf)
+	rtest.OK(t, err)
+	rtest.Equals(t, "new data", string(buf[:n]))
+
+	rtest.OK(t, repo.LoadJSONUnpacked(context.TODO(), restic.SnapshotFile, itemID, &loaded))
+	rtest.Equals(t, item, loaded)
+}
+
+func TestWriteOnlyKeyOldVersion(t *testing.T) {
+	be := mem.New()
+	repo := testRepositoryVersion(t, be, 3)
+
+	_, err := repository.AddKey(context.TODO(), repo, "write-only",
+		repository.KeyOptions{WriteOnly: true}, repo.Key())
+	rtest.OK(t, err)
+
+	wrepo := repository.New(be)
+	err = wrepo.SearchKey(context.TODO(), "write-only", 0)
+	rtest.Assert(t, err != nil, "opening a repository with version 3 with a write-only key did not fail")
+}
@@ -42,6 +42,25 @@ const testChunkerPol = chunker.Pol(0x3DA3358B4DC173)
 // password. If be is nil, an in-memory backend is used. A constant polynomial
 // is used for the chunker and low-security test parameters.
 func TestRepositoryWithBackend(t testing.TB, be restic.Backend) (r restic.Repository, cleanup func()) {
+	test.Helper(t).Helper()
+	return testRepository(t, be, restic.CompressionOff, nil)
+}
+
+// TestRepositoryWithCompression returns a repository like TestRepository on an
+// in-memory backend, which compresses blobs according to mode.
+func TestRepositoryWithCompression(t testing.TB, mode restic.CompressionMode) (r restic.Repository, cleanup func()) {
+	test.Helper(t).Helper()
+	return testRepository(t, nil, mode, nil)
+}
+
+// TestRepositoryWithParity returns a repository like TestRepository on an
+// in-memory backend, which stores parity data for all packs according to p.
+func TestRepositoryWithParity(t testing.TB, p *restic.ParityConfig) (r restic.Repository, cleanup func()) {
+	test.Helper(t).Helper()
+	return testRepository(t, nil, restic.CompressionOff, p)
+}
+
+func testRepository(t testing.TB, be restic.Backend, mode restic.CompressionMode, p *restic.ParityConfig) (r restic.Repository, cleanup func()) {
 	test.Helper(t).Helper()
 	TestUseLowSecurityKDFParameters(t)
 	restic.TestDisableCheckPolynomial(t)
@@ -54,7 +73,9 @@ func TestRepositoryWithBackend(t testing.TB, be restic.Backend) (r restic.Reposi
 	repo := New(be)
 
 	cfg := restic.TestCreateConfig(t, testChunkerPol)
-	err := repo.init(context.TODO(), test.TestPassword, cfg)
+	cfg.Compression = mode
+	cfg.Parity = p
+	err := repo.init(context.TODO(), test.TestPassword, KeyOptions{}, cfg)
 	if err != nil {
 		t.Fatalf("TestRepository(): initialize repo failed: %v", err)
 	}
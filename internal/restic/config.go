@@ -13,14 +13,112 @@ import (
 
 // Config contains the configuration for a repository.
 type Config struct {
-	Version           uint        `json:"version"`
-	ID                string      `json:"id"`
-	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+	Version           uint            `json:"version"`
+	ID                string          `json:"id"`
+	ChunkerPolynomial chunker.Pol     `json:"chunker_polynomial"`
+	Compression       CompressionMode `json:"compression,omitempty"`
+	Parity            *ParityConfig   `json:"parity,omitempty"`
+
+	// PackSize is the target size of pack files in bytes, zero selects
+	// DefaultPackSize.
+	PackSize uint `json:"pack_size,omitempty"`
 }
 
-// RepoVersion is the version that is written to the config when a repository
-// is newly created with Init().
-const RepoVersion = 1
+// These are the limits for the target size of pack files. The offsets of
+// blobs within a pack are stored as 32 bit values in the in-memory index, so
+// packs must stay well below 4 GiB.
+const (
+	DefaultPackSize = 4 * 1024 * 1024
+	MinPackSize     = 1 * 1024 * 1024
+	MaxPackSize     = 128 * 1024 * 1024
+)
+
+// CheckPackSize returns an error if size is not a valid target size for pack
+// files.
+func CheckPackSize(size uint) error {
+	if size < MinPackSize || size > MaxPackSize {
+		return errors.Errorf("invalid pack size %d, must be between %d MiB and %d MiB",
+			size, MinPackSize/(1024*1024), MaxPackSize/(1024*1024))
+	}
+	return nil
+}
+
+// TargetPackSize returns the target size of pack files for the repository.
+func (cfg Config) TargetPackSize() uint {
+	if cfg.PackSize == 0 {
+		return DefaultPackSize
+	}
+	return cfg.PackSize
+}
+
+// ParityConfig describes the redundancy data stored for each pack file. A
+// pack is split into DataShards parts, for which ParityShards parts of parity
+// data are computed. Up to ParityShards damaged parts of a pack can be
+// reconstructed.
+type ParityConfig struct {
+	DataShards   int `json:"data_shards"`
+	ParityShards int `json:"parity_shards"`
+}
+
+// NewParityConfig returns a ParityConfig for the given number of shards.
+func NewParityConfig(dataShards, parityShards int) (*ParityConfig, error) {
+	p := &ParityConfig{DataShards: dataShards, ParityShards: parityShards}
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p ParityConfig) check() error {
+	// the Reed-Solomon code works on bytes, so at most 256 shards are possible
+	if p.DataShards <= 0 || p.ParityShards <= 0 || p.DataShards+p.ParityShards > 256 {
+		return errors.Errorf("invalid number of shards for parity data: %d data and %d parity shards", p.DataShards, p.ParityShards)
+	}
+	return nil
+}
+
+const (
+	// MinRepoVersion is the oldest repository version restic can read.
+	MinRepoVersion = 1
+
+	// MaxRepoVersion is the newest repository version restic can read.
+	// Version 2 adds compression, version 3 stores index files in a compact
+	// binary format, version 4 supports write-only keys.
+	MaxRepoVersion = 4
+)
+
+// RepoVersion is the stable repository version, which is used for new
+// repositories unless a different version is selected explicitly.
+const RepoVersion = 2
+
+// CompressionMode selects if and how blobs are compressed before they are
+// encrypted and stored in a pack.
+type CompressionMode string
+
+// These are the compression modes a repository can be configured with.
+const (
+	CompressionOff  CompressionMode = "off"
+	CompressionAuto CompressionMode = "auto"
+	CompressionMax  CompressionMode = "max"
+)
+
+// ParseCompressionMode returns the compression mode for s. The empty string
+// is treated as CompressionOff.
+func ParseCompressionMode(s string) (CompressionMode, error) {
+	switch CompressionMode(s) {
+	case "", CompressionOff:
+		return CompressionOff, nil
+	case CompressionAuto, CompressionMax:
+		return CompressionMode(s), nil
+	}
+
+	return "", errors.Errorf("invalid compression mode %q", s)
+}
+
+// Enabled returns true if blobs are to be compressed.
+func (m CompressionMode) Enabled() bool {
+	return m != "" && m != CompressionOff
+}
 
 // JSONUnpackedLoader loads unpacked JSON.
 type JSONUnpackedLoader interface {
@@ -28,20 +126,29 @@ type JSONUnpackedLoader interface {
 }
 
 // CreateConfig creates a config file with a randomly selected polynomial and
-// ID.
-func CreateConfig() (Config, error) {
+// ID. Compression is only supported by repositories of version 2 or later.
+func CreateConfig(version uint, compression CompressionMode) (Config, error) {
 	var (
 		err error
 		cfg Config
 	)
 
+	if version < MinRepoVersion || version > MaxRepoVersion {
+		return Config{}, errors.Errorf("unsupported repository version %v", version)
+	}
+
 	cfg.ChunkerPolynomial, err = chunker.RandomPolynomial()
 	if err != nil {
 		return Config{}, errors.Wrap(err, "chunker.RandomPolynomial")
 	}
 
 	cfg.ID = NewRandomID().String()
-	cfg.Version = RepoVersion
+	cfg.Version = version
+	cfg.Compression = compression
+
+	if err = cfg.check(); err != nil {
+		return Config{}, err
+	}
 
 	debug.Log("New config: %#v", cfg)
 	return cfg, nil
@@ -66,6 +173,32 @@ func TestDisableCheckPolynomial(t testing.TB) {
 	checkPolynomial = false
 }
 
+// check tests whether the settings in the config are supported by its
+// version.
+func (cfg Config) check() error {
+	if _, err := ParseCompressionMode(string(cfg.Compression)); err != nil {
+		return err
+	}
+
+	if cfg.Version < 2 && cfg.Compression.Enabled() {
+		return errors.New("compression requires repository version 2 or later")
+	}
+
+	if cfg.Parity != nil {
+		if err := cfg.Parity.check(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.PackSize != 0 {
+		if err := CheckPackSize(cfg.PackSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // LoadConfig returns loads, checks and returns the config for a repository.
 func LoadConfig(ctx context.Context, r JSONUnpackedLoader) (Config, error) {
 	var (
@@ -77,10 +210,14 @@ func LoadConfig(ctx context.Context, r JSONUnpackedLoader) (Config, error) {
 		return Config{}, err
 	}
 
-	if cfg.Version != RepoVersion {
+	if cfg.Version < MinRepoVersion || cfg.Version > MaxRepoVersion {
 		return Config{}, errors.New("unsupported repository version")
 	}
 
+	if err = cfg.check(); err != nil {
+		return Config{}, err
+	}
+
 	if checkPolynomial {
 		if !cfg.ChunkerPolynomial.Irreducible() {
 			return Config{}, errors.New("invalid chunker polynomial")
@@ -32,7 +32,7 @@ func TestConfig(t *testing.T) {
 		return restic.ID{}, nil
 	}
 
-	cfg1, err := restic.CreateConfig()
+	cfg1, err := restic.CreateConfig(restic.RepoVersion, restic.CompressionAuto)
 	rtest.OK(t, err)
 
 	_, err = saver(save).SaveJSONUnpacked(restic.ConfigFile, cfg1)
@@ -53,3 +53,35 @@ func TestConfig(t *testing.T) {
 	rtest.Assert(t, cfg1 == cfg2,
 		"configs aren't equal: %v != %v", cfg1, cfg2)
 }
+
+func TestConfigCompressionVersion(t *testing.T) {
+	_, err := restic.CreateConfig(1, restic.CompressionAuto)
+	rtest.Assert(t, err != nil, "expected error for compression in version 1 repository")
+
+	cfg, err := restic.CreateConfig(1, restic.CompressionOff)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), cfg.Version)
+
+	_, err = restic.CreateConfig(restic.MaxRepoVersion+1, restic.CompressionOff)
+	rtest.Assert(t, err != nil, "expected error for unsupported repository version")
+}
+
+func TestConfigPackSize(t *testing.T) {
+	cfg, err := restic.CreateConfig(restic.RepoVersion, restic.CompressionAuto)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(restic.DefaultPackSize), cfg.TargetPackSize())
+
+	cfg.PackSize = 16 * 1024 * 1024
+	rtest.Equals(t, uint(16*1024*1024), cfg.TargetPackSize())
+
+	for _, size := range []uint{restic.MinPackSize - 1, restic.MaxPackSize + 1} {
+		cfg.PackSize = size
+		load := func(ctx context.Context, tpe restic.FileType, id restic.ID, arg interface{}) error {
+			*arg.(*restic.Config) = cfg
+			return nil
+		}
+
+		_, err = restic.LoadConfig(context.TODO(), loader(load))
+		rtest.Assert(t, err != nil, "expected error for pack size %d", size)
+	}
+}
@@ -0,0 +1,43 @@
+package restic
+
+import (
+	"context"
+	"time"
+)
+
+// Deletion marks pack files for deletion. The packs have been removed from
+// the index by prune, they are deleted by a later run of prune once the grace
+// period has passed and if they are still not referenced by then.
+type Deletion struct {
+	Time  time.Time `json:"time"`
+	Packs IDs       `json:"packs"`
+}
+
+// NewDeletion returns a new Deletion for the given packs, which are marked
+// for deletion at time t.
+func NewDeletion(packs IDSet, t time.Time) *Deletion {
+	return &Deletion{
+		Time:  t,
+		Packs: packs.List(),
+	}
+}
+
+// LoadAllDeletions loads all deletion marks stored in the repository, indexed
+// by the ID of the file they are stored in.
+func LoadAllDeletions(ctx context.Context, repo Repository) (map[ID]*Deletion, error) {
+	deletions := make(map[ID]*Deletion)
+	err := repo.List(ctx, DeletionFile, func(id ID, size int64) error {
+		var d Deletion
+		if err := repo.LoadJSONUnpacked(ctx, DeletionFile, id, &d); err != nil {
+			return err
+		}
+
+		deletions[id] = &d
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deletions, nil
+}
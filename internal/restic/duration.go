@@ -0,0 +1,124 @@
+package restic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Duration is a time duration given in years, months, days and hours, e.g.
+// 1y5m7d2h. In contrast to time.Duration, months and years do not have a
+// fixed length.
+type Duration struct {
+	Hours, Days, Months, Years int
+}
+
+func (d Duration) String() string {
+	var s string
+	for _, part := range []struct {
+		n    int
+		unit string
+	}{
+		{d.Years, "y"},
+		{d.Months, "m"},
+		{d.Days, "d"},
+		{d.Hours, "h"},
+	} {
+		if part.n != 0 {
+			s += fmt.Sprintf("%d%s", part.n, part.unit)
+		}
+	}
+
+	return s
+}
+
+// nextNumber splits the leading number off input.
+func nextNumber(input string) (num int, rest string, err error) {
+	i := strings.IndexFunc(input, func(r rune) bool {
+		return !unicode.IsDigit(r)
+	})
+	if i == 0 {
+		return 0, "", errors.Errorf("expected a number at %q", input)
+	}
+	if i < 0 {
+		i = len(input)
+	}
+
+	num, err = strconv.Atoi(input[:i])
+	if err != nil {
+		return 0, "", errors.Wrap(err, "Atoi")
+	}
+
+	return num, input[i:], nil
+}
+
+// ParseDuration parses a duration from a string. The format is a sequence of
+// numbers each followed by one of the units 'y' (years), 'm' (months), 'd'
+// (days) and 'h' (hours), for example 2y5m7d3h.
+func ParseDuration(s string) (Duration, error) {
+	var d Duration
+
+	if s == "" {
+		return Duration{}, errors.New("empty duration")
+	}
+
+	rest := s
+	for rest != "" {
+		var num int
+		var err error
+		num, rest, err = nextNumber(rest)
+		if err != nil {
+			return Duration{}, errors.Errorf("invalid duration %q: %v", s, err)
+		}
+
+		if rest == "" {
+			return Duration{}, errors.Errorf("invalid duration %q: missing unit after %d", s, num)
+		}
+
+		switch rest[0] {
+		case 'y':
+			d.Years += num
+		case 'm':
+			d.Months += num
+		case 'd':
+			d.Days += num
+		case 'h':
+			d.Hours += num
+		default:
+			return Duration{}, errors.Errorf("invalid duration %q: unknown unit %q", s, rest[0])
+		}
+		rest = rest[1:]
+	}
+
+	return d, nil
+}
+
+// Set updates the Duration's value.
+func (d *Duration) Set(s string) error {
+	v, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = v
+	return nil
+}
+
+// Type returns a description of the type.
+func (Duration) Type() string {
+	return "Duration"
+}
+
+// Zero returns true if the duration is empty (all values are set to zero).
+func (d Duration) Zero() bool {
+	return d == Duration{}
+}
+
+// Before returns the point in time the duration d ends before t.
+func (d Duration) Before(t time.Time) time.Time {
+	return t.AddDate(-d.Years, -d.Months, -d.Days).Add(-time.Duration(d.Hours) * time.Hour)
+}
@@ -0,0 +1,62 @@
+package restic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	var tests = []struct {
+		input  string
+		d      Duration
+		output string
+		err    bool
+	}{
+		{input: "", err: true},
+		{input: "2w", err: true},
+		{input: "2", err: true},
+		{input: "d", err: true},
+		{input: "-2d", err: true},
+		{input: "2d", d: Duration{Days: 2}, output: "2d"},
+		{input: "3h", d: Duration{Hours: 3}, output: "3h"},
+		{input: "1y5m7d2h", d: Duration{Years: 1, Months: 5, Days: 7, Hours: 2}, output: "1y5m7d2h"},
+		{input: "2h1d3m", d: Duration{Hours: 2, Days: 1, Months: 3}, output: "3m1d2h"},
+		{input: "10d5d", d: Duration{Days: 15}, output: "15d"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			d, err := ParseDuration(test.input)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %v", test.input, d)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d != test.d {
+				t.Errorf("wrong duration for %q, want %v, got %v", test.input, test.d, d)
+			}
+
+			if d.String() != test.output {
+				t.Errorf("wrong string for %q, want %q, got %q", test.input, test.output, d.String())
+			}
+		})
+	}
+}
+
+func TestDurationBefore(t *testing.T) {
+	ref := time.Date(2018, 3, 31, 12, 0, 0, 0, time.UTC)
+	d := Duration{Years: 1, Months: 1, Days: 2, Hours: 13}
+	// 2017-02-29 does not exist and is normalized to 2017-03-01, then 13
+	// hours are subtracted
+	want := time.Date(2017, 2, 28, 23, 0, 0, 0, time.UTC)
+
+	if got := d.Before(ref); !got.Equal(want) {
+		t.Errorf("wrong result, want %v, got %v", want, got)
+	}
+}
@@ -11,12 +11,16 @@ type FileType string
 
 // These are the different data types a backend can store.
 const (
-	DataFile     FileType = "data"
-	KeyFile               = "key"
-	LockFile              = "lock"
-	SnapshotFile          = "snapshot"
-	IndexFile             = "index"
-	ConfigFile            = "config"
+	DataFile       FileType = "data"
+	KeyFile                 = "key"
+	LockFile                = "lock"
+	SnapshotFile            = "snapshot"
+	IndexFile               = "index"
+	ConfigFile              = "config"
+	ParityFile              = "parity"
+	DeletionFile            = "deletion"
+	SessionKeyFile          = "sessionkey"
+	RepairFile              = "repair"
 )
 
 // Handle is used to store and access data in a backend.
@@ -46,6 +50,10 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case ParityFile:
+	case DeletionFile:
+	case SessionKeyFile:
+	case RepairFile:
 	default:
 		return errors.Errorf("invalid Type %q", h.Type)
 	}
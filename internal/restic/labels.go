@@ -0,0 +1,59 @@
+package restic
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Labels maps label keys to values.
+type Labels map[string]string
+
+// ParseLabel splits a label given as "key=value" into its key and value.
+func ParseLabel(s string) (key, value string, err error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return "", "", errors.Errorf("invalid label %q, expected key=value", s)
+	}
+
+	key, value = strings.TrimSpace(s[:i]), s[i+1:]
+	if key == "" {
+		return "", "", errors.Errorf("invalid label %q, key is empty", s)
+	}
+
+	return key, value, nil
+}
+
+func (l Labels) String() string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := make([]string, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, k+"="+l[k])
+	}
+	return "[" + strings.Join(list, ", ") + "]"
+}
+
+// Set adds the label given as "key=value" to l.
+func (l *Labels) Set(s string) error {
+	key, value, err := ParseLabel(s)
+	if err != nil {
+		return err
+	}
+
+	if *l == nil {
+		*l = make(Labels)
+	}
+	(*l)[key] = value
+	return nil
+}
+
+// Type returns a description of the type.
+func (Labels) Type() string {
+	return "Labels"
+}
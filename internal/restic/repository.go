@@ -23,6 +23,12 @@ type Repository interface {
 	LoadIndex(context.Context) error
 
 	Config() Config
+	// SetConfig replaces the config used for all further operations, it does
+	// not save the config file.
+	SetConfig(Config)
+
+	// PackSize returns the target size of new pack files.
+	PackSize() uint
 
 	LookupBlobSize(ID, BlobType) (uint, bool)
 
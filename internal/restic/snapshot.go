@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 )
 
 // Snapshot is the state of a resource at one point in time.
@@ -24,9 +25,42 @@ type Snapshot struct {
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
 
+	Description string `json:"description,omitempty"`
+	Labels      Labels `json:"labels,omitempty"`
+
+	// Protected snapshots are never removed by forget.
+	Protected bool `json:"protected,omitempty"`
+
+	// Summary contains statistics about the backup which created the
+	// snapshot, it is nil for snapshots created by older versions.
+	Summary *SnapshotSummary `json:"summary,omitempty"`
+
 	id *ID // plaintext ID, used during restore
 }
 
+// SnapshotSummary contains statistics about the backup run which created a
+// snapshot.
+type SnapshotSummary struct {
+	BackupStart time.Time `json:"backup_start"`
+	BackupEnd   time.Time `json:"backup_end"`
+
+	FilesNew        uint `json:"files_new"`
+	FilesChanged    uint `json:"files_changed"`
+	FilesUnmodified uint `json:"files_unmodified"`
+	DirsNew         uint `json:"dirs_new"`
+	DirsChanged     uint `json:"dirs_changed"`
+	DirsUnmodified  uint `json:"dirs_unmodified"`
+
+	// DataBlobs and TreeBlobs count the blobs added to the repository,
+	// DataAdded is the sum of their sizes.
+	DataBlobs int    `json:"data_blobs"`
+	TreeBlobs int    `json:"tree_blobs"`
+	DataAdded uint64 `json:"data_added"`
+
+	TotalFilesProcessed uint   `json:"total_files_processed"`
+	TotalBytesProcessed uint64 `json:"total_bytes_processed"`
+}
+
 // NewSnapshot returns an initialized snapshot struct for the current user and
 // time.
 func NewSnapshot(paths []string, tags []string, hostname string, time time.Time) (*Snapshot, error) {
@@ -66,6 +100,20 @@ func LoadSnapshot(ctx context.Context, repo Repository, id ID) (*Snapshot, error
 	return sn, nil
 }
 
+// ErrSnapshotProtected is returned when a protected snapshot should be removed.
+var ErrSnapshotProtected = errors.New("snapshot is protected")
+
+// RemoveSnapshot removes the snapshot sn from the repository. Protected
+// snapshots are not removed, ErrSnapshotProtected is returned for them.
+func RemoveSnapshot(ctx context.Context, repo Repository, sn *Snapshot) error {
+	if sn.Protected {
+		return ErrSnapshotProtected
+	}
+
+	h := Handle{Type: SnapshotFile, Name: sn.ID().String()}
+	return repo.Backend().Remove(ctx, h)
+}
+
 // LoadAllSnapshots returns a list of all snapshots in the repo.
 func LoadAllSnapshots(ctx context.Context, repo Repository) (snapshots []*Snapshot, err error) {
 	err = repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
@@ -181,6 +229,51 @@ func (sn *Snapshot) HasTagList(l []TagList) bool {
 	return false
 }
 
+// SetLabels adds the given labels to the snapshot, existing labels with the
+// same key are replaced. It returns true if any changes were made.
+func (sn *Snapshot) SetLabels(labels Labels) (changed bool) {
+	for key, value := range labels {
+		if v, ok := sn.Labels[key]; ok && v == value {
+			continue
+		}
+
+		if sn.Labels == nil {
+			sn.Labels = make(Labels)
+		}
+		sn.Labels[key] = value
+		changed = true
+	}
+	return
+}
+
+// RemoveLabels removes the labels with the given keys from the snapshot and
+// returns true if any changes were made.
+func (sn *Snapshot) RemoveLabels(keys []string) (changed bool) {
+	for _, key := range keys {
+		if _, ok := sn.Labels[key]; ok {
+			delete(sn.Labels, key)
+			changed = true
+		}
+	}
+
+	if len(sn.Labels) == 0 {
+		sn.Labels = nil
+	}
+	return
+}
+
+// HasLabels returns true if the snapshot has all the labels in l with the
+// same values.
+func (sn *Snapshot) HasLabels(l Labels) bool {
+	for key, value := range l {
+		if v, ok := sn.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (sn *Snapshot) hasPath(path string) bool {
 	for _, snPath := range sn.Paths {
 		if path == snPath {
@@ -13,8 +13,8 @@ import (
 // ErrNoSnapshotFound is returned when no snapshot for the given criteria could be found.
 var ErrNoSnapshotFound = errors.New("no snapshot found")
 
-// FindLatestSnapshot finds latest snapshot with optional target/directory, tags and hostname filters.
-func FindLatestSnapshot(ctx context.Context, repo Repository, targets []string, tagLists []TagList, hostname string) (ID, error) {
+// FindLatestSnapshot finds latest snapshot with optional target/directory, tags, labels and hostname filters.
+func FindLatestSnapshot(ctx context.Context, repo Repository, targets []string, tagLists []TagList, labels Labels, hostname string) (ID, error) {
 	var err error
 	absTargets := make([]string, 0, len(targets))
 	for _, target := range targets {
@@ -42,7 +42,7 @@ func FindLatestSnapshot(ctx context.Context, repo Repository, targets []string,
 			return nil
 		}
 
-		if !snapshot.HasTagList(tagLists) {
+		if !snapshot.HasTagList(tagLists) || !snapshot.HasLabels(labels) {
 			return nil
 		}
 
@@ -82,7 +82,7 @@ func FindSnapshot(repo Repository, s string) (ID, error) {
 
 // FindFilteredSnapshots yields Snapshots filtered from the list of all
 // snapshots.
-func FindFilteredSnapshots(ctx context.Context, repo Repository, host string, tags []TagList, paths []string) (Snapshots, error) {
+func FindFilteredSnapshots(ctx context.Context, repo Repository, host string, tags []TagList, labels Labels, paths []string) (Snapshots, error) {
 	results := make(Snapshots, 0, 20)
 
 	err := repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
@@ -92,7 +92,7 @@ func FindFilteredSnapshots(ctx context.Context, repo Repository, host string, ta
 			return nil
 		}
 
-		if (host != "" && host != sn.Hostname) || !sn.HasTagList(tags) || !sn.HasPaths(paths) {
+		if (host != "" && host != sn.Hostname) || !sn.HasTagList(tags) || !sn.HasLabels(labels) || !sn.HasPaths(paths) {
 			return nil
 		}
 
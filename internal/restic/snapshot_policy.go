@@ -17,6 +17,13 @@ type ExpirePolicy struct {
 	Monthly int       // keep the last n monthly snapshots
 	Yearly  int       // keep the last n yearly snapshots
 	Tags    []TagList // keep all snapshots that include at least one of the tag lists.
+
+	// The durations are relative to the latest snapshot.
+	Within        Duration // keep all snapshots made within this duration
+	WithinDaily   Duration // keep daily snapshots made within this duration
+	WithinWeekly  Duration // keep weekly snapshots made within this duration
+	WithinMonthly Duration // keep monthly snapshots made within this duration
+	WithinYearly  Duration // keep yearly snapshots made within this duration
 }
 
 func (e ExpirePolicy) String() (s string) {
@@ -40,12 +47,38 @@ func (e ExpirePolicy) String() (s string) {
 		keeps = append(keeps, fmt.Sprintf("%d yearly", e.Yearly))
 	}
 
-	s = "keep the last "
-	for _, k := range keeps {
-		s += k + ", "
+	var within []string
+	if !e.Within.Zero() {
+		within = append(within, fmt.Sprintf("all snapshots within %v", e.Within))
+	}
+	if !e.WithinDaily.Zero() {
+		within = append(within, fmt.Sprintf("daily snapshots within %v", e.WithinDaily))
+	}
+	if !e.WithinWeekly.Zero() {
+		within = append(within, fmt.Sprintf("weekly snapshots within %v", e.WithinWeekly))
+	}
+	if !e.WithinMonthly.Zero() {
+		within = append(within, fmt.Sprintf("monthly snapshots within %v", e.WithinMonthly))
+	}
+	if !e.WithinYearly.Zero() {
+		within = append(within, fmt.Sprintf("yearly snapshots within %v", e.WithinYearly))
+	}
+
+	if len(keeps) > 0 || len(within) == 0 {
+		s = "keep the last "
+		for _, k := range keeps {
+			s += k + ", "
+		}
+		s = strings.Trim(s, ", ")
+		s += " snapshots"
+	}
+
+	if len(within) > 0 {
+		if s != "" {
+			s += ", "
+		}
+		s += "keep " + strings.Join(within, ", ")
 	}
-	s = strings.Trim(s, ", ")
-	s += " snapshots"
 
 	return s
 }
@@ -97,39 +130,80 @@ func always(d time.Time, nr int) int {
 	return nr
 }
 
+// KeepReason specifies why a particular snapshot was kept by ApplyPolicy.
+type KeepReason struct {
+	Snapshot *Snapshot
+
+	// Matches contains a description of all the rules which kept the
+	// snapshot, e.g. "daily snapshot" or "within 14d".
+	Matches []string
+}
+
 // ApplyPolicy returns the snapshots from list that are to be kept and removed
-// according to the policy p. list is sorted in the process.
-func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots) {
+// according to the policy p. list is sorted in the process. For each snapshot
+// in keep, reasons contains the rules of the policy which kept it. Protected
+// snapshots are always kept.
+func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reasons []KeepReason) {
 	sort.Sort(list)
 
 	if p.Empty() {
-		return list, remove
+		for _, sn := range list {
+			reasons = append(reasons, KeepReason{
+				Snapshot: sn,
+				Matches:  []string{"policy is empty"},
+			})
+		}
+		return list, remove, reasons
 	}
 
 	if len(list) == 0 {
-		return list, remove
+		return list, remove, nil
 	}
 
 	var buckets = [6]struct {
 		Count  int
 		bucker func(d time.Time, nr int) int
 		Last   int
+		reason string
 	}{
-		{p.Last, always, -1},
-		{p.Hourly, ymdh, -1},
-		{p.Daily, ymd, -1},
-		{p.Weekly, yw, -1},
-		{p.Monthly, ym, -1},
-		{p.Yearly, y, -1},
+		{p.Last, always, -1, "last snapshot"},
+		{p.Hourly, ymdh, -1, "hourly snapshot"},
+		{p.Daily, ymd, -1, "daily snapshot"},
+		{p.Weekly, yw, -1, "weekly snapshot"},
+		{p.Monthly, ym, -1, "monthly snapshot"},
+		{p.Yearly, y, -1, "yearly snapshot"},
 	}
 
+	var bucketsWithin = [5]struct {
+		Within Duration
+		bucker func(d time.Time, nr int) int
+		Last   int
+		reason string
+	}{
+		{p.Within, always, -1, "within %v"},
+		{p.WithinDaily, ymd, -1, "daily within %v"},
+		{p.WithinWeekly, yw, -1, "weekly within %v"},
+		{p.WithinMonthly, ym, -1, "monthly within %v"},
+		{p.WithinYearly, y, -1, "yearly within %v"},
+	}
+
+	// the list is sorted, so the first snapshot is the latest one
+	latest := list[0].Time
+
 	for nr, cur := range list {
 		var keepSnap bool
+		var keepSnapReasons []string
+
+		if cur.Protected {
+			keepSnap = true
+			keepSnapReasons = append(keepSnapReasons, "protected")
+		}
 
 		// Tags are handled specially as they are not counted.
 		for _, l := range p.Tags {
 			if cur.HasTags(l) {
 				keepSnap = true
+				keepSnapReasons = append(keepSnapReasons, fmt.Sprintf("has tags %v", l))
 			}
 		}
 
@@ -141,16 +215,31 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots) {
 					keepSnap = true
 					buckets[i].Last = val
 					buckets[i].Count--
+					keepSnapReasons = append(keepSnapReasons, b.reason)
+				}
+			}
+		}
+
+		// Keep the first snapshot of each bucket as long as it is within
+		// the duration before the latest snapshot.
+		for i, b := range bucketsWithin {
+			if !b.Within.Zero() && !cur.Time.Before(b.Within.Before(latest)) {
+				val := b.bucker(cur.Time, nr)
+				if val != b.Last {
+					keepSnap = true
+					bucketsWithin[i].Last = val
+					keepSnapReasons = append(keepSnapReasons, fmt.Sprintf(b.reason, b.Within))
 				}
 			}
 		}
 
 		if keepSnap {
 			keep = append(keep, cur)
+			reasons = append(reasons, KeepReason{Snapshot: cur, Matches: keepSnapReasons})
 		} else {
 			remove = append(remove, cur)
 		}
 	}
 
-	return keep, remove
+	return keep, remove, reasons
 }
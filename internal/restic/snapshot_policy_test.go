@@ -175,7 +175,7 @@ var expireTests = []restic.ExpirePolicy{
 
 func TestApplyPolicy(t *testing.T) {
 	for i, p := range expireTests {
-		keep, remove := restic.ApplyPolicy(testExpireSnapshots, p)
+		keep, remove, _ := restic.ApplyPolicy(testExpireSnapshots, p)
 
 		t.Logf("test %d: returned keep %v, remove %v (of %v) expired snapshots for policy %v",
 			i, len(keep), len(remove), len(testExpireSnapshots), p)
@@ -229,3 +229,161 @@ func TestApplyPolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyPolicyWithin(t *testing.T) {
+	var tests = []struct {
+		p     restic.ExpirePolicy
+		keep  []string
+		match string
+	}{
+		{
+			restic.ExpirePolicy{Within: restic.Duration{Days: 7}},
+			[]string{"2016-01-18 12:02:03", "2016-01-12 21:08:03", "2016-01-12 21:02:03"},
+			"within 7d",
+		},
+		{
+			restic.ExpirePolicy{WithinDaily: restic.Duration{Days: 7}},
+			[]string{"2016-01-18 12:02:03", "2016-01-12 21:08:03"},
+			"daily within 7d",
+		},
+		{
+			restic.ExpirePolicy{WithinWeekly: restic.Duration{Months: 1}},
+			[]string{"2016-01-18 12:02:03", "2016-01-12 21:08:03", "2016-01-09 21:02:03", "2016-01-03 07:02:03"},
+			"weekly within 1m",
+		},
+		{
+			restic.ExpirePolicy{WithinMonthly: restic.Duration{Years: 1}},
+			[]string{"2016-01-18 12:02:03", "2015-11-22 10:20:30", "2015-10-22 10:20:30", "2015-09-22 10:20:30", "2015-08-22 10:20:30"},
+			"monthly within 1y",
+		},
+		{
+			restic.ExpirePolicy{WithinYearly: restic.Duration{Years: 10}},
+			[]string{"2016-01-18 12:02:03", "2015-11-22 10:20:30", "2014-11-22 10:20:30"},
+			"yearly within 10y",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.p.String(), func(t *testing.T) {
+			list := append(restic.Snapshots{}, testExpireSnapshots...)
+			keep, remove, reasons := restic.ApplyPolicy(list, test.p)
+
+			if len(keep)+len(remove) != len(list) {
+				t.Errorf("len(keep)+len(remove) = %d != len(list) = %d", len(keep)+len(remove), len(list))
+			}
+
+			var kept []string
+			for _, sn := range keep {
+				kept = append(kept, sn.Time.Format("2006-01-02 15:04:05"))
+			}
+			if !reflect.DeepEqual(kept, test.keep) {
+				t.Fatalf("wrong snapshots kept, want:\n  %v\ngot:\n  %v", test.keep, kept)
+			}
+
+			if len(reasons) != len(keep) {
+				t.Fatalf("got %d reasons for %d snapshots", len(reasons), len(keep))
+			}
+			for i, reason := range reasons {
+				if reason.Snapshot != keep[i] {
+					t.Errorf("reason %d belongs to wrong snapshot %v", i, reason.Snapshot)
+				}
+				if !reflect.DeepEqual(reason.Matches, []string{test.match}) {
+					t.Errorf("wrong reasons for snapshot %v: want %q, got %q", reason.Snapshot, test.match, reason.Matches)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyPolicyReasons(t *testing.T) {
+	p := restic.ExpirePolicy{
+		Last:        1,
+		Weekly:      2,
+		WithinDaily: restic.Duration{Days: 7},
+		Tags:        []restic.TagList{{"foo", "bar"}},
+	}
+
+	list := append(restic.Snapshots{}, testExpireSnapshots...)
+	_, _, reasons := restic.ApplyPolicy(list, p)
+
+	want := map[string][]string{
+		"2016-01-18 12:02:03": {"last snapshot", "weekly snapshot", "daily within 7d"},
+		"2016-01-12 21:08:03": {"weekly snapshot", "daily within 7d"},
+		"2014-11-15 10:20:30": {"has tags [foo, bar]"},
+	}
+
+	for _, reason := range reasons {
+		ts := reason.Snapshot.Time.Format("2006-01-02 15:04:05")
+		matches, ok := want[ts]
+		if !ok {
+			continue
+		}
+		delete(want, ts)
+
+		if !reflect.DeepEqual(reason.Matches, matches) {
+			t.Errorf("wrong reasons for snapshot at %v: want %q, got %q", ts, matches, reason.Matches)
+		}
+	}
+
+	for ts := range want {
+		t.Errorf("snapshot at %v was not kept", ts)
+	}
+}
+
+func TestApplyPolicyProtected(t *testing.T) {
+	list := make(restic.Snapshots, 0, len(testExpireSnapshots))
+	for _, sn := range testExpireSnapshots {
+		sn := *sn
+		list = append(list, &sn)
+	}
+
+	// protect the oldest snapshot, it is removed by the policy otherwise
+	oldest := list[0]
+	for _, sn := range list {
+		if sn.Time.Before(oldest.Time) {
+			oldest = sn
+		}
+	}
+	oldest.Protected = true
+
+	keep, remove, reasons := restic.ApplyPolicy(list, restic.ExpirePolicy{Last: 1})
+	if len(keep) != 2 || len(remove) != len(list)-2 {
+		t.Fatalf("wrong number of snapshots kept: want 2, got %v (removed %v)", len(keep), len(remove))
+	}
+
+	for _, sn := range remove {
+		if sn.Protected {
+			t.Errorf("protected snapshot at %v was removed", sn.Time)
+		}
+	}
+
+	for _, reason := range reasons {
+		if reason.Snapshot == oldest && !reflect.DeepEqual(reason.Matches, []string{"protected"}) {
+			t.Errorf("wrong reasons for protected snapshot: %q", reason.Matches)
+		}
+	}
+}
+
+func TestExpirePolicyString(t *testing.T) {
+	var tests = []struct {
+		p    restic.ExpirePolicy
+		want string
+	}{
+		{restic.ExpirePolicy{Daily: 7, Weekly: 4}, "keep the last 7 daily, 4 weekly snapshots"},
+		{restic.ExpirePolicy{Within: restic.Duration{Days: 14}}, "keep all snapshots within 14d"},
+		{
+			restic.ExpirePolicy{
+				Daily:         2,
+				WithinDaily:   restic.Duration{Months: 3},
+				WithinMonthly: restic.Duration{Years: 2},
+			},
+			"keep the last 2 daily snapshots, keep daily snapshots within 3m, monthly snapshots within 2y",
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.p.String(); got != test.want {
+			t.Errorf("wrong string, want %q, got %q", test.want, got)
+		}
+	}
+}
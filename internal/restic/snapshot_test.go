@@ -14,3 +14,37 @@ func TestNewSnapshot(t *testing.T) {
 	_, err := restic.NewSnapshot(paths, nil, "foo", time.Now())
 	rtest.OK(t, err)
 }
+
+func TestSnapshotLabels(t *testing.T) {
+	sn, err := restic.NewSnapshot([]string{"/home/foobar"}, nil, "foo", time.Now())
+	rtest.OK(t, err)
+
+	rtest.Assert(t, sn.HasLabels(nil), "snapshot without labels does not match empty filter")
+	rtest.Assert(t, !sn.HasLabels(restic.Labels{"env": "prod"}), "snapshot without labels matches filter")
+
+	rtest.Assert(t, sn.SetLabels(restic.Labels{"env": "prod", "ticket": "1234"}), "adding labels did not change the snapshot")
+	rtest.Assert(t, !sn.SetLabels(restic.Labels{"env": "prod"}), "adding an existing label changed the snapshot")
+	rtest.Assert(t, sn.HasLabels(restic.Labels{"env": "prod"}), "label env=prod not found")
+	rtest.Assert(t, !sn.HasLabels(restic.Labels{"env": "test"}), "label env=test found")
+	rtest.Assert(t, !sn.HasLabels(restic.Labels{"env": "prod", "foo": "bar"}), "label foo=bar found")
+
+	rtest.Assert(t, sn.SetLabels(restic.Labels{"env": "test"}), "replacing a label did not change the snapshot")
+	rtest.Equals(t, restic.Labels{"env": "test", "ticket": "1234"}, sn.Labels)
+
+	rtest.Assert(t, !sn.RemoveLabels([]string{"foo"}), "removing a missing label changed the snapshot")
+	rtest.Assert(t, sn.RemoveLabels([]string{"env", "ticket"}), "removing labels did not change the snapshot")
+	rtest.Assert(t, sn.Labels == nil, "labels are not empty: %v", sn.Labels)
+}
+
+func TestLabelsSet(t *testing.T) {
+	var l restic.Labels
+	rtest.OK(t, l.Set("env=prod"))
+	rtest.OK(t, l.Set(" reason = pre-upgrade=1"))
+	rtest.OK(t, l.Set("empty="))
+	rtest.Equals(t, restic.Labels{"env": "prod", "reason": " pre-upgrade=1", "empty": ""}, l)
+
+	for _, s := range []string{"", "foo", "=bar"} {
+		err := l.Set(s)
+		rtest.Assert(t, err != nil, "invalid label %q accepted", s)
+	}
+}